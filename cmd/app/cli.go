@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/app"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/cluster"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/gcp"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/notify"
+	webdav2 "gitlab.cmpayments.local/payments-gateway/backupsmanager/pkg/webdav"
+	"go.uber.org/zap"
+	"golang.org/x/sync/semaphore"
+	"os"
+	"time"
+)
+
+// notifyDrainTimeout limits the time the commands wait for their notifications to be delivered
+const notifyDrainTimeout = 30 * time.Second
+
+// command is a subcommand of the binary
+type command struct {
+	// args are the flags and arguments shown in the usage
+	args    string
+	summary string
+	run     func(ctx context.Context, logger *zap.Logger, configFile string, args []string) error
+}
+
+// commands by name, set in init since the commands print their own usage
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"serve": {
+			summary: "start the API server (default)",
+			run: func(ctx context.Context, logger *zap.Logger, configFile string, args []string) error {
+				cfg, err := loadConfig(configFile)
+				if err != nil {
+					panic(err)
+				}
+				serve(ctx, logger, cfg)
+				return nil
+			},
+		},
+		"backup": {
+			args:    "-collection name [-cluster name] [-options json] [-process=false]",
+			summary: "back up a collection and zip, encrypt and upload it",
+			run:     runBackup,
+		},
+		"list": {
+			args:    "[-bucket] [-prefix prefix]",
+			summary: "list the local backups, or the objects in the bucket",
+			run:     runList,
+		},
+		"restore": {
+			args:    "-collection name [-cluster name] [-backup /2022/01/24-163045.99] [-options json]",
+			summary: "restore a local backup into its cluster",
+			run:     runRestore,
+		},
+		"encrypt": {
+			args:    "-in file [-out dir]",
+			summary: "encrypt a file as it is uploaded to the bucket",
+			run:     runEncrypt,
+		},
+		"decrypt": {
+			args:    "-in file [-out dir] [-ext .zip]",
+			summary: "decrypt an object downloaded from the bucket",
+			run:     runDecrypt,
+		},
+		"upload": {
+			args:    "-in file",
+			summary: "upload an encrypted file to the bucket",
+			run:     runUpload,
+		},
+		"download": {
+			args:    "-object name [-out dir]",
+			summary: "download an object from the bucket",
+			run:     runDownload,
+		},
+		"verify": {
+			args:    "-object name | -in file",
+			summary: "check that an encrypted backup decrypts and unzips",
+			run:     runVerify,
+		},
+		"recover": {
+			args:    "-key key | -key-file file -in file [-out dir]",
+			summary: "decrypt, verify and unzip a backup without configuration, database or bucket",
+			run:     runRecover,
+		},
+		"prune": {
+			args:    "-collection name -keep-days n [-cluster name] [-keep n] [-bucket] [-dry-run]",
+			summary: "delete the backups of a collection older than the retention",
+			run:     runPrune,
+		},
+	}
+}
+
+// commandOrder is the order of the commands in the usage
+var commandOrder = []string{"serve", "backup", "list", "restore", "encrypt", "decrypt", "upload", "download", "verify", "recover", "prune"}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [-Config file] [command] [flags]\n\nCommands:\n", os.Args[0])
+	for _, name := range commandOrder {
+		fmt.Fprintf(out, "  %-9s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintf(out, "\nRun %s [command] -h for the flags of a command.\n\nFlags:\n", os.Args[0])
+	flag.PrintDefaults()
+}
+
+// newFlagSet returns the flag set of the command with the given name
+func newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s [-Config file] %s %s\n\n  %s\n\nFlags:\n", os.Args[0], name, commands[name].args, commands[name].summary)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// cli holds the components used by the commands, which run without the server
+type cli struct {
+	ctx               context.Context
+	logger            *zap.Logger
+	cfg               Config
+	sem               app.Semaphore
+	fileSystemWrapper *app.FileSystemWrapper
+	notifier          *notify.Dispatcher
+}
+
+func newCLI(ctx context.Context, logger *zap.Logger, configFile string) (*cli, error) {
+	cfg, err := loadConfig(configFile)
+	if err != nil {
+		return nil, err
+	}
+	fileSystemWrapper := app.NewFileSystemWrapper(ctx, logger, cfg.WorkingDir)
+	if err := migrateLegacyBackups(cfg, fileSystemWrapper); err != nil {
+		return nil, fmt.Errorf("error migrating the backups into the default cluster: %w", err)
+	}
+	return &cli{
+		ctx:               ctx,
+		logger:            logger,
+		cfg:               cfg,
+		sem:               semaphore.NewWeighted(int64(10)),
+		fileSystemWrapper: fileSystemWrapper,
+	}, nil
+}
+
+// engine connects to the cluster with the given name. CRDB writes its backups through the WebDAV endpoint of the
+// server, so it needs the configured credentials when the endpoint requires them.
+func (c *cli) engine(name string) (cluster.Engine, *sql.DB, error) {
+	dbCfg, ok := c.cfg.ClusterConfigs()[name]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown cluster %s", name)
+	}
+	var credentials *webdav2.Credentials
+	if crdbEngine(dbCfg) && c.cfg.API.WebDAVBasicAuth {
+		if dbCfg.WebDAVUser == "" {
+			return nil, nil, fmt.Errorf("cluster %s needs WebDAVUser and WebDAVPassword, the credentials generated by the server are unknown", name)
+		}
+		credentials = &webdav2.Credentials{User: dbCfg.WebDAVUser, Password: dbCfg.WebDAVPassword}
+	}
+	return newEngine(c.ctx, c.logger, c.cfg, name, dbCfg, c.fileSystemWrapper, credentials)
+}
+
+// gcsIntegrator returns the bucket client, downloading into downloadsDir
+func (c *cli) gcsIntegrator(downloadsDir string) (*gcp.GCSIntegrator, error) {
+	if !c.cfg.GCP.Enabled {
+		return nil, errors.New("the GCP integration is not enabled")
+	}
+	return gcp.NewGCSIntegrator(c.ctx, c.logger, c.sem, downloadsDir, c.cfg.GCP), nil
+}
+
+// notify queues event for the configured notifiers, close waits for the delivery
+func (c *cli) notify(event notify.Event) {
+	if c.notifier == nil {
+		notifier, err := notify.NewDispatcherFromConfig(c.ctx, c.logger, c.cfg.Notify, app.NewCatalog(c.logger, c.fileSystemWrapper.PathCatalog()))
+		if err != nil {
+			c.logger.Warn("notify: error setting up notifications", zap.Error(err))
+			return
+		}
+		c.notifier = notifier
+	}
+	c.notifier.Notify(event)
+}
+
+// close waits until the queued notifications are delivered
+func (c *cli) close() {
+	if c.notifier == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.ctx, notifyDrainTimeout)
+	defer cancel()
+	if err := c.notifier.Drain(ctx); err != nil {
+		c.logger.Warn("close: notifications not delivered", zap.Error(err))
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/app"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/cluster"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/notify"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// runBackup backs up a collection like the server does: the engine job is followed until it finished and the
+// LATEST backup is zipped, encrypted and uploaded, recorded in the catalog and notified
+func runBackup(ctx context.Context, logger *zap.Logger, configFile string, args []string) error {
+	flags := newFlagSet("backup")
+	clusterName := flags.String("cluster", cluster.DefaultName, "cluster of the collection")
+	collection := flags.String("collection", "", "collection to back up into")
+	options := flags.String("options", "", "engine specific JSON options")
+	process := flags.Bool("process", true, "zip, encrypt and upload the backup when the GCP integration is enabled")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if !cluster.ValidName(*collection) {
+		return errors.New("-collection must be a valid collection name")
+	}
+
+	c, err := newCLI(ctx, logger, configFile)
+	if err != nil {
+		return err
+	}
+	defer c.close()
+	engine, db, err := c.engine(*clusterName)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	event := notify.Event{
+		Type:       notify.EventBackupFailed,
+		Status:     notify.StatusFailed,
+		Cluster:    *clusterName,
+		Collection: *collection,
+	}
+	ref, err := engine.StartBackup(*collection, []byte(*options))
+	if err == nil {
+		fmt.Printf("backup job %d started\n", ref.ID)
+		err = c.waitForJob(engine, ref)
+	}
+	if err == nil {
+		var entry app.CatalogEntry
+		entry, err = c.processLatest(engine, *clusterName, *collection, *process)
+		if catalogErr := app.NewCatalog(logger, c.fileSystemWrapper.PathCatalog()).Add(entry); catalogErr != nil {
+			logger.Warn("runBackup: error adding catalog entry", zap.Error(catalogErr))
+		}
+		event.Backup, event.Object = entry.Backup, entry.Object
+	}
+	if err != nil {
+		event.Error = err.Error()
+		c.notify(event)
+		return err
+	}
+	event.Type, event.Status = notify.EventBackupSucceeded, notify.StatusSucceeded
+	c.notify(event)
+	fmt.Printf("backup %s of %s/%s succeeded", event.Backup, *clusterName, *collection)
+	if event.Object != "" {
+		fmt.Printf(", uploaded as %s", event.Object)
+	}
+	fmt.Println()
+	return nil
+}
+
+// runRestore restores a local backup into its cluster and waits until it finished
+func runRestore(ctx context.Context, logger *zap.Logger, configFile string, args []string) error {
+	flags := newFlagSet("restore")
+	clusterName := flags.String("cluster", cluster.DefaultName, "cluster of the collection")
+	collection := flags.String("collection", "", "collection of the backup")
+	backup := flags.String("backup", "", "backup directory inside the collection, the LATEST backup when empty")
+	options := flags.String("options", "", "engine specific JSON options")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if !cluster.ValidName(*collection) {
+		return errors.New("-collection must be a valid collection name")
+	}
+
+	c, err := newCLI(ctx, logger, configFile)
+	if err != nil {
+		return err
+	}
+	defer c.close()
+	engine, db, err := c.engine(*clusterName)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ref, err := engine.StartRestore(*collection, *backup, []byte(*options))
+	if err == nil {
+		fmt.Printf("restore job %d started\n", ref.ID)
+		err = c.waitForJob(engine, ref)
+	}
+	event := notify.Event{
+		Type:       notify.EventRestoreCompleted,
+		Status:     notify.StatusSucceeded,
+		Cluster:    *clusterName,
+		Collection: *collection,
+		Backup:     *backup,
+	}
+	if err != nil {
+		event.Status, event.Error = notify.StatusFailed, err.Error()
+	}
+	c.notify(event)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("restore of %s/%s succeeded\n", *clusterName, *collection)
+	return nil
+}
+
+// runList lists the local backups per collection, or the objects in the bucket
+func runList(ctx context.Context, logger *zap.Logger, configFile string, args []string) error {
+	flags := newFlagSet("list")
+	bucket := flags.Bool("bucket", false, "list the objects in the bucket instead of the local backups")
+	prefix := flags.String("prefix", "", "only list the backups of the collections ({cluster}/{collection}) or objects with this prefix")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	c, err := newCLI(ctx, logger, configFile)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer w.Flush()
+
+	if *bucket {
+		gcsIntegrator, err := c.gcsIntegrator(c.fileSystemWrapper.PathGSDownloads())
+		if err != nil {
+			return err
+		}
+		objects, err := gcsIntegrator.List(ctx, *prefix)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, "OBJECT\tSIZE\tUPDATED")
+		for _, object := range objects {
+			fmt.Fprintf(w, "%s\t%d\t%s\n", object.Name, object.Size, object.Updated.UTC().Format(time.RFC3339))
+		}
+		return nil
+	}
+
+	backups, err := localBackups(c.fileSystemWrapper.PathBackups())
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "COLLECTION\tBACKUP")
+	for _, backup := range backups {
+		collection := path.Join(backup.Cluster, backup.Collection)
+		if strings.HasPrefix(collection, *prefix) {
+			fmt.Fprintf(w, "%s\t%s\n", collection, backup.Backup)
+		}
+	}
+	return nil
+}
+
+// waitForJob follows a detached engine job until it finished, printing its progress
+func (c *cli) waitForJob(engine cluster.Engine, ref cluster.JobRef) error {
+	if !ref.Detached {
+		return nil
+	}
+	status, err := engine.WaitForJob(c.ctx, ref.ID, c.cfg.API.JobPollInterval(), func(s cluster.JobStatus) {
+		fmt.Printf("job %d %s: %.0f%%\n", ref.ID, s.Status, s.FractionCompleted*100)
+	})
+	if err != nil {
+		return fmt.Errorf("error following engine job: %w", err)
+	}
+	switch status.Status {
+	case cluster.JobStatusSucceeded:
+		return nil
+	case cluster.JobStatusFailed:
+		return fmt.Errorf("engine job failed: %s", status.Error)
+	default:
+		return fmt.Errorf("engine job %s", status.Status)
+	}
+}
+
+// processLatest zips, encrypts and uploads the LATEST backup of the collection when process is set and the GCP
+// integration is enabled, returning its catalog entry
+func (c *cli) processLatest(engine cluster.Engine, clusterName string, collection string, process bool) (app.CatalogEntry, error) {
+	entry := app.CatalogEntry{
+		Cluster:    clusterName,
+		Collection: collection,
+		Source:     engine.Name(),
+		Status:     app.CatalogSucceeded,
+	}
+	fail := func(err error) (app.CatalogEntry, error) {
+		entry.Status, entry.Error = app.CatalogFailed, err.Error()
+		return entry, err
+	}
+
+	collectionDir := path.Join(c.fileSystemWrapper.PathBackups(), clusterName, collection)
+	latest, err := ioutil.ReadFile(path.Join(collectionDir, "LATEST"))
+	if err != nil {
+		return fail(fmt.Errorf("error getting LATEST backup: %w", err))
+	}
+	entry.Path = path.Join(collectionDir, strings.TrimSpace(string(latest)))
+	entry.Backup = strings.TrimPrefix(entry.Path, collectionDir)
+	if _, err := os.Stat(entry.Path); err != nil {
+		return fail(fmt.Errorf("error getting LATEST backup: %w", err))
+	}
+	if !process || !c.cfg.GCP.Enabled {
+		return entry, nil
+	}
+
+	zipper := app.NewZipper(c.ctx, c.logger, c.sem, c.fileSystemWrapper)
+	encryptor := app.NewEncryptor(c.ctx, c.logger, c.sem, c.fileSystemWrapper.PathEncrypted(), c.fileSystemWrapper.PathDecrypted())
+	gcsIntegrator, err := c.gcsIntegrator(c.fileSystemWrapper.PathGSDownloads())
+	if err != nil {
+		return fail(err)
+	}
+	result, more := <-gcsIntegrator.UploadToStorage(c.ctx, encryptor.Encrypt(c.ctx, zipper.Zip(c.ctx, entry.Path, nil), nil), nil)
+	if !more {
+		return fail(errors.New("backup processing was interrupted"))
+	}
+	if result.Err() != nil {
+		return fail(result.Err())
+	}
+	entry.Object = path.Base(result.Content())
+	return entry, nil
+}
+
+// localBackup is a backup directory in the working dir
+type localBackup struct {
+	Cluster    string
+	Collection string
+	// Backup is the backup directory inside the collection, e.g. /2022/01/24-163045.99
+	Backup string
+	Path   string
+}
+
+// Time returns the time the backup started, parsed from its directory
+func (b localBackup) Time() (time.Time, error) {
+	return time.Parse("/2006/01/02-150405.00", b.Backup)
+}
+
+// localBackups returns the backup directories with data in backupsDir, sorted by collection and backup
+func localBackups(backupsDir string) ([]localBackup, error) {
+	var backups []localBackup
+	err := filepath.Walk(backupsDir, func(dir string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) && dir == backupsDir {
+			return filepath.SkipDir
+		}
+		if err != nil || !info.IsDir() {
+			return err
+		}
+		if data, err := os.Stat(filepath.Join(dir, "data")); err != nil || !data.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(backupsDir, dir)
+		if err != nil {
+			return err
+		}
+		// backups are stored as {cluster}/{collection}/{year}/{month}/{day-time}
+		elements := strings.SplitN(filepath.ToSlash(rel), "/", 3)
+		if len(elements) == 3 {
+			backups = append(backups, localBackup{
+				Cluster:    elements[0],
+				Collection: elements[1],
+				Backup:     "/" + elements[2],
+				Path:       dir,
+			})
+		}
+		return filepath.SkipDir
+	})
+	sort.Slice(backups, func(i, j int) bool {
+		a, b := backups[i], backups[j]
+		if a.Cluster != b.Cluster {
+			return a.Cluster < b.Cluster
+		}
+		if a.Collection != b.Collection {
+			return a.Collection < b.Collection
+		}
+		return a.Backup < b.Backup
+	})
+	return backups, err
+}
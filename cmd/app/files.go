@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/app"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/cluster"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/notify"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// single returns a closed stream holding only the file at filePath
+func single(filePath string) <-chan app.DTO {
+	stream := make(chan app.DTO, 1)
+	stream <- app.NewDTOInstance(nil, filePath)
+	close(stream)
+	return stream
+}
+
+// runEncrypt encrypts a file as it is uploaded to the bucket
+func runEncrypt(ctx context.Context, logger *zap.Logger, configFile string, args []string) error {
+	flags := newFlagSet("encrypt")
+	in := flags.String("in", "", "file to encrypt")
+	out := flags.String("out", ".", "directory to write the encrypted file to, named as the file without extension")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *in == "" {
+		return errors.New("-in is required")
+	}
+
+	c, err := newCLI(ctx, logger, configFile)
+	if err != nil {
+		return err
+	}
+	encryptor := app.NewEncryptor(ctx, logger, c.sem, *out, *out)
+	result, more := <-encryptor.Encrypt(ctx, single(*in), nil)
+	if !more {
+		return errors.New("encryption was interrupted")
+	}
+	if result.Err() != nil {
+		return result.Err()
+	}
+	fmt.Println(result.Content())
+	return nil
+}
+
+// runDecrypt decrypts an object downloaded from the bucket
+func runDecrypt(ctx context.Context, logger *zap.Logger, configFile string, args []string) error {
+	flags := newFlagSet("decrypt")
+	in := flags.String("in", "", "encrypted file")
+	out := flags.String("out", ".", "directory to write the decrypted file to")
+	ext := flags.String("ext", ".zip", "extension added to the name of the decrypted file")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *in == "" {
+		return errors.New("-in is required")
+	}
+
+	c, err := newCLI(ctx, logger, configFile)
+	if err != nil {
+		return err
+	}
+	decrypted, err := app.NewEncryptor(ctx, logger, c.sem, *out, *out).DecryptFileAs(*in, *ext)
+	if err != nil {
+		return fmt.Errorf("error decrypting %s: %w", *in, err)
+	}
+	fmt.Println(decrypted)
+	return nil
+}
+
+// runUpload uploads a file to the bucket, named as its base name
+func runUpload(ctx context.Context, logger *zap.Logger, configFile string, args []string) error {
+	flags := newFlagSet("upload")
+	in := flags.String("in", "", "file to upload")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *in == "" {
+		return errors.New("-in is required")
+	}
+
+	c, err := newCLI(ctx, logger, configFile)
+	if err != nil {
+		return err
+	}
+	gcsIntegrator, err := c.gcsIntegrator(c.fileSystemWrapper.PathGSDownloads())
+	if err != nil {
+		return err
+	}
+	result, more := <-gcsIntegrator.UploadToStorage(ctx, single(*in), nil)
+	if !more {
+		return errors.New("upload was interrupted")
+	}
+	if result.Err() != nil {
+		return result.Err()
+	}
+	fmt.Println(path.Base(*in))
+	return nil
+}
+
+// runDownload downloads an object from the bucket
+func runDownload(ctx context.Context, logger *zap.Logger, configFile string, args []string) error {
+	flags := newFlagSet("download")
+	object := flags.String("object", "", "name of the object in the bucket")
+	out := flags.String("out", ".", "directory to write the object to")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *object == "" {
+		return errors.New("-object is required")
+	}
+
+	c, err := newCLI(ctx, logger, configFile)
+	if err != nil {
+		return err
+	}
+	gcsIntegrator, err := c.gcsIntegrator(*out)
+	if err != nil {
+		return err
+	}
+	downloaded, err := gcsIntegrator.DownloadFromBucket(*object)
+	if err != nil {
+		return err
+	}
+	fmt.Println(downloaded)
+	return nil
+}
+
+// runVerify checks that an encrypted backup, in the bucket or a local file, decrypts and that every file in its zip
+// is intact. Failures are notified as verification.failed.
+func runVerify(ctx context.Context, logger *zap.Logger, configFile string, args []string) error {
+	flags := newFlagSet("verify")
+	object := flags.String("object", "", "name of the object in the bucket")
+	in := flags.String("in", "", "local encrypted file")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if (*object == "") == (*in == "") {
+		return errors.New("either -object or -in is required")
+	}
+
+	c, err := newCLI(ctx, logger, configFile)
+	if err != nil {
+		return err
+	}
+	defer c.close()
+	tmpDir, err := ioutil.TempDir("", "backupsmanager-verify-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	encrypted := *in
+	if *object != "" {
+		gcsIntegrator, err := c.gcsIntegrator(tmpDir)
+		if err != nil {
+			return err
+		}
+		if encrypted, err = gcsIntegrator.DownloadFromBucket(*object); err != nil {
+			return err
+		}
+	}
+	files, size, err := app.NewEncryptor(ctx, logger, c.sem, tmpDir, tmpDir).Verify(encrypted)
+	if err != nil {
+		name := path.Base(encrypted)
+		clusterName, collection := app.ObjectCollection(name)
+		c.notify(notify.Event{
+			Type:       notify.EventVerificationFailed,
+			Status:     notify.StatusFailed,
+			Cluster:    clusterName,
+			Collection: collection,
+			Object:     name,
+			Error:      err.Error(),
+		})
+		return err
+	}
+	fmt.Printf("%s verified: %d files, %d bytes\n", path.Base(encrypted), files, size)
+	return nil
+}
+
+// runPrune deletes the backups of a collection older than the retention, locally and in the bucket. The newest
+// backups and the LATEST backup are always kept. Every deletion is notified as retention.deleted.
+func runPrune(ctx context.Context, logger *zap.Logger, configFile string, args []string) error {
+	flags := newFlagSet("prune")
+	clusterName := flags.String("cluster", cluster.DefaultName, "cluster of the collection")
+	collection := flags.String("collection", "", "collection to prune")
+	keepDays := flags.Int("keep-days", 0, "delete the backups older than this number of days")
+	keep := flags.Int("keep", 1, "number of newest backups to keep regardless of their age")
+	bucket := flags.Bool("bucket", false, "also prune the objects of the collection in the bucket")
+	dryRun := flags.Bool("dry-run", false, "only print what would be deleted")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if !cluster.ValidName(*collection) {
+		return errors.New("-collection must be a valid collection name")
+	}
+	if *keepDays <= 0 {
+		return errors.New("-keep-days must be positive")
+	}
+	if *keep < 0 {
+		return errors.New("-keep must not be negative")
+	}
+
+	c, err := newCLI(ctx, logger, configFile)
+	if err != nil {
+		return err
+	}
+	defer c.close()
+	cutoff := time.Now().UTC().AddDate(0, 0, -*keepDays)
+	deleted := func(backup string, object string) {
+		c.notify(notify.Event{
+			Type:       notify.EventRetentionDeleted,
+			Status:     notify.StatusSucceeded,
+			Cluster:    *clusterName,
+			Collection: *collection,
+			Backup:     backup,
+			Object:     object,
+		})
+	}
+
+	if err := c.pruneLocal(*clusterName, *collection, cutoff, *keep, *dryRun, deleted); err != nil {
+		return err
+	}
+	if *bucket {
+		return c.pruneBucket(*clusterName, *collection, cutoff, *keep, *dryRun, deleted)
+	}
+	return nil
+}
+
+// pruneLocal deletes the local backups of the collection started before cutoff, except the keep newest and LATEST
+func (c *cli) pruneLocal(clusterName string, collection string, cutoff time.Time, keep int, dryRun bool, deleted func(backup string, object string)) error {
+	collectionDir := path.Join(c.fileSystemWrapper.PathBackups(), clusterName, collection)
+	all, err := localBackups(c.fileSystemWrapper.PathBackups())
+	if err != nil {
+		return err
+	}
+	var backups []localBackup
+	for _, backup := range all {
+		if backup.Cluster == clusterName && backup.Collection == collection {
+			backups = append(backups, backup)
+		}
+	}
+	latest := ""
+	if content, err := ioutil.ReadFile(path.Join(collectionDir, "LATEST")); err == nil {
+		latest = path.Join("/", strings.TrimSpace(string(content)))
+	}
+
+	// backups are sorted oldest first
+	for i, backup := range backups {
+		if i >= len(backups)-keep || backup.Backup == latest {
+			continue
+		}
+		started, err := backup.Time()
+		if err != nil || !started.Before(cutoff) {
+			continue
+		}
+		if dryRun {
+			fmt.Printf("would delete %s/%s%s\n", clusterName, collection, backup.Backup)
+			continue
+		}
+		fmt.Printf("deleting %s/%s%s\n", clusterName, collection, backup.Backup)
+		if err := os.RemoveAll(backup.Path); err != nil {
+			return fmt.Errorf("error deleting %s: %w", backup.Path, err)
+		}
+		deleted(backup.Backup, "")
+	}
+	return nil
+}
+
+// pruneBucket deletes the objects of the collection updated before cutoff, except the keep newest
+func (c *cli) pruneBucket(clusterName string, collection string, cutoff time.Time, keep int, dryRun bool, deleted func(backup string, object string)) error {
+	gcsIntegrator, err := c.gcsIntegrator(c.fileSystemWrapper.PathGSDownloads())
+	if err != nil {
+		return err
+	}
+	objects, err := gcsIntegrator.List(c.ctx, clusterName+"_"+collection+"_")
+	if err != nil {
+		return err
+	}
+	if clusterName == cluster.DefaultName {
+		// the objects made before clusters were introduced are named {collection}_{year}_...
+		legacy, err := gcsIntegrator.List(c.ctx, collection+"_")
+		if err != nil {
+			return err
+		}
+		for _, object := range legacy {
+			if strings.HasPrefix(object.Name, clusterName+"_"+collection+"_") {
+				// listed already when the collection is named like the default cluster
+				continue
+			}
+			if objectCluster, objectCollection := app.ObjectCollection(object.Name); objectCluster == clusterName && objectCollection == collection {
+				objects = append(objects, object)
+			}
+		}
+	}
+	// the names end with the time of the backup, so they sort oldest first
+	sort.Slice(objects, func(i, j int) bool {
+		_, _, a := app.ObjectBackup(objects[i].Name)
+		_, _, b := app.ObjectBackup(objects[j].Name)
+		return a < b
+	})
+	for i, object := range objects {
+		if i >= len(objects)-keep || !object.Updated.Before(cutoff) {
+			continue
+		}
+		if dryRun {
+			fmt.Printf("would delete object %s\n", object.Name)
+			continue
+		}
+		fmt.Printf("deleting object %s\n", object.Name)
+		if err := gcsIntegrator.Delete(c.ctx, object.Name); err != nil {
+			return err
+		}
+		deleted("", object.Name)
+	}
+	return nil
+}
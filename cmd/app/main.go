@@ -6,19 +6,21 @@ import (
 	"flag"
 	"fmt"
 	"gitlab.cmpayments.local/libraries-go/configuration"
-	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/app"
-	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/crdb"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/audit"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/auth"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/cluster"
 	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/gcp"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/health"
 	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/interfaces/api"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/notify"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/tracing"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/watchdog"
 	"gitlab.cmpayments.local/payments-gateway/backupsmanager/pkg/ctxt"
 	"gitlab.cmpayments.local/payments-gateway/backupsmanager/pkg/database"
-	"gitlab.cmpayments.local/payments-gateway/backupsmanager/pkg/server"
-	webdav2 "gitlab.cmpayments.local/payments-gateway/backupsmanager/pkg/webdav"
 	"go.uber.org/zap"
-	"golang.org/x/sync/semaphore"
 	"log"
-	"net/http"
 	"os"
+	"strings"
 )
 
 type Config struct {
@@ -28,8 +30,22 @@ type Config struct {
 	SanityCleanIntervalInMinutes int
 	// API Config
 	API api.Config
-	// DB is the database Config
+	// Auth is the authentication Config of the API
+	Auth auth.Config
+	// Audit is the Config of the sinks of the audit log
+	Audit audit.Config
+	// Notify is the Config of the notifications of backup outcomes
+	Notify notify.Config
+	// Probes is the Config of the liveness and readiness checks
+	Probes health.Config
+	// Tracing is the Config of the OpenTelemetry exporter, no-op by default
+	Tracing tracing.Config
+	// Freshness are the SLOs checked by the staleness watchdog
+	Freshness watchdog.Config
+	// DB is the database Config of the default cluster, optional when Clusters are configured
 	DB database.Config
+	// Clusters are the database Configs of additional clusters by name
+	Clusters map[string]database.Config
 	// GCP is the Google cloud storage Config
 	GCP gcp.Config
 }
@@ -44,79 +60,118 @@ func (c Config) Assert() error {
 	if err := c.API.Assert(); err != nil {
 		return fmt.Errorf("%w in API Config", err)
 	}
-	if err := c.DB.Assert(); err != nil {
-		return fmt.Errorf("%w in DB Config", err)
+	if err := c.Auth.Assert(); err != nil {
+		return fmt.Errorf("%w in Auth Config", err)
+	}
+	if c.Auth.Enabled && !c.API.WebDAVBasicAuth {
+		for _, prefix := range c.Auth.ExceptPaths {
+			if strings.HasPrefix(api.Paths.Backups(), prefix) || strings.HasPrefix(prefix, api.Paths.Backups()) {
+				return fmt.Errorf("except path %q requires API.WebDAVBasicAuth, WebDAV requests without bearer token are only authorized by the credentials of a cluster", prefix)
+			}
+		}
+	}
+	if err := c.Audit.Assert(); err != nil {
+		return fmt.Errorf("%w in Audit Config", err)
+	}
+	if err := c.Notify.Assert(); err != nil {
+		return fmt.Errorf("%w in Notify Config", err)
+	}
+	if err := c.Probes.Assert(); err != nil {
+		return fmt.Errorf("%w in Probes Config", err)
+	}
+	if err := c.Tracing.Assert(); err != nil {
+		return fmt.Errorf("%w in Tracing Config", err)
+	}
+	if err := c.Freshness.Assert(); err != nil {
+		return fmt.Errorf("%w in Freshness Config", err)
+	}
+	if c.Freshness.Offsite() && !c.GCP.Enabled {
+		return errors.New("offsite freshness SLOs require the GCP integration")
+	}
+	if c.DB.Host != "" {
+		if err := c.DB.Assert(); err != nil {
+			return fmt.Errorf("%w in DB Config", err)
+		}
+	}
+	for name, db := range c.Clusters {
+		if !cluster.ValidName(name) {
+			return fmt.Errorf("invalid cluster name %q", name)
+		}
+		if name == cluster.DefaultName || name == cluster.IngestName {
+			return fmt.Errorf("cluster name %q is reserved", name)
+		}
+		if err := db.Assert(); err != nil {
+			return fmt.Errorf("%w in Clusters.%s Config", err, name)
+		}
+	}
+	if len(c.ClusterConfigs()) == 0 {
+		return errors.New("at least one cluster should be configured in DB or Clusters")
 	}
 	return nil
 }
 
+// ClusterConfigs returns the database Configs of all clusters by name, including the default one
+func (c Config) ClusterConfigs() map[string]database.Config {
+	configs := make(map[string]database.Config, len(c.Clusters)+1)
+	if c.DB.Host != "" {
+		configs[cluster.DefaultName] = c.DB
+	}
+	for name, db := range c.Clusters {
+		configs[name] = db
+	}
+	return configs
+}
+
+// loadConfig loads and asserts the Config in configFile
+func loadConfig(configFile string) (Config, error) {
+	var cfg Config
+	if err := configuration.LoadIni(configFile, &cfg); err != nil {
+		return cfg, err
+	}
+	if err := cfg.Assert(); err != nil {
+		return cfg, fmt.Errorf("configuration error: %w", err)
+	}
+	return cfg, nil
+}
+
 func main() {
 	// Config
 	configFile := flag.String(`Config`, `Config.ini`, `Configuration file`)
+	flag.Usage = usage
 	flag.Parse()
-	var cfg Config
-	if err := configuration.LoadIni(*configFile, &cfg); err != nil {
-		panic(err)
-	} else if err := cfg.Assert(); err != nil {
-		panic(fmt.Sprintf("configuration error: %v", err))
+
+	// Command, the server is started when none is given
+	name, args := "serve", flag.Args()
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		usage()
+		os.Exit(2)
 	}
 
 	// Context
 	ctx := ctxt.WithSignalTrap(context.Background(), os.Kill, os.Interrupt)
 
-	// Logger
+	// Logger, the commands only log warnings to keep their output readable
 	logger, _ := zap.NewProduction()
-	defer func() {
-		if err := logger.Sync(); err != nil {
-			log.Println("error in logger sync", err.Error())
-		}
-	}()
-
-	// Database
-	logger.Debug("main: connecting to database", zap.String("host", cfg.DB.Host), zap.String("database", cfg.DB.Database))
-	db, err := database.NewCrdb(cfg.DB)
-	if err != nil {
-		panic(fmt.Errorf("error connecting to database %s: %w", cfg.DB.Host, err))
+	if name != "serve" {
+		loggerConfig := zap.NewDevelopmentConfig()
+		loggerConfig.Level = zap.NewAtomicLevelAt(zap.WarnLevel)
+		loggerConfig.DisableStacktrace = true
+		logger, _ = loggerConfig.Build()
 	}
-	defer db.Close()
-
-	// Semaphore
-	// this service has backups, fromBucket and SanityClean processes which are using the same file system resources.
-	// sem will avoid collision issues between these internal processes.
-	sem := semaphore.NewWeighted(int64(10))
-
-	// Components
-	fileSystemWrapper := app.NewFileSystemWrapper(ctx, logger, cfg.WorkingDir)
-	crdbWrapper := crdb.NewWrapper(logger, db, fileServerEndpoint(cfg.API.BaseURL))
-	webdavWrapper := webdav2.NewWrapper(logger, fileSystemWrapper.PathBackups())
-	zipper := app.NewZipper(ctx, logger, sem, fileSystemWrapper)
-	encryptor := app.NewEncryptor(ctx, logger, sem, fileSystemWrapper.PathEncrypted(), fileSystemWrapper.PathDecrypted())
-	gcsIntegrator := gcp.NewGCSIntegrator(ctx, logger, sem, fileSystemWrapper.PathGSDownloads(), cfg.GCP)
-	cleaner := app.NewCleaner(ctx, logger, sem, fileSystemWrapper)
 
-	mux := http.NewServeMux()
-
-	mux.Handle("/probes/*", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-	}))
-
-	// setup handlers
-	api.RegisterHandler(ctx, logger, cfg.GCP.Enabled, sem, crdbWrapper, webdavWrapper, zipper, encryptor, gcsIntegrator, fileSystemWrapper, mux)
-
-	// set up cleanup routine
-	cleaner.SanityClean(cfg.SanityCleanIntervalInMinutes)
-
-	serverAddr := cfg.API.Listen
-	srv := server.New(mux, serverAddr)
-
-	// start server
-	logger.Info("main: server starting", zap.String("Addr", serverAddr))
-	errSv := srv.ListenAndServe()
-	if errSv != nil {
-		logger.Fatal("main: server failed to start: %v", zap.Error(errSv))
+	err := cmd.run(ctx, logger, *configFile, args)
+	if syncErr := logger.Sync(); syncErr != nil {
+		log.Println("error in logger sync", syncErr.Error())
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		os.Exit(1)
 	}
-}
-
-func fileServerEndpoint(apiBaseUrl string) string {
-	return apiBaseUrl + api.Paths.Backups()
 }
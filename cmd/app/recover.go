@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/app"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// runRecover decrypts, verifies and unzips an object downloaded from the bucket into any directory. It only needs the
+// key, no configuration, database or bucket, so backups can be recovered when the service and its cluster are gone.
+func runRecover(ctx context.Context, logger *zap.Logger, configFile string, args []string) error {
+	flags := newFlagSet("recover")
+	key := flags.String("key", "", "encryption key of the backups, visible in the process list, prefer -key-file")
+	keyFile := flags.String("key-file", "", "file holding the encryption key, trailing newlines are ignored")
+	in := flags.String("in", "", "encrypted backup, e.g. an object downloaded from the bucket")
+	out := flags.String("out", "", "directory to unzip the backup into, defaults to the name of the backup followed by -recovered")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *in == "" {
+		return errors.New("-in is required")
+	}
+	if (*key == "") == (*keyFile == "") {
+		return errors.New("either -key or -key-file is required")
+	}
+	if *keyFile != "" {
+		content, err := ioutil.ReadFile(*keyFile)
+		if err != nil {
+			return fmt.Errorf("error reading key: %w", err)
+		}
+		*key = strings.TrimRight(string(content), "\r\n")
+	}
+	if *out == "" {
+		// the objects have no extension, their names end with the fraction of the seconds of the backup
+		base := filepath.Base(*in)
+		if ext := filepath.Ext(base); strings.Trim(ext, ".0123456789") != "" {
+			base = strings.TrimSuffix(base, ext)
+		}
+		*out = base + "-recovered"
+	}
+	if info, err := os.Stat(*out); err == nil && !info.IsDir() {
+		return fmt.Errorf("-out %s exists and is not a directory", *out)
+	}
+
+	ciphered, err := ioutil.ReadFile(*in)
+	if err != nil {
+		return err
+	}
+	plain, err := app.Decrypt([]byte(*key), ciphered)
+	if err != nil {
+		return fmt.Errorf("error decrypting %s: %w", *in, err)
+	}
+
+	// the archive is verified before anything is written to out
+	zipFile, err := ioutil.TempFile("", "backupsmanager-recover-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(zipFile.Name())
+	_, err = zipFile.Write(plain)
+	if closeErr := zipFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error writing decrypted archive: %w", err)
+	}
+	files, size, err := app.VerifyZip(zipFile.Name())
+	if err != nil {
+		return fmt.Errorf("error verifying %s: %w", *in, err)
+	}
+	if err := app.Unzip(zipFile.Name(), *out); err != nil {
+		return fmt.Errorf("error unzipping %s: %w", *in, err)
+	}
+	fmt.Printf("recovered %d files, %d bytes into %s\n", files, size, *out)
+	return nil
+}
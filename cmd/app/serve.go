@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"fmt"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/app"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/audit"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/auth"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/cluster"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/crdb"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/gcp"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/health"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/interfaces/api"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/interfaces/grpcapi"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/metrics"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/mysql"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/notify"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/postgres"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/tracing"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/watchdog"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/pkg/database"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/pkg/server"
+	webdav2 "gitlab.cmpayments.local/payments-gateway/backupsmanager/pkg/webdav"
+	"go.uber.org/zap"
+	"golang.org/x/sync/semaphore"
+	"google.golang.org/grpc"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+)
+
+// serve starts the API server and the background routines until ctx is done
+func serve(ctx context.Context, logger *zap.Logger, cfg Config) {
+	// Tracing
+	shutdownTracing, err := tracing.Setup(ctx, logger, cfg.Tracing)
+	if err != nil {
+		panic(fmt.Errorf("error setting up tracing: %w", err))
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			logger.Warn("serve: error shutting down tracing", zap.Error(err))
+		}
+	}()
+
+	// Metrics
+	appMetrics := metrics.NewMetrics(cfg.WorkingDir)
+
+	// Semaphore
+	// this service has backups, fromBucket and SanityClean processes which are using the same file system resources.
+	// sem will avoid collision issues between these internal processes.
+	sem := appMetrics.Semaphore(semaphore.NewWeighted(int64(10)))
+
+	// File system
+	fileSystemWrapper := app.NewFileSystemWrapper(ctx, logger, cfg.WorkingDir)
+	if err := migrateLegacyBackups(cfg, fileSystemWrapper); err != nil {
+		panic(fmt.Errorf("error migrating the backups into the default cluster: %w", err))
+	}
+
+	// Databases, a connection pool per cluster
+	clusters := cluster.NewRegistry()
+	webdavCredentials := make(map[string]webdav2.Credentials)
+	for name, dbCfg := range cfg.ClusterConfigs() {
+		var credentials *webdav2.Credentials
+		if crdbEngine(dbCfg) && cfg.API.WebDAVBasicAuth {
+			c, err := clusterWebDAVCredentials(name, dbCfg)
+			if err != nil {
+				panic(fmt.Errorf("error generating WebDAV credentials of cluster %s: %w", name, err))
+			}
+			webdavCredentials[name] = c
+			credentials = &c
+		}
+		engine, db, err := newEngine(ctx, logger, cfg, name, dbCfg, fileSystemWrapper, credentials)
+		if err != nil {
+			panic(err)
+		}
+		defer db.Close()
+		clusters.Add(name, engine)
+	}
+
+	// Components
+	webdavWrapper := webdav2.NewWrapper(logger, fileSystemWrapper.PathBackups(), webdavCredentials)
+	zipper := app.NewZipper(ctx, logger, sem, fileSystemWrapper)
+	encryptor := app.NewEncryptor(ctx, logger, sem, fileSystemWrapper.PathEncrypted(), fileSystemWrapper.PathDecrypted())
+	gcsIntegrator := gcp.NewGCSIntegrator(ctx, logger, sem, fileSystemWrapper.PathGSDownloads(), cfg.GCP)
+	cleaner := app.NewCleaner(ctx, logger, sem, fileSystemWrapper)
+	jobs := app.NewJobs()
+	catalog := app.NewCatalog(logger, fileSystemWrapper.PathCatalog())
+	seedLastSuccess(logger, catalog, appMetrics)
+	auditSinks, err := audit.NewSinks(ctx, logger, cfg.Audit)
+	if err != nil {
+		panic(fmt.Errorf("error setting up audit sinks: %w", err))
+	}
+	auditLog, err := audit.NewLog(logger, fileSystemWrapper.PathAudit(), auditSinks...)
+	if err != nil {
+		panic(fmt.Errorf("error opening audit log: %w", err))
+	}
+
+	notifier, err := notify.NewDispatcherFromConfig(ctx, logger, cfg.Notify, catalog)
+	if err != nil {
+		panic(fmt.Errorf("error setting up notifications: %w", err))
+	}
+
+	freshnessWatchdog := watchdog.NewWatchdog(logger, cfg.Freshness, catalog, appMetrics, notifier)
+
+	authenticator, err := auth.NewAuthenticator(logger, cfg.Auth)
+	if err != nil {
+		panic(fmt.Errorf("error loading tokens: %w", err))
+	}
+
+	mux := http.NewServeMux()
+
+	mux.Handle("/probes/", newChecker(logger, cfg, clusters, fileSystemWrapper, gcsIntegrator, cleaner).Handler())
+
+	// setup handlers
+	handler := api.RegisterHandler(ctx, logger, cfg.GCP.Enabled, sem, clusters, webdavWrapper, zipper, encryptor, gcsIntegrator, fileSystemWrapper, jobs, catalog, auditLog, appMetrics, notifier, freshnessWatchdog, cfg.API, mux)
+
+	// set up cleanup routine
+	cleaner.SanityClean(cfg.SanityCleanIntervalInMinutes)
+
+	// check the freshness of the backups
+	freshnessWatchdog.Run(ctx)
+
+	var tlsConfig *tls.Config
+	if cfg.API.TLS.Enabled() {
+		if tlsConfig, err = server.NewTLSConfig(logger, cfg.API.TLS); err != nil {
+			panic(fmt.Errorf("error loading TLS configuration: %w", err))
+		}
+	}
+
+	if cfg.API.GRPCListen != "" {
+		go serveGRPC(ctx, logger, grpcapi.NewServer(logger, handler, authenticator, auditLog, tlsConfig), cfg.API.GRPCListen)
+	}
+
+	serverAddr := cfg.API.Listen
+	srv := server.New(api.RequestID(tracing.Middleware(authenticator.Middleware(mux, http.HandlerFunc(handler.Unauthorized)))), serverAddr, cfg.API.ReadTimeout(), cfg.API.WriteTimeout(), tlsConfig)
+
+	// start server
+	logger.Info("serve: server starting", zap.String("Addr", serverAddr), zap.Bool("TLS", tlsConfig != nil))
+	var errSv error
+	if tlsConfig != nil {
+		// the certificate is served by tlsConfig.GetCertificate
+		errSv = srv.ListenAndServeTLS("", "")
+	} else {
+		errSv = srv.ListenAndServe()
+	}
+	if errSv != nil {
+		logger.Fatal("serve: server failed to start: %v", zap.Error(errSv))
+	}
+}
+
+// serveGRPC serves the gRPC API on addr until ctx is done
+func serveGRPC(ctx context.Context, logger *zap.Logger, srv *grpc.Server, addr string) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		logger.Fatal("serveGRPC: gRPC server failed to listen", zap.String("Addr", addr), zap.Error(err))
+	}
+	go func() {
+		<-ctx.Done()
+		srv.GracefulStop()
+	}()
+	logger.Info("serveGRPC: gRPC server starting", zap.String("Addr", addr))
+	if err := srv.Serve(listener); err != nil {
+		logger.Fatal("serveGRPC: gRPC server failed", zap.Error(err))
+	}
+}
+
+// crdbEngine returns true when the cluster is backed up by CRDB, which writes its backups through WebDAV
+func crdbEngine(dbCfg database.Config) bool {
+	return dbCfg.Engine != cluster.EnginePostgres && dbCfg.Engine != cluster.EngineMySQL
+}
+
+// newEngine connects to the database of the cluster and returns its engine, credentials are the WebDAV credentials
+// CRDB uses to write its backups
+func newEngine(ctx context.Context, logger *zap.Logger, cfg Config, name string, dbCfg database.Config, fileSystemWrapper *app.FileSystemWrapper, credentials *webdav2.Credentials) (cluster.Engine, *sql.DB, error) {
+	logger.Debug("newEngine: connecting to database", zap.String("cluster", name), zap.String("host", dbCfg.Host), zap.String("database", dbCfg.Database))
+	connect := database.NewCrdb
+	if dbCfg.Engine == cluster.EngineMySQL {
+		connect = database.NewMysql
+	}
+	db, err := connect(dbCfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error connecting to database %s of cluster %s: %w", dbCfg.Host, name, err)
+	}
+	switch dbCfg.Engine {
+	case cluster.EnginePostgres:
+		return postgres.NewEngine(ctx, logger, db, dbCfg, path.Join(fileSystemWrapper.PathBackups(), name)), db, nil
+	case cluster.EngineMySQL:
+		return mysql.NewEngine(ctx, logger, db, dbCfg, path.Join(fileSystemWrapper.PathBackups(), name)), db, nil
+	default:
+		return crdb.NewWrapper(logger, db, fileServerEndpoint(cfg.API.BaseURL, name, credentials)), db, nil
+	}
+}
+
+// schedulerMaxAge is how old the heartbeat of the clean routine may be, a clean is skipped instead of waiting for
+// the semaphore while all slots are used by backups
+const schedulerMaxAge = 5 * time.Minute
+
+// newChecker registers the checks of the dependencies of the service for the probes
+func newChecker(logger *zap.Logger, cfg Config, clusters *cluster.Registry, fileSystemWrapper *app.FileSystemWrapper, gcsIntegrator *gcp.GCSIntegrator, cleaner *app.Cleaner) *health.Checker {
+	checker := health.NewChecker(logger, cfg.Probes)
+	checker.AddLiveness(health.CheckScheduler, health.Heartbeat(cleaner.LastBeat, schedulerMaxAge))
+	checker.Add(health.CheckWorkingDir, health.WorkingDir(cfg.WorkingDir, cfg.Probes.MinFreeSpace()))
+	for _, name := range clusters.Names() {
+		engine, _ := clusters.Get(name)
+		checker.Add(health.CheckDB+":"+name, engine.Ping)
+	}
+	if cfg.GCP.Enabled {
+		checker.Add(health.CheckStorage, gcsIntegrator.Ping)
+	}
+	return checker
+}
+
+// seedLastSuccess sets the time of the last successful backup per collection from the catalog, so the metric
+// survives restarts
+func seedLastSuccess(logger *zap.Logger, catalog *app.Catalog, appMetrics *metrics.Metrics) {
+	entries, err := catalog.Entries(func(entry app.CatalogEntry) bool {
+		return entry.Status == app.CatalogSucceeded
+	})
+	if err != nil {
+		logger.Warn("seedLastSuccess: error reading catalog", zap.Error(err))
+		return
+	}
+	for _, entry := range entries {
+		appMetrics.SetLastSuccess(entry.Cluster, entry.Collection, entry.Time)
+	}
+}
+
+// migrateLegacyBackups moves the collections of the backups made before clusters were introduced,
+// /backups/{collection}/..., into the default cluster
+func migrateLegacyBackups(cfg Config, fileSystemWrapper *app.FileSystemWrapper) error {
+	clusters := []string{cluster.IngestName}
+	for name := range cfg.ClusterConfigs() {
+		clusters = append(clusters, name)
+	}
+	_, err := fileSystemWrapper.MigrateLegacyBackups(cluster.DefaultName, clusters)
+	return err
+}
+
+// fileServerEndpoint returns the WebDAV endpoint where the backups of the cluster are stored, including the
+// credentials of the cluster when set
+func fileServerEndpoint(apiBaseUrl string, clusterName string, credentials *webdav2.Credentials) string {
+	endpoint := apiBaseUrl + api.Paths.Backups() + clusterName
+	if credentials == nil {
+		return endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		// BaseURL and the cluster name are validated by Config.Assert
+		panic(err)
+	}
+	u.User = url.UserPassword(credentials.User, credentials.Password)
+	return u.String()
+}
+
+// clusterWebDAVCredentials returns the configured WebDAV credentials of a cluster, or generates them
+func clusterWebDAVCredentials(clusterName string, dbCfg database.Config) (webdav2.Credentials, error) {
+	if dbCfg.WebDAVUser != "" {
+		return webdav2.Credentials{User: dbCfg.WebDAVUser, Password: dbCfg.WebDAVPassword}, nil
+	}
+	return webdav2.GenerateCredentials("crdb-" + clusterName)
+}
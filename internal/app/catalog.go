@@ -0,0 +1,100 @@
+package app
+
+import (
+	"bufio"
+	"encoding/json"
+	"go.uber.org/zap"
+	"os"
+	"sync"
+	"time"
+)
+
+// Catalog statuses
+const (
+	CatalogSucceeded = "succeeded"
+	CatalogFailed    = "failed"
+)
+
+// CatalogEntry records the outcome of processing a backup
+type CatalogEntry struct {
+	Time       time.Time `json:"time"`
+	JobID      string    `json:"jobId,omitempty"`
+	Cluster    string    `json:"cluster"`
+	Collection string    `json:"collection"`
+	// Backup is the backup directory inside the collection, e.g. /2022/01/24-163045.99
+	Backup string `json:"backup"`
+	// Source is the engine or producer of the backup, e.g. crdb or ingest
+	Source string `json:"source"`
+	// Path is the local backup directory
+	Path string `json:"path"`
+	// Object is the name of the encrypted backup in the bucket, empty when it was not uploaded
+	Object string `json:"object,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Catalog is an append-only JSON lines file with an entry per processed backup
+type Catalog struct {
+	logger   *zap.Logger
+	mu       sync.Mutex
+	filePath string
+}
+
+func NewCatalog(logger *zap.Logger, filePath string) *Catalog {
+	return &Catalog{
+		logger:   logger,
+		filePath: filePath,
+	}
+}
+
+// Add appends entry to the catalog
+func (c *Catalog) Add(entry CatalogEntry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f, err := os.OpenFile(c.filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		c.logger.Error("Add: error opening catalog", zap.String("catalog", c.filePath), zap.Error(err))
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		c.logger.Error("Add: error writing catalog entry", zap.String("catalog", c.filePath), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// Entries returns the catalog entries accepted by filter, in the order they were added. A nil filter accepts all.
+func (c *Catalog) Entries(filter func(CatalogEntry) bool) ([]CatalogEntry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f, err := os.Open(c.filePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []CatalogEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry CatalogEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			c.logger.Warn("Entries: skipping invalid catalog entry", zap.Error(err))
+			continue
+		}
+		if filter == nil || filter(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
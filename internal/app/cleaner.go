@@ -3,21 +3,26 @@ package app
 import (
 	"context"
 	"go.uber.org/zap"
-	"golang.org/x/sync/semaphore"
 	"io/ioutil"
 	"os"
 	"path"
+	"sync/atomic"
 	"time"
 )
 
+// heartbeatInterval is how often the clean routine beats while it is alive
+const heartbeatInterval = 30 * time.Second
+
 type Cleaner struct {
 	ctx               context.Context
 	logger            *zap.Logger
-	sem               *semaphore.Weighted
+	sem               Semaphore
 	fileSystemWrapper *FileSystemWrapper
+	// lastBeat unix nanoseconds of the last heartbeat of the clean routine
+	lastBeat int64
 }
 
-func NewCleaner(ctx context.Context, logger *zap.Logger, sem *semaphore.Weighted, fileSystemWrapper *FileSystemWrapper) *Cleaner {
+func NewCleaner(ctx context.Context, logger *zap.Logger, sem Semaphore, fileSystemWrapper *FileSystemWrapper) *Cleaner {
 	return &Cleaner{
 		ctx:               ctx,
 		logger:            logger,
@@ -28,31 +33,46 @@ func NewCleaner(ctx context.Context, logger *zap.Logger, sem *semaphore.Weighted
 
 func (c *Cleaner) SanityClean(durationInMinutes int) {
 	ticker := time.NewTicker(time.Duration(durationInMinutes) * time.Minute)
+	heartbeat := time.NewTicker(heartbeatInterval)
+	c.beat()
 	go func() {
 		defer ticker.Stop()
+		defer heartbeat.Stop()
 		for {
 			select {
 			case <-c.ctx.Done():
 				return
+			case <-heartbeat.C:
+				c.beat()
 			case t := <-ticker.C:
 				c.cleanTempDirsContent(t)
+				c.beat()
 			}
 		}
 	}()
 }
 
+func (c *Cleaner) beat() {
+	atomic.StoreInt64(&c.lastBeat, time.Now().UnixNano())
+}
+
+// LastBeat returns the time of the last heartbeat of the clean routine, zero if it was not started
+func (c *Cleaner) LastBeat() time.Time {
+	nanos := atomic.LoadInt64(&c.lastBeat)
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+// cleanTempDirsContent cleans the temporary directories unless all slots of the semaphore are used by backups, the
+// clean is then skipped until the next tick so the routine keeps beating
 func (c *Cleaner) cleanTempDirsContent(t time.Time) {
-	// get and release local semaphore
-	semErr := c.sem.Acquire(c.ctx, 1)
-	defer func() {
-		if semErr == nil {
-			c.sem.Release(1)
-		}
-	}()
-	if semErr != nil {
-		c.logger.Error("cleanTempDirsContent: unable to obtain local semaphore")
+	if !c.sem.TryAcquire(1) {
+		c.logger.Info("cleanTempDirsContent: semaphore is busy, skipping the clean", zap.Time("at", t))
 		return
 	}
+	defer c.sem.Release(1)
 
 	c.logger.Info("cleanTempDirsContent: cleaning temp dirs...", zap.Time("at", t))
 	if err := c.removeDirContents(c.fileSystemWrapper.PathZips()); err != nil {
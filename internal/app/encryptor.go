@@ -7,8 +7,8 @@ import (
 	"crypto/rand"
 	"errors"
 	"fmt"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/tracing"
 	"go.uber.org/zap"
-	"golang.org/x/sync/semaphore"
 	"io"
 	"io/ioutil"
 	"os"
@@ -21,12 +21,12 @@ const passPhrase = "passphrasewhichneedstobe32bytes!"
 type Encryptor struct {
 	ctx               context.Context
 	logger            *zap.Logger
-	sem               *semaphore.Weighted
+	sem               Semaphore
 	encryptedRootPath string
 	decryptedRootPath string
 }
 
-func NewEncryptor(ctx context.Context, logger *zap.Logger, sem *semaphore.Weighted, encryptedRootPath string, decryptedRootPath string) *Encryptor {
+func NewEncryptor(ctx context.Context, logger *zap.Logger, sem Semaphore, encryptedRootPath string, decryptedRootPath string) *Encryptor {
 	if err := os.MkdirAll(encryptedRootPath, os.ModePerm); err != nil && !os.IsExist(err) {
 		logger.Fatal("FATAL %v", zap.Error(err))
 	}
@@ -43,7 +43,9 @@ func NewEncryptor(ctx context.Context, logger *zap.Logger, sem *semaphore.Weight
 	}
 }
 
-func (e *Encryptor) Encrypt(toEncrypt <-chan DTO) <-chan DTO {
+// Encrypt encrypts the files received from toEncrypt into the encrypted directory in spans of ctx, reporting the
+// bytes of a file encrypted so far to progress, which may be nil
+func (e *Encryptor) Encrypt(ctx context.Context, toEncrypt <-chan DTO, progress Progress) <-chan DTO {
 	resultStream := make(chan DTO)
 	go func() {
 		defer close(resultStream)
@@ -51,14 +53,24 @@ func (e *Encryptor) Encrypt(toEncrypt <-chan DTO) <-chan DTO {
 			select {
 			case <-e.ctx.Done():
 				return
-			case resultStream <- e.encryptFile(te):
+			case resultStream <- e.encryptFile(ctx, te, progress):
 			}
 		}
 	}()
 	return resultStream
 }
 
-func (e *Encryptor) encryptFile(toEncrypt DTO) DTO {
+func (e *Encryptor) encryptFile(ctx context.Context, toEncrypt DTO, progress Progress) (result DTO) {
+	if toEncrypt.Err() != nil {
+		e.logger.Warn("encryptFile: skipping, source has already an error", append(tracing.LogFields(ctx), zap.Error(toEncrypt.Err()))...)
+		return toEncrypt
+	}
+	ctx, span := tracing.Tracer().Start(ctx, string(StageEncrypt))
+	defer func() {
+		tracing.End(span, result.Err())
+	}()
+	logger := e.logger.With(tracing.LogFields(ctx)...)
+
 	// get and release local semaphore
 	semErr := e.sem.Acquire(e.ctx, 1)
 	defer func() {
@@ -67,27 +79,27 @@ func (e *Encryptor) encryptFile(toEncrypt DTO) DTO {
 		}
 	}()
 	if semErr != nil {
-		e.logger.Error("encryptFile: skipping, unable to obtain local semaphore")
+		logger.Error("encryptFile: skipping, unable to obtain local semaphore")
 		return NewDTOInstance(fmt.Errorf("error while encrypting: %v", errors.New("skipping, unable to obtain local semaphore")), "")
 	}
 
 	// start encryption process
-	plain, err := ioutil.ReadFile(toEncrypt.Content())
+	plain, err := readFile(toEncrypt.Content(), progress)
 	if err != nil {
-		e.logger.Error("encryptFile: error reading encrypted file", zap.Error(err))
+		logger.Error("encryptFile: error reading encrypted file", zap.Error(err))
 		return NewDTOInstance(fmt.Errorf("error while encrypting: %v", err), "")
 	}
 
 	key := []byte(passPhrase)
 	block, err := aes.NewCipher(key)
 	if err != nil {
-		e.logger.Error("encryptFile: error creating new cipher", zap.Error(err))
+		logger.Error("encryptFile: error creating new cipher", zap.Error(err))
 		return NewDTOInstance(fmt.Errorf("error while encrypting: %v", err), "")
 	}
 
 	gcm, err := cipher.NewGCM(block)
 	if err != nil {
-		e.logger.Error("encryptFile: error setting gcm", zap.Error(err))
+		logger.Error("encryptFile: error setting gcm", zap.Error(err))
 		return NewDTOInstance(fmt.Errorf("error while encrypting: %v", err), "")
 	}
 
@@ -95,7 +107,7 @@ func (e *Encryptor) encryptFile(toEncrypt DTO) DTO {
 	// because of the risk of repeat.
 	nonce := make([]byte, gcm.NonceSize())
 	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		e.logger.Error("encryptFile: error reading nonce", zap.Error(err))
+		logger.Error("encryptFile: error reading nonce", zap.Error(err))
 		return NewDTOInstance(fmt.Errorf("error while encrypting: %v", err), "")
 	}
 
@@ -104,42 +116,54 @@ func (e *Encryptor) encryptFile(toEncrypt DTO) DTO {
 	encryptedFilePath := path.Join(e.encryptedRootPath, strings.Replace(path.Base(toEncrypt.Content()), path.Ext(toEncrypt.Content()), "", -1))
 	err = ioutil.WriteFile(encryptedFilePath, ciphered, 0777)
 	if err != nil {
-		e.logger.Error("encryptFile: error writing encrypted content to file", zap.Error(err))
+		logger.Error("encryptFile: error writing encrypted content to file", zap.Error(err))
 		return NewDTOInstance(fmt.Errorf("error while encrypting: %v", err), "")
 	}
 	return NewDTOInstance(nil, encryptedFilePath)
 }
 
-func (e *Encryptor) DecryptFileAs(encryptedFilePath string, extension string) (string, error) {
-	key := []byte(passPhrase)
-	ciphered, err := ioutil.ReadFile(encryptedFilePath)
+// Verify decrypts the encrypted backup encryptedFilePath and reads the files of its zip, which checks their
+// checksums. It returns the number of files and their uncompressed size.
+func (e *Encryptor) Verify(encryptedFilePath string) (int, int64, error) {
+	zipPath, err := e.DecryptFileAs(encryptedFilePath, ".zip")
 	if err != nil {
-		e.logger.Error("decryptFileAs: error reading encrypted content", zap.Error(err))
-		return "", err
+		return 0, 0, fmt.Errorf("error decrypting: %w", err)
 	}
-
-	c, err := aes.NewCipher(key)
+	defer os.Remove(zipPath)
+	files, size, err := VerifyZip(zipPath)
 	if err != nil {
-		e.logger.Error("decryptFileAs: error creating new cipher", zap.Error(err))
-		return "", err
+		return files, size, fmt.Errorf("error verifying zip: %w", err)
 	}
+	return files, size, nil
+}
 
-	gcm, err := cipher.NewGCM(c)
+// readFile reads the file filePath, reporting the bytes read so far to progress, which may be nil
+func readFile(filePath string, progress Progress) ([]byte, error) {
+	if progress == nil {
+		return ioutil.ReadFile(filePath)
+	}
+	f, err := os.Open(filePath)
 	if err != nil {
-		e.logger.Error("decryptFileAs: error creating new cipher", zap.Error(err))
-		return "", err
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
 	}
+	return ioutil.ReadAll(newProgressCounter(progress, info.Size()).reader(f))
+}
 
-	nonceSize := gcm.NonceSize()
-	if len(ciphered) < nonceSize {
-		e.logger.Error("decryptFileAs: encrypted content does not satisfy the gcm nonceSize", zap.Error(err))
+func (e *Encryptor) DecryptFileAs(encryptedFilePath string, extension string) (string, error) {
+	ciphered, err := ioutil.ReadFile(encryptedFilePath)
+	if err != nil {
+		e.logger.Error("decryptFileAs: error reading encrypted content", zap.Error(err))
 		return "", err
 	}
 
-	nonce, ciphered := ciphered[:nonceSize], ciphered[nonceSize:]
-	plain, err := gcm.Open(nil, nonce, ciphered, nil)
+	plain, err := Decrypt([]byte(passPhrase), ciphered)
 	if err != nil {
-		e.logger.Error("decryptFileAs: error while opening encrypted content with gcm", zap.Error(err))
+		e.logger.Error("decryptFileAs: error decrypting content", zap.Error(err))
 		return "", err
 	}
 
@@ -152,3 +176,28 @@ func (e *Encryptor) DecryptFileAs(encryptedFilePath string, extension string) (s
 	}
 	return plainFilePath, nil
 }
+
+// Decrypt opens content encrypted by the Encryptor, the AES-GCM sealed content prefixed with its nonce, with key
+func Decrypt(key []byte, ciphered []byte) ([]byte, error) {
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cipher: %w", err)
+	}
+
+	gcm, err := cipher.NewGCM(c)
+	if err != nil {
+		return nil, fmt.Errorf("error creating gcm: %w", err)
+	}
+
+	nonceSize := gcm.NonceSize()
+	if len(ciphered) < nonceSize {
+		return nil, errors.New("encrypted content is shorter than the nonce")
+	}
+
+	nonce, ciphered := ciphered[:nonceSize], ciphered[nonceSize:]
+	plain, err := gcm.Open(nil, nonce, ciphered, nil)
+	if err != nil {
+		return nil, fmt.Errorf("wrong key or corrupted content: %w", err)
+	}
+	return plain, nil
+}
@@ -2,9 +2,16 @@ package app
 
 import (
 	"context"
+	"fmt"
 	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"regexp"
 )
 
+// legacyMonth matches the month directories of a backup collection, {year}/{month}/{day-time}
+var legacyMonth = regexp.MustCompile(`^[0-9]{2}$`)
+
 type FileSystemWrapper struct {
 	ctx        context.Context
 	logger     *zap.Logger
@@ -38,3 +45,103 @@ func (z *FileSystemWrapper) PathDecrypted() string {
 func (z *FileSystemWrapper) PathGSDownloads() string {
 	return z.workingDir + "/gsdownloads"
 }
+
+func (z *FileSystemWrapper) PathCatalog() string {
+	return z.workingDir + "/catalog.jsonl"
+}
+
+func (z *FileSystemWrapper) PathAudit() string {
+	return z.workingDir + "/audit.jsonl"
+}
+
+// MigrateLegacyBackups moves the collections of the backups made before clusters were introduced,
+// {backups}/{collection}/{year}/..., into the default cluster, {backups}/{defaultCluster}/{collection}/{year}/....
+// Directories of the clusters are left alone. A collection which exists in both places is merged, keeping the
+// files of the default cluster, e.g. its LATEST. It returns the migrated collections.
+func (z *FileSystemWrapper) MigrateLegacyBackups(defaultCluster string, clusters []string) ([]string, error) {
+	entries, err := os.ReadDir(z.PathBackups())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	skip := map[string]bool{defaultCluster: true}
+	for _, name := range clusters {
+		skip[name] = true
+	}
+
+	var migrated []string
+	for _, entry := range entries {
+		if !entry.IsDir() || skip[entry.Name()] || !legacyCollection(filepath.Join(z.PathBackups(), entry.Name())) {
+			continue
+		}
+		source := filepath.Join(z.PathBackups(), entry.Name())
+		target := filepath.Join(z.PathBackups(), defaultCluster, entry.Name())
+		if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+			return migrated, err
+		}
+		if err := mergeDir(source, target); err != nil {
+			return migrated, fmt.Errorf("error migrating %s: %w", source, err)
+		}
+		if err := os.RemoveAll(source); err != nil {
+			return migrated, err
+		}
+		z.logger.Info("MigrateLegacyBackups: moved collection into the default cluster", zap.String("source", source), zap.String("target", target))
+		migrated = append(migrated, entry.Name())
+	}
+	return migrated, nil
+}
+
+// legacyCollection returns true when dir holds backups as {year}/{month}/{day-time} itself. The collections of a
+// cluster hold them one level deeper.
+func legacyCollection(dir string) bool {
+	years, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, year := range years {
+		if !year.IsDir() || !legacyYear.MatchString(year.Name()) {
+			continue
+		}
+		months, err := os.ReadDir(filepath.Join(dir, year.Name()))
+		if err != nil {
+			continue
+		}
+		for _, month := range months {
+			if month.IsDir() && legacyMonth.MatchString(month.Name()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// mergeDir moves the entries of source into target, which is created when missing. Entries existing in both are
+// merged when they are directories, otherwise the ones of target are kept and the ones of source are dropped.
+func mergeDir(source string, target string) error {
+	if _, err := os.Lstat(target); os.IsNotExist(err) {
+		return os.Rename(source, target)
+	}
+	entries, err := os.ReadDir(source)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		s, t := filepath.Join(source, entry.Name()), filepath.Join(target, entry.Name())
+		info, err := os.Lstat(t)
+		switch {
+		case os.IsNotExist(err):
+			if err := os.Rename(s, t); err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		case entry.IsDir() && info.IsDir():
+			if err := mergeDir(s, t); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
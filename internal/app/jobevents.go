@@ -0,0 +1,106 @@
+package app
+
+import "time"
+
+// JobEventType is the kind of change of a job published to its subscribers
+type JobEventType string
+
+const (
+	// JobEventUpdated is published when the status, fraction completed or result of a job changed
+	JobEventUpdated JobEventType = "job"
+	// JobEventStage is published when a job moved to another stage of the pipeline
+	JobEventStage JobEventType = "stage"
+	// JobEventProgress is published while a stage of the pipeline processes the bytes of a backup
+	JobEventProgress JobEventType = "progress"
+)
+
+// progressInterval limits the progress events published per stage of a job
+const progressInterval = 500 * time.Millisecond
+
+// jobEventsBuffer is the number of events kept for a slow subscriber, further events are dropped for it
+const jobEventsBuffer = 64
+
+// JobEvent is a change of a job. Job is the snapshot after the change.
+type JobEvent struct {
+	Type     JobEventType   `json:"type"`
+	Job      Job            `json:"job"`
+	Progress *StageProgress `json:"progress,omitempty"`
+}
+
+// StageProgress is the number of bytes processed by a stage of the pipeline
+type StageProgress struct {
+	Stage JobStage `json:"stage"`
+	Bytes int64    `json:"bytes"`
+	// TotalBytes is the size of the input of the stage, 0 when unknown
+	TotalBytes int64 `json:"totalBytes"`
+}
+
+// Subscribe returns a snapshot of the job with the given id and the channel of its next events, which is closed
+// once the job finished or cancel is called. Events are dropped when the subscriber doesn't keep up, the final state
+// of the job is always available from Get.
+func (j *Jobs) Subscribe(id string) (job Job, events <-chan JobEvent, cancel func(), ok bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	current, ok := j.jobs[id]
+	if !ok {
+		return Job{}, nil, nil, false
+	}
+	ch := make(chan JobEvent, jobEventsBuffer)
+	if current.Finished() {
+		close(ch)
+		return *current, ch, func() {}, true
+	}
+
+	if j.subscribers[id] == nil {
+		j.subscribers[id] = make(map[chan JobEvent]struct{})
+	}
+	j.subscribers[id][ch] = struct{}{}
+	cancel = func() {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		if _, subscribed := j.subscribers[id][ch]; subscribed {
+			delete(j.subscribers[id], ch)
+			close(ch)
+		}
+	}
+	return *current, ch, cancel, true
+}
+
+// Progress returns the Progress publishing the bytes processed by the stage of the job with the given id, at most
+// every progressInterval. It returns nil without job id. The Progress is not safe for concurrent use.
+func (j *Jobs) Progress(id string, stage JobStage) Progress {
+	if id == "" {
+		return nil
+	}
+	var last time.Time
+	return func(done int64, total int64) {
+		if (total == 0 || done < total) && time.Since(last) < progressInterval {
+			return
+		}
+		last = time.Now()
+
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		job, ok := j.jobs[id]
+		if !ok || job.Finished() {
+			return
+		}
+		j.publish(JobEvent{Type: JobEventProgress, Job: *job, Progress: &StageProgress{Stage: stage, Bytes: done, TotalBytes: total}})
+	}
+}
+
+// publish sends event to the subscribers of its job, closing their channels once it finished. j.mu must be held.
+func (j *Jobs) publish(event JobEvent) {
+	for ch := range j.subscribers[event.Job.ID] {
+		select {
+		case ch <- event:
+		default:
+		}
+		if event.Job.Finished() {
+			close(ch)
+		}
+	}
+	if event.Job.Finished() {
+		delete(j.subscribers, event.Job.ID)
+	}
+}
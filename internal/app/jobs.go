@@ -0,0 +1,173 @@
+package app
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+)
+
+// JobStatus is the overall status of a job
+type JobStatus string
+
+const (
+	JobRunning   JobStatus = "running"
+	JobPaused    JobStatus = "paused"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+	JobCanceled  JobStatus = "canceled"
+)
+
+// JobKind is the kind of operation a job performs
+type JobKind string
+
+const (
+	JobBackup  JobKind = "backup"
+	JobRestore JobKind = "restore"
+	JobIngest  JobKind = "ingest"
+	JobVerify  JobKind = "verify"
+)
+
+// JobStage is the pipeline stage a job is currently in
+type JobStage string
+
+const (
+	StageBackup   JobStage = "backup"
+	StageRestore  JobStage = "restore"
+	StageIngest   JobStage = "ingest"
+	StageZip      JobStage = "zip"
+	StageEncrypt  JobStage = "encrypt"
+	StageUpload   JobStage = "upload"
+	StageDownload JobStage = "download"
+	StageVerify   JobStage = "verify"
+	StageDone     JobStage = "done"
+)
+
+// finishedJobsRetention is how long finished jobs are kept in memory
+const finishedJobsRetention = 7 * 24 * time.Hour
+
+// Job is a snapshot of a tracked job. Backup and Object are the processed backup directory inside the collection
+// and its encrypted object in the bucket, set by backup and ingest jobs.
+type Job struct {
+	ID                string    `json:"id"`
+	Kind              JobKind   `json:"kind"`
+	Cluster           string    `json:"cluster"`
+	Collection        string    `json:"collection"`
+	EngineJobID       int64     `json:"engineJobId,omitempty"`
+	Status            JobStatus `json:"status"`
+	Stage             JobStage  `json:"stage"`
+	FractionCompleted float64   `json:"fractionCompleted"`
+	Error             string    `json:"error,omitempty"`
+	Backup            string    `json:"backup,omitempty"`
+	Object            string    `json:"object,omitempty"`
+	CreatedAt         time.Time `json:"createdAt"`
+	UpdatedAt         time.Time `json:"updatedAt"`
+}
+
+// Finished returns true when the job can't change anymore
+func (j Job) Finished() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed || j.Status == JobCanceled
+}
+
+// Jobs keeps track of the jobs started by this service
+type Jobs struct {
+	mu          sync.RWMutex
+	jobs        map[string]*Job
+	subscribers map[string]map[chan JobEvent]struct{}
+}
+
+func NewJobs() *Jobs {
+	return &Jobs{
+		jobs:        make(map[string]*Job),
+		subscribers: make(map[string]map[chan JobEvent]struct{}),
+	}
+}
+
+// Create registers a new running job for the collection of the cluster and returns it
+func (j *Jobs) Create(kind JobKind, cluster string, collection string, engineJobID int64) Job {
+	now := time.Now().UTC()
+	stage := StageBackup
+	switch kind {
+	case JobRestore:
+		stage = StageRestore
+	case JobIngest:
+		stage = StageIngest
+	case JobVerify:
+		stage = StageDownload
+	}
+	job := &Job{
+		ID:          newJobID(),
+		Kind:        kind,
+		Cluster:     cluster,
+		Collection:  collection,
+		EngineJobID: engineJobID,
+		Status:      JobRunning,
+		Stage:       stage,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for id, existing := range j.jobs {
+		if existing.Finished() && now.Sub(existing.UpdatedAt) > finishedJobsRetention {
+			delete(j.jobs, id)
+		}
+	}
+	j.jobs[job.ID] = job
+	return *job
+}
+
+// Get returns a snapshot of the job with the given id
+func (j *Jobs) Get(id string) (Job, bool) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	job, ok := j.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// Update applies fn to the job with the given id and publishes the change to its subscribers, finished jobs are not
+// updated anymore
+func (j *Jobs) Update(id string, fn func(job *Job)) (Job, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job, ok := j.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	if !job.Finished() {
+		stage := job.Stage
+		fn(job)
+		job.UpdatedAt = time.Now().UTC()
+		eventType := JobEventUpdated
+		if job.Stage != stage {
+			eventType = JobEventStage
+		}
+		j.publish(JobEvent{Type: eventType, Job: *job})
+	}
+	return *job, true
+}
+
+// List returns snapshots of the jobs, the newest first
+func (j *Jobs) List() []Job {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	jobs := make([]Job, 0, len(j.jobs))
+	for _, job := range j.jobs {
+		jobs = append(jobs, *job)
+	}
+	sort.Slice(jobs, func(a, b int) bool {
+		return jobs[a].CreatedAt.After(jobs[b].CreatedAt)
+	})
+	return jobs
+}
+
+func newJobID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,57 @@
+package app
+
+import "io"
+
+// Progress receives the bytes processed by a stage of the pipeline out of its total bytes, total is 0 when unknown
+type Progress func(done int64, total int64)
+
+// progressCounter adds up the bytes processed by a stage and reports them to its Progress, which may be nil
+type progressCounter struct {
+	progress Progress
+	done     int64
+	total    int64
+}
+
+func newProgressCounter(progress Progress, total int64) *progressCounter {
+	return &progressCounter{progress: progress, total: total}
+}
+
+func (c *progressCounter) add(n int64) {
+	if c.progress == nil || n == 0 {
+		return
+	}
+	c.done += n
+	c.progress(c.done, c.total)
+}
+
+// writer returns w counting the bytes written through it
+func (c *progressCounter) writer(w io.Writer) io.Writer {
+	return &progressWriter{writer: w, counter: c}
+}
+
+// reader returns r counting the bytes read through it
+func (c *progressCounter) reader(r io.Reader) io.Reader {
+	return &progressReader{reader: r, counter: c}
+}
+
+type progressWriter struct {
+	writer  io.Writer
+	counter *progressCounter
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.counter.add(int64(n))
+	return n, err
+}
+
+type progressReader struct {
+	reader  io.Reader
+	counter *progressCounter
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.counter.add(int64(n))
+	return n, err
+}
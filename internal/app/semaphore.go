@@ -0,0 +1,12 @@
+package app
+
+import (
+	"context"
+)
+
+// Semaphore limits the concurrent use of the file system resources, it is implemented by semaphore.Weighted
+type Semaphore interface {
+	Acquire(ctx context.Context, n int64) error
+	TryAcquire(n int64) bool
+	Release(n int64)
+}
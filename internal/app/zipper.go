@@ -3,24 +3,31 @@ package app
 import (
 	"archive/zip"
 	"context"
+	"errors"
 	"fmt"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/cluster"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/tracing"
 	"go.uber.org/zap"
-	"golang.org/x/sync/semaphore"
 	"io"
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
 	"strings"
 )
 
+// legacyYear matches the year following the collection in the names of the objects made before clusters were
+// introduced
+var legacyYear = regexp.MustCompile(`^[0-9]{4}$`)
+
 type Zipper struct {
 	ctx               context.Context
 	logger            *zap.Logger
-	sem               *semaphore.Weighted
+	sem               Semaphore
 	fileSystemWrapper *FileSystemWrapper
 }
 
-func NewZipper(ctx context.Context, logger *zap.Logger, sem *semaphore.Weighted, fileSystemWrapper *FileSystemWrapper) *Zipper {
+func NewZipper(ctx context.Context, logger *zap.Logger, sem Semaphore, fileSystemWrapper *FileSystemWrapper) *Zipper {
 	if err := os.MkdirAll(fileSystemWrapper.PathZips(), os.ModePerm); err != nil && !os.IsExist(err) {
 		logger.Fatal("FATAL %v", zap.Error(err))
 	}
@@ -33,42 +40,85 @@ func NewZipper(ctx context.Context, logger *zap.Logger, sem *semaphore.Weighted,
 	}
 }
 
-func (z *Zipper) Zip(backupDirPath string) <-chan DTO {
+// ObjectCollection returns the cluster and the collection of the backup object or zip named
+// {cluster}_{collection}_{year}_..., empty names when it is not the name of a backup
+func ObjectCollection(name string) (string, string) {
+	clusterName, collection, _ := ObjectBackup(name)
+	return clusterName, collection
+}
+
+// ObjectBackup returns the cluster, the collection and the backup directory (e.g. /2022/01/24-163045.99) of the
+// backup object or zip named {cluster}_{collection}_{year}_{month}_{day-time}, empty names when it is not the name
+// of a backup. Objects made before clusters were introduced are named {collection}_{year}_{month}_{day-time}, they
+// are backups of the default cluster.
+func ObjectBackup(name string) (string, string, string) {
+	elements := strings.Split(strings.TrimSuffix(name, ".zip"), "_")
+	if len(elements) == 4 && legacyYear.MatchString(elements[1]) {
+		elements = append([]string{cluster.DefaultName}, elements...)
+	}
+	if len(elements) < 3 || elements[0] == "" || elements[1] == "" {
+		return "", "", ""
+	}
+	return elements[0], elements[1], "/" + strings.Join(elements[2:], "/")
+}
+
+// Zip zips backupDirPath into the zips directory in a span of ctx, reporting the bytes of the backup zipped so far
+// to progress, which may be nil
+func (z *Zipper) Zip(ctx context.Context, backupDirPath string, progress Progress) <-chan DTO {
 	resultStream := make(chan DTO)
 	go func() {
 		defer close(resultStream)
-		backupsSubPath := strings.Replace(backupDirPath, z.fileSystemWrapper.PathBackups(), "", -1)
-		fileName := strings.Replace(backupsSubPath[1:], "/", "_", -1) + ".zip"
-		zipFilePath := path.Join(z.fileSystemWrapper.PathZips(), fileName)
-
-		// get and release local semaphore
-		semErr := z.sem.Acquire(z.ctx, 1)
-		defer func() {
-			if semErr == nil {
-				z.sem.Release(1)
-			}
-		}()
-		if semErr != nil {
-			z.logger.Error("zip: skipping, unable to obtain local semaphore")
-			return
-		}
+		resultStream <- z.zip(ctx, backupDirPath, progress)
+	}()
+	return resultStream
+}
 
-		if err := z.zipSource(backupDirPath, zipFilePath); err != nil {
-			z.logger.Error("zip: error while creating zip file", zap.String("source", backupDirPath), zap.String("target", zipFilePath), zap.Error(err))
-			return
+func (z *Zipper) zip(ctx context.Context, backupDirPath string, progress Progress) (result DTO) {
+	ctx, span := tracing.Tracer().Start(ctx, string(StageZip))
+	defer func() {
+		tracing.End(span, result.Err())
+	}()
+	logger := z.logger.With(tracing.LogFields(ctx)...)
+
+	backupsSubPath := strings.Replace(backupDirPath, z.fileSystemWrapper.PathBackups(), "", -1)
+	fileName := strings.Replace(backupsSubPath[1:], "/", "_", -1) + ".zip"
+	zipFilePath := path.Join(z.fileSystemWrapper.PathZips(), fileName)
+
+	// get and release local semaphore
+	semErr := z.sem.Acquire(z.ctx, 1)
+	defer func() {
+		if semErr == nil {
+			z.sem.Release(1)
 		}
-		resultStream <- NewDTOInstance(nil, zipFilePath)
 	}()
-	return resultStream
+	if semErr != nil {
+		logger.Error("zip: skipping, unable to obtain local semaphore")
+		return NewDTOInstance(fmt.Errorf("error while zipping: %v", errors.New("skipping, unable to obtain local semaphore")), "")
+	}
+
+	if err := z.zipSource(logger, backupDirPath, zipFilePath, progress); err != nil {
+		logger.Error("zip: error while creating zip file", zap.String("source", backupDirPath), zap.String("target", zipFilePath), zap.Error(err))
+		return NewDTOInstance(fmt.Errorf("error while zipping: %v", err), "")
+	}
+	return NewDTOInstance(nil, zipFilePath)
 }
 
-func (z *Zipper) zipSource(source, target string) error {
+func (z *Zipper) zipSource(logger *zap.Logger, source, target string, progress Progress) error {
+	var total int64
+	if progress != nil {
+		var err error
+		if total, err = dirSize(source); err != nil {
+			return err
+		}
+	}
+	counter := newProgressCounter(progress, total)
+
 	// 1. Create a ZIP file and zip.Writer
 	f, crerr := os.Create(target)
 	defer func() {
 		if crerr == nil {
 			if cserr := f.Close(); cserr != nil {
-				z.logger.Error("zipSource: error closing target file", zap.String("target", target), zap.Error(cserr))
+				logger.Error("zipSource: error closing target file", zap.String("target", target), zap.Error(cserr))
 			}
 		}
 	}()
@@ -119,12 +169,32 @@ func (z *Zipper) zipSource(source, target string) error {
 		}
 		defer f.Close()
 
-		_, err = io.Copy(headerWriter, f)
+		_, err = io.Copy(counter.writer(headerWriter), f)
 		return err
 	})
 }
 
+// dirSize returns the size of the files in dir
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
 func (z *Zipper) UnzipSource(source, destination string) error {
+	return Unzip(source, destination)
+}
+
+// Unzip extracts the zip file source into destination, rejecting paths outside of it
+func Unzip(source, destination string) error {
 	// 1. Open the zip file
 	reader, err := zip.OpenReader(source)
 	if err != nil {
@@ -187,3 +257,35 @@ func unzipFile(f *zip.File, destination string) error {
 	}
 	return nil
 }
+
+// VerifyZip reads every file in the zip file source, which checks their checksums. It returns the number of files
+// and their uncompressed size.
+func VerifyZip(source string) (int, int64, error) {
+	reader, err := zip.OpenReader(source)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer reader.Close()
+
+	files, size := 0, int64(0)
+	for _, f := range reader.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return files, size, fmt.Errorf("error opening %s: %w", f.Name, err)
+		}
+		n, err := io.Copy(io.Discard, rc)
+		rc.Close()
+		if err != nil {
+			return files, size, fmt.Errorf("error reading %s: %w", f.Name, err)
+		}
+		files++
+		size += n
+	}
+	if files == 0 {
+		return 0, 0, errors.New("zip file has no files")
+	}
+	return files, size, nil
+}
@@ -0,0 +1,30 @@
+package audit
+
+import (
+	"errors"
+	"net/url"
+)
+
+type Config struct {
+	// SyslogNetwork and SyslogAddress of a syslog server receiving a copy of the records, e.g. udp and
+	// logs.local:514. The local syslog daemon when only SyslogNetwork is set to unixgram.
+	SyslogNetwork string
+	SyslogAddress string
+	// HTTPSinkURL receives a copy of every record as JSON POST request
+	HTTPSinkURL string
+	// HTTPSinkToken is sent as bearer token to HTTPSinkURL
+	HTTPSinkToken string
+}
+
+func (c Config) Assert() error {
+	if c.SyslogAddress != "" && c.SyslogNetwork == "" {
+		return errors.New("c.SyslogNetwork is required with c.SyslogAddress")
+	}
+	if c.HTTPSinkURL != "" {
+		u, err := url.Parse(c.HTTPSinkURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("c.HTTPSinkURL must be an absolute http or https URL")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// maxRecordSize limits the size of a single line of the audit log when reading it
+const maxRecordSize = 1 << 20
+
+// Record is an entry of the audit log
+type Record struct {
+	// Seq is the position of the record in the log, starting at 1
+	Seq        int64               `json:"seq"`
+	Time       time.Time           `json:"time"`
+	Actor      string              `json:"actor"`
+	RemoteAddr string              `json:"remoteAddr"`
+	Method     string              `json:"method"`
+	Endpoint   string              `json:"endpoint"`
+	Params     map[string][]string `json:"params,omitempty"`
+	// Status is the HTTP status of the response, or its equivalent for the gRPC calls
+	Status int `json:"status"`
+	// Result is succeeded, failed or denied
+	Result     string `json:"result"`
+	DurationMs int64  `json:"durationMs"`
+	// TraceID of the request, to find its spans
+	TraceID string `json:"traceId,omitempty"`
+	// RequestID of the request, as returned to the caller in X-Request-Id
+	RequestID string `json:"requestId,omitempty"`
+	// PrevHash is the Hash of the previous record, empty for the first one
+	PrevHash string `json:"prevHash"`
+	// Hash is the SHA-256 of PrevHash and the record without Hash, chaining all records
+	Hash string `json:"hash"`
+}
+
+// Results of the audited requests
+const (
+	ResultSucceeded = "succeeded"
+	ResultFailed    = "failed"
+	ResultDenied    = "denied"
+)
+
+// hash returns the hash of the record chained to PrevHash
+func (r Record) hash() string {
+	r.Hash = ""
+	content, _ := json.Marshal(r)
+	sum := sha256.Sum256(append([]byte(r.PrevHash), content...))
+	return hex.EncodeToString(sum[:])
+}
+
+// Sink receives a copy of every record, e.g. to keep it out of reach of whoever can change the working dir
+type Sink interface {
+	Send(record Record) error
+}
+
+// Log is an append-only JSON lines file of hash chained records. Changing or removing a record breaks the chain,
+// which is detected by Verify.
+type Log struct {
+	logger   *zap.Logger
+	mu       sync.Mutex
+	filePath string
+	seq      int64
+	lastHash string
+	sinks    []Sink
+}
+
+// NewLog opens the audit log in filePath, continuing its chain, and verifies it
+func NewLog(logger *zap.Logger, filePath string, sinks ...Sink) (*Log, error) {
+	l := &Log{
+		logger:   logger,
+		filePath: filePath,
+		sinks:    sinks,
+	}
+	last, err := l.walk(func(Record) bool { return true })
+	var chainErr *ChainError
+	if errors.As(err, &chainErr) {
+		// a broken chain is reported, but auditing continues after the last record so the break stays visible
+		logger.Error("NewLog: audit log verification failed", zap.String("auditLog", filePath), zap.Error(err))
+	} else if err != nil {
+		return nil, err
+	}
+	l.seq, l.lastHash = last.Seq, last.Hash
+	return l, nil
+}
+
+// Append completes record with its position and hash, writes it to the log and sends it to the sinks
+func (l *Log) Append(record Record) error {
+	if record.Time.IsZero() {
+		record.Time = time.Now().UTC()
+	}
+
+	l.mu.Lock()
+	record.Seq = l.seq + 1
+	record.PrevHash = l.lastHash
+	record.Hash = record.hash()
+	line, err := json.Marshal(record)
+	if err != nil {
+		l.mu.Unlock()
+		return err
+	}
+	if err := l.write(append(line, '\n')); err != nil {
+		l.mu.Unlock()
+		l.logger.Error("Append: error writing audit record", zap.String("auditLog", l.filePath), zap.Error(err))
+		return err
+	}
+	l.seq, l.lastHash = record.Seq, record.Hash
+	l.mu.Unlock()
+
+	for _, sink := range l.sinks {
+		if err := sink.Send(record); err != nil {
+			l.logger.Warn("Append: error sending audit record", zap.Int64("seq", record.Seq), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// write appends line to the log file, l.mu must be held
+func (l *Log) write(line []byte) error {
+	f, err := os.OpenFile(l.filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(line); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Query returns the records accepted by filter in the order they were appended, and an error when the chain
+// is broken
+func (l *Log) Query(filter func(Record) bool) ([]Record, error) {
+	var records []Record
+	_, err := l.walk(func(record Record) bool {
+		if filter == nil || filter(record) {
+			records = append(records, record)
+		}
+		return true
+	})
+	return records, err
+}
+
+// Verify checks the chain of all records in the log
+func (l *Log) Verify() error {
+	_, err := l.walk(func(Record) bool { return true })
+	return err
+}
+
+// ChainError is returned when the chain of records is broken, because records were modified, removed or reordered
+type ChainError struct {
+	// Seq of the first record where the chain is broken
+	Seq    int64
+	Reason string
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("chain broken at seq %d: %s", e.Seq, e.Reason)
+}
+
+// walk verifies the chain while passing every record to fn until it returns false. It returns the last record
+// and a ChainError for the first break in the chain, records after a break are still walked. The records appended
+// after the walk started are not walked, so Append is not blocked while the log is read.
+func (l *Log) walk(fn func(Record) bool) (Record, error) {
+	f, size, err := l.open()
+	if os.IsNotExist(err) {
+		return Record{}, nil
+	} else if err != nil {
+		return Record{}, err
+	}
+	defer f.Close()
+
+	var last Record
+	var chainErr *ChainError
+	broken := func(seq int64, reason string) {
+		if chainErr == nil {
+			chainErr = &ChainError{Seq: seq, Reason: reason}
+		}
+	}
+	scanner := bufio.NewScanner(io.LimitReader(f, size))
+	scanner.Buffer(make([]byte, 64*1024), maxRecordSize)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			broken(last.Seq+1, "invalid record")
+			continue
+		}
+		switch {
+		case record.Seq != last.Seq+1 || record.PrevHash != last.Hash:
+			broken(record.Seq, "records missing or out of order")
+		case record.Hash != record.hash():
+			broken(record.Seq, "record was modified")
+		}
+		last = record
+		if !fn(record) {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return last, err
+	}
+	if chainErr != nil {
+		return last, chainErr
+	}
+	return last, nil
+}
+
+// open opens the log file for reading and returns its size, which ends with the last complete record since records
+// are appended while l.mu is held
+func (l *Log) open() (*os.File, int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, err := os.Open(l.filePath)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, 0, err
+	}
+	return f, info.Size(), nil
+}
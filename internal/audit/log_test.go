@@ -0,0 +1,163 @@
+package audit
+
+import (
+	"errors"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testLog returns a log with the records of three requests
+func testLog(t *testing.T) (*Log, string) {
+	filePath := filepath.Join(t.TempDir(), "audit.jsonl")
+	l, err := NewLog(zap.NewNop(), filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, endpoint := range []string{"/clusters/default/backup/payments", "/jobs/1/cancel", "/ingest/etcd"} {
+		if err := l.Append(Record{Actor: "admin", Method: "POST", Endpoint: endpoint, Status: 200, Result: ResultSucceeded}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return l, filePath
+}
+
+func readLines(t *testing.T, filePath string) []string {
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+}
+
+func writeLines(t *testing.T, filePath string, lines []string) {
+	if err := ioutil.WriteFile(filePath, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLogVerify(t *testing.T) {
+	l, _ := testLog(t)
+	if err := l.Verify(); err != nil {
+		t.Fatalf("Verify of an intact log returned %v", err)
+	}
+	records, err := l.Query(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, record := range records {
+		if record.Seq != int64(i+1) {
+			t.Errorf("seq of record %d is %d", i, record.Seq)
+		}
+	}
+}
+
+func TestLogVerifyTampered(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(lines []string) []string
+		seq    int64
+		reason string
+	}{
+		{
+			name: "modified record",
+			tamper: func(lines []string) []string {
+				lines[1] = strings.Replace(lines[1], `"actor":"admin"`, `"actor":"someone"`, 1)
+				return lines
+			},
+			seq:    2,
+			reason: "record was modified",
+		},
+		{
+			name: "removed record",
+			tamper: func(lines []string) []string {
+				return append(lines[:1], lines[2:]...)
+			},
+			seq:    3,
+			reason: "records missing or out of order",
+		},
+		{
+			name: "reordered records",
+			tamper: func(lines []string) []string {
+				lines[1], lines[2] = lines[2], lines[1]
+				return lines
+			},
+			seq:    3,
+			reason: "records missing or out of order",
+		},
+		{
+			name: "invalid record",
+			tamper: func(lines []string) []string {
+				lines[0] = "{"
+				return lines
+			},
+			seq:    1,
+			reason: "invalid record",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, filePath := testLog(t)
+			writeLines(t, filePath, tt.tamper(readLines(t, filePath)))
+
+			var chainErr *ChainError
+			if err := l.Verify(); !errors.As(err, &chainErr) {
+				t.Fatalf("Verify returned %v, want a ChainError", err)
+			}
+			if chainErr.Seq != tt.seq || chainErr.Reason != tt.reason {
+				t.Errorf("chain broken at seq %d: %s, want seq %d: %s", chainErr.Seq, chainErr.Reason, tt.seq, tt.reason)
+			}
+
+			// the records are still returned with the break
+			records, err := l.Query(nil)
+			if !errors.As(err, &chainErr) {
+				t.Errorf("Query returned %v, want a ChainError", err)
+			}
+			if len(records) == 0 {
+				t.Error("Query returned no records")
+			}
+		})
+	}
+}
+
+func TestNewLogContinuesChain(t *testing.T) {
+	_, filePath := testLog(t)
+	l, err := NewLog(zap.NewNop(), filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Append(Record{Actor: "admin", Method: "GET", Endpoint: "/backups/default/payments", Status: 200, Result: ResultSucceeded}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Verify(); err != nil {
+		t.Fatalf("Verify after reopening returned %v", err)
+	}
+	if lines := readLines(t, filePath); len(lines) != 4 {
+		t.Errorf("log has %d records, want 4", len(lines))
+	}
+}
+
+func TestLogAppendWhileWalking(t *testing.T) {
+	l, _ := testLog(t)
+	// the records appended while the log is read are not walked, appending does not wait for the walk
+	records, err := l.Query(func(record Record) bool {
+		if err := l.Append(Record{Actor: "admin", Method: "GET", Endpoint: "/audit", Status: 200, Result: ResultSucceeded}); err != nil {
+			t.Fatal(err)
+		}
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Errorf("Query returned %d records, want the 3 records of the log when it started", len(records))
+	}
+	if err := l.Verify(); err != nil {
+		t.Fatalf("Verify returned %v", err)
+	}
+	if records, _ := l.Query(nil); len(records) != 6 {
+		t.Errorf("log has %d records, want 6", len(records))
+	}
+}
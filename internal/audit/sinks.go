@@ -0,0 +1,95 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go.uber.org/zap"
+	"log/syslog"
+	"net/http"
+	"time"
+)
+
+// sinkQueueSize is the number of records buffered per sink, records are dropped when a sink can't keep up
+const sinkQueueSize = 1000
+
+// httpSinkTimeout limits the time to deliver a record to the HTTP sink
+const httpSinkTimeout = 5 * time.Second
+
+// NewSinks returns the sinks configured in config. The sinks deliver the records in the background until ctx
+// is done.
+func NewSinks(ctx context.Context, logger *zap.Logger, config Config) ([]Sink, error) {
+	var sinks []Sink
+	if config.SyslogNetwork != "" {
+		writer, err := syslog.Dial(config.SyslogNetwork, config.SyslogAddress, syslog.LOG_INFO|syslog.LOG_AUTH, "backupsmanager")
+		if err != nil {
+			return nil, fmt.Errorf("error connecting to syslog: %w", err)
+		}
+		sinks = append(sinks, newQueuedSink(ctx, logger, "syslog", func(_ context.Context, content []byte) error {
+			return writer.Info(string(content))
+		}))
+	}
+	if config.HTTPSinkURL != "" {
+		client := &http.Client{Timeout: httpSinkTimeout}
+		sinks = append(sinks, newQueuedSink(ctx, logger, "http", func(ctx context.Context, content []byte) error {
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.HTTPSinkURL, bytes.NewReader(content))
+			if err != nil {
+				return err
+			}
+			req.Header.Set("Content-Type", "application/json")
+			if config.HTTPSinkToken != "" {
+				req.Header.Set("Authorization", "Bearer "+config.HTTPSinkToken)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				return err
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				return fmt.Errorf("unexpected status %d", resp.StatusCode)
+			}
+			return nil
+		}))
+	}
+	return sinks, nil
+}
+
+// queuedSink delivers records in the background, so a slow sink does not delay the requests
+type queuedSink struct {
+	logger *zap.Logger
+	name   string
+	queue  chan Record
+}
+
+func newQueuedSink(ctx context.Context, logger *zap.Logger, name string, deliver func(ctx context.Context, content []byte) error) *queuedSink {
+	s := &queuedSink{
+		logger: logger,
+		name:   name,
+		queue:  make(chan Record, sinkQueueSize),
+	}
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case record := <-s.queue:
+				content, _ := json.Marshal(record)
+				if err := deliver(ctx, content); err != nil {
+					s.logger.Error("queuedSink: error delivering audit record", zap.String("sink", s.name), zap.Int64("seq", record.Seq), zap.Error(err))
+				}
+			}
+		}
+	}()
+	return s
+}
+
+// Send queues record for delivery
+func (s *queuedSink) Send(record Record) error {
+	select {
+	case s.queue <- record:
+		return nil
+	default:
+		return fmt.Errorf("queue of sink %s is full, record dropped", s.name)
+	}
+}
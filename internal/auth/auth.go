@@ -0,0 +1,198 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// hashSize is the size of the token hashes
+const hashSize = sha256.Size
+
+// probesPath is never authenticated, so the orchestrator can always reach the probes
+const probesPath = "/probes/"
+
+// uiPath is never authenticated, the static files of the web UI carry no data and the UI calls the API with the
+// token entered by the user
+const uiPath = "/ui/"
+
+type contextKey struct{}
+
+// anonymous is the identity of requests when authentication is disabled
+var anonymous = Identity{Name: "anonymous", Unrestricted: true}
+
+// unauthenticated is the identity of requests on the paths which don't require a bearer token. It has no role, so
+// these requests are only let through by the routes which don't need one, e.g. WebDAV with the credentials of a
+// cluster.
+var unauthenticated = Identity{Name: "anonymous", Unauthenticated: true}
+
+// Identity is the caller of a request
+type Identity struct {
+	// Name of the token used by the caller
+	Name string
+	// Roles of the token
+	Roles []string
+	// Collections patterns limiting the token, see Token.Collections
+	Collections []string
+	// Unrestricted is set when the request was not authenticated because authentication is disabled
+	Unrestricted bool
+	// Unauthenticated is set when the request was not authenticated because its path doesn't require it
+	Unauthenticated bool
+}
+
+// FromContext returns the identity of the authenticated caller of a request
+func FromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(contextKey{}).(Identity)
+	return identity, ok
+}
+
+// token is an accepted bearer token, only its hash is kept in memory
+type token struct {
+	Name        string   `json:"name"`
+	SHA256      string   `json:"sha256"`
+	Roles       []string `json:"roles"`
+	Collections []string `json:"collections"`
+	hash        []byte
+}
+
+// Authenticator authenticates requests with bearer tokens
+type Authenticator struct {
+	logger      *zap.Logger
+	enabled     bool
+	tokens      []token
+	exceptPaths []string
+}
+
+// NewAuthenticator returns the Authenticator of the tokens in config and its TokensFile
+func NewAuthenticator(logger *zap.Logger, config Config) (*Authenticator, error) {
+	a := &Authenticator{
+		logger:      logger,
+		enabled:     config.Enabled,
+		exceptPaths: config.ExceptPaths,
+	}
+	if !config.Enabled {
+		return a, nil
+	}
+
+	tokens := make([]token, 0, len(config.Tokens))
+	for name, t := range config.Tokens {
+		tokens = append(tokens, token{Name: name, SHA256: t.SHA256, Roles: t.Roles, Collections: t.Collections})
+	}
+	if config.TokensFile != "" {
+		fileTokens, err := readTokensFile(config.TokensFile)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, fileTokens...)
+	}
+
+	names := make(map[string]bool, len(tokens))
+	for i := range tokens {
+		if tokens[i].Name == "" || names[tokens[i].Name] {
+			return nil, fmt.Errorf("token name %q is empty or not unique", tokens[i].Name)
+		}
+		names[tokens[i].Name] = true
+		if err := (Token{SHA256: tokens[i].SHA256, Roles: tokens[i].Roles, Collections: tokens[i].Collections}).Assert(); err != nil {
+			return nil, fmt.Errorf("%w for token %s", err, tokens[i].Name)
+		}
+		tokens[i].hash, _ = hex.DecodeString(tokens[i].SHA256)
+	}
+	a.tokens = tokens
+	return a, nil
+}
+
+// readTokensFile reads the JSON list of tokens in filePath
+func readTokensFile(filePath string) ([]token, error) {
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading tokens file: %w", err)
+	}
+	var tokens []token
+	if err := json.Unmarshal(content, &tokens); err != nil {
+		return nil, fmt.Errorf("error parsing tokens file: %w", err)
+	}
+	return tokens, nil
+}
+
+// Middleware rejects requests without a valid bearer token, and adds the Identity of the caller to the context
+// of the accepted ones. The rejected requests are answered by unauthorized, e.g. with the error model of the API.
+func (a *Authenticator) Middleware(next http.Handler, unauthorized http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.enabled {
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), anonymous)))
+			return
+		}
+		if a.excepted(r.URL.Path) {
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), unauthenticated)))
+			return
+		}
+
+		identity, ok := a.authenticate(r)
+		if !ok {
+			a.logger.Warn("Middleware: unauthenticated request", zap.String("path", r.URL.Path), zap.String("remoteAddr", r.RemoteAddr))
+			w.Header().Set("WWW-Authenticate", `Bearer realm="backupsmanager"`)
+			unauthorized.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), identity)))
+	})
+}
+
+// excepted returns true when path does not require a bearer token
+func (a *Authenticator) excepted(path string) bool {
+	if strings.HasPrefix(path, probesPath) || strings.HasPrefix(path, uiPath) {
+		return true
+	}
+	for _, prefix := range a.exceptPaths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticate returns the Identity of the caller with the given Authorization header value, for the requests
+// which don't come through Middleware, e.g. gRPC calls
+func (a *Authenticator) Authenticate(header string) (Identity, bool) {
+	if !a.enabled {
+		return anonymous, true
+	}
+	return a.authenticateHeader(header)
+}
+
+// NewContext returns ctx with the identity of the caller
+func NewContext(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, identity)
+}
+
+// authenticate returns the Identity of the bearer token of r
+func (a *Authenticator) authenticate(r *http.Request) (Identity, bool) {
+	return a.authenticateHeader(r.Header.Get("Authorization"))
+}
+
+// authenticateHeader returns the Identity of the bearer token in the Authorization header value
+func (a *Authenticator) authenticateHeader(header string) (Identity, bool) {
+	const prefix = "Bearer "
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return Identity{}, false
+	}
+	hash := sha256.Sum256([]byte(strings.TrimSpace(header[len(prefix):])))
+
+	// all tokens are compared in constant time, so the timing does not reveal which one matched
+	var identity Identity
+	found := false
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare(hash[:], t.hash) == 1 {
+			identity = Identity{Name: t.Name, Roles: t.Roles, Collections: t.Collections}
+			found = true
+		}
+	}
+	return identity, found
+}
@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type Config struct {
+	// Enabled requires a bearer token on every request, except for the probes and the ExceptPaths
+	Enabled bool
+	// Tokens are the accepted bearer tokens by name
+	Tokens map[string]Token
+	// TokensFile is an optional JSON file with more tokens:
+	// [{"name": "ci", "sha256": "...", "roles": ["operator"], "collections": ["payments-prod/*"]}]
+	TokensFile string
+	// ExceptPaths are path prefixes which don't require a bearer token, e.g. /backups/ when the WebDAV client of
+	// CRDB authenticates with the credentials in the BACKUP INTO URL. Their requests have no role, they only reach
+	// WebDAV with the credentials of a cluster and the routes without collection data, /metrics and /openapi.json.
+	ExceptPaths []string
+}
+
+func (c Config) Assert() error {
+	if !c.Enabled {
+		return nil
+	}
+	if len(c.Tokens) == 0 && c.TokensFile == "" {
+		return errors.New("c.Tokens or c.TokensFile should be defined when enabled")
+	}
+	for name, token := range c.Tokens {
+		if err := token.Assert(); err != nil {
+			return fmt.Errorf("%w for token %s", err, name)
+		}
+	}
+	for _, prefix := range c.ExceptPaths {
+		if !strings.HasPrefix(prefix, "/") {
+			return fmt.Errorf("except path %q should start with a slash", prefix)
+		}
+	}
+	return nil
+}
+
+// Token is an accepted bearer token, only its hash is configured
+type Token struct {
+	// SHA256 is the hex encoded SHA-256 hash of the token
+	SHA256 string
+	// Roles of the token: reader, operator, restorer and/or admin
+	Roles []string
+	// Collections limits the token to the collections matching these {cluster}/{collection} patterns, e.g.
+	// payments-prod/* or */payments-api. All collections when empty.
+	Collections []string
+}
+
+func (t Token) Assert() error {
+	if err := assertHash(t.SHA256); err != nil {
+		return err
+	}
+	return assertRoles(t.Roles, t.Collections)
+}
+
+// assertHash validates a hex encoded SHA-256 hash
+func assertHash(hash string) error {
+	b, err := hex.DecodeString(hash)
+	if err != nil || len(b) != hashSize {
+		return errors.New("invalid SHA-256 hash")
+	}
+	return nil
+}
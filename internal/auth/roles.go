@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Roles of the tokens. Every role may read, the admin role may perform every action.
+const (
+	RoleReader   = "reader"
+	RoleOperator = "operator"
+	RoleRestorer = "restorer"
+	RoleAdmin    = "admin"
+)
+
+// Action is an operation on the backups which is authorized by the roles of the caller
+type Action string
+
+const (
+	// ActionRead lists, downloads and verifies backups and follows jobs
+	ActionRead Action = "read"
+	// ActionBackup triggers and controls backups and writes backups through WebDAV
+	ActionBackup Action = "backup"
+	// ActionRestore gets backups from the bucket and triggers and controls restores
+	ActionRestore Action = "restore"
+	// ActionAdmin manages the retention and the encryption keys
+	ActionAdmin Action = "admin"
+)
+
+// roleActions are the actions allowed per role
+var roleActions = map[string][]Action{
+	RoleReader:   {ActionRead},
+	RoleOperator: {ActionRead, ActionBackup},
+	RoleRestorer: {ActionRead, ActionRestore},
+	RoleAdmin:    {ActionRead, ActionBackup, ActionRestore, ActionAdmin},
+}
+
+// assertRoles validates the roles and collection patterns of a token
+func assertRoles(roles []string, collections []string) error {
+	if len(roles) == 0 {
+		return fmt.Errorf("at least one role is required")
+	}
+	for _, role := range roles {
+		if _, ok := roleActions[role]; !ok {
+			return fmt.Errorf("unknown role %q", role)
+		}
+	}
+	for _, pattern := range collections {
+		elements := strings.Split(pattern, "/")
+		if len(elements) != 2 {
+			return fmt.Errorf("collection %q should be {cluster}/{collection}", pattern)
+		}
+		for _, element := range elements {
+			if _, err := path.Match(element, ""); err != nil {
+				return fmt.Errorf("collection %q is an invalid pattern", pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// Allowed returns true if the identity may perform action on the collection of the cluster. An empty collection
+// is an action on the cluster itself, which is allowed when any collection of the cluster is in scope.
+func (i Identity) Allowed(action Action, cluster string, collection string) bool {
+	if i.Unrestricted {
+		return true
+	}
+	return i.allowedAction(action) && i.InScope(cluster, collection)
+}
+
+func (i Identity) allowedAction(action Action) bool {
+	for _, role := range i.Roles {
+		for _, allowed := range roleActions[role] {
+			if allowed == action {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// InScope returns true if the collection of the cluster matches one of the collection patterns of the identity,
+// identities without patterns have all collections in scope. An empty cluster or collection is an action on the
+// service or on the cluster, in scope when any of its collections is. Unauthenticated identities have no collection
+// in scope.
+func (i Identity) InScope(cluster string, collection string) bool {
+	if i.Unauthenticated {
+		return false
+	}
+	if i.Unrestricted || len(i.Collections) == 0 {
+		return true
+	}
+	for _, pattern := range i.Collections {
+		elements := strings.SplitN(pattern, "/", 2)
+		if len(elements) != 2 {
+			continue
+		}
+		if (cluster == "" || matches(elements[0], cluster)) && (collection == "" || matches(elements[1], collection)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Covers returns true if all the collections of the cluster are in scope, or all the collections of all the
+// clusters when cluster is empty
+func (i Identity) Covers(cluster string) bool {
+	if i.Unauthenticated {
+		return false
+	}
+	if i.Unrestricted || len(i.Collections) == 0 {
+		return true
+	}
+	for _, pattern := range i.Collections {
+		elements := strings.SplitN(pattern, "/", 2)
+		if len(elements) != 2 || elements[1] != "*" {
+			continue
+		}
+		if elements[0] == "*" || matches(elements[0], cluster) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches returns true if name matches pattern, an empty name matches no pattern
+func matches(pattern string, name string) bool {
+	if name == "" {
+		return false
+	}
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
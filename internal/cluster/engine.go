@@ -0,0 +1,128 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Engine names as used in the Engine convar of a cluster
+const (
+	EngineCRDB     = "crdb"
+	EnginePostgres = "postgres"
+	EngineMySQL    = "mysql"
+)
+
+// Job statuses reported by the engines, these match the statuses of CRDB jobs
+const (
+	JobStatusPending   = "pending"
+	JobStatusRunning   = "running"
+	JobStatusPaused    = "paused"
+	JobStatusSucceeded = "succeeded"
+	JobStatusFailed    = "failed"
+	JobStatusCanceled  = "canceled"
+)
+
+// ErrNotSupported is returned for job operations an engine does not support
+var ErrNotSupported = errors.New("operation not supported by this engine")
+
+// Engine backs up and restores a database cluster. Backups are written as collections in the backups
+// directory: {collection}/{year}/{month}/{day-time}/data/..., with a LATEST file pointing to the last one.
+type Engine interface {
+	// Name returns the engine name, e.g. EngineCRDB
+	Name() string
+	// Ping checks the connection with the cluster
+	Ping(ctx context.Context) error
+	// StartBackup starts a backup into collection with the engine specific JSON options, which may be empty
+	StartBackup(collection string, options []byte) (JobRef, error)
+	// StartRestore starts a restore of the backup subdir of collection with the engine specific JSON options.
+	// An empty subdir restores the LATEST backup.
+	StartRestore(collection string, subdir string, options []byte) (JobRef, error)
+	// Job returns the current status of the job with the given id
+	Job(ctx context.Context, jobID int64) (JobStatus, error)
+	// WaitForJob polls the job with the given id every interval until it is finished or ctx is done
+	WaitForJob(ctx context.Context, jobID int64, interval time.Duration, onProgress func(JobStatus)) (JobStatus, error)
+	// PauseJob pauses the job with the given id
+	PauseJob(ctx context.Context, jobID int64) error
+	// ResumeJob resumes the paused job with the given id
+	ResumeJob(ctx context.Context, jobID int64) error
+	// CancelJob cancels the job with the given id
+	CancelJob(ctx context.Context, jobID int64) error
+}
+
+// JobRef references a job started by an engine
+type JobRef struct {
+	// ID of the job in the engine
+	ID int64
+	// Detached is true when the job is still running, otherwise it already finished successfully
+	Detached bool
+}
+
+// JobStatus is the progress of a job in an engine
+type JobStatus struct {
+	ID                int64
+	Status            string
+	FractionCompleted float64
+	Error             string
+}
+
+// Finished returns true when the job reached a terminal status
+func (s JobStatus) Finished() bool {
+	return s.Status == JobStatusSucceeded || s.Status == JobStatusFailed || s.Status == JobStatusCanceled
+}
+
+// OptionsError is returned when the options given to an engine are invalid
+type OptionsError struct {
+	Err error
+}
+
+func (e *OptionsError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *OptionsError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeOptions decodes the JSON options given to an engine into v, empty options leave v untouched
+func DecodeOptions(options []byte, v interface{}) error {
+	if len(bytes.TrimSpace(options)) == 0 {
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(options))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return &OptionsError{Err: err}
+	}
+	return nil
+}
+
+// WaitForJob implements Engine.WaitForJob for engines with a Job method
+func WaitForJob(ctx context.Context, engine Engine, jobID int64, interval time.Duration, onProgress func(JobStatus)) (JobStatus, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		status, err := engine.Job(ctx, jobID)
+		if err != nil {
+			return JobStatus{}, err
+		}
+		onProgress(status)
+		if status.Finished() {
+			return status, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return status, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// BackupDirName returns the name of a backup directory started at t, in the same format CRDB uses
+// (/2022/01/24-163045.99)
+func BackupDirName(t time.Time) string {
+	return t.UTC().Format("/2006/01/02-150405.00")
+}
@@ -0,0 +1,117 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// finishedJobsRetention is how long finished local jobs are kept, long enough for their followers to read the outcome
+const finishedJobsRetention = 24 * time.Hour
+
+// validBackupDirName matches backup directory names as returned by BackupDirName
+var validBackupDirName = regexp.MustCompile(`^/\d{4}/\d{2}/\d{2}-\d{6}\.\d{2}$`)
+
+// ValidBackupDirName returns true if subdir is a backup directory name as returned by BackupDirName
+func ValidBackupDirName(subdir string) bool {
+	return validBackupDirName.MatchString(subdir)
+}
+
+// ToolPath returns the path of a client tool in toolsDir, or just its name to look it up in the PATH
+func ToolPath(toolsDir string, tool string) string {
+	if toolsDir == "" {
+		return tool
+	}
+	return filepath.Join(toolsDir, tool)
+}
+
+// LocalJobs keeps track of jobs running in this process, for engines that back up by running client
+// tools instead of server side jobs
+type LocalJobs struct {
+	ctx    context.Context
+	mu     sync.Mutex
+	nextID int64
+	jobs   map[int64]*localJob
+}
+
+type localJob struct {
+	status     JobStatus
+	cancel     context.CancelFunc
+	finishedAt time.Time
+}
+
+func NewLocalJobs(ctx context.Context) *LocalJobs {
+	return &LocalJobs{
+		ctx:  ctx,
+		jobs: make(map[int64]*localJob),
+	}
+}
+
+// Start runs fn in the background as a new job and returns its id
+func (l *LocalJobs) Start(fn func(ctx context.Context) error) int64 {
+	ctx, cancel := context.WithCancel(l.ctx)
+
+	l.mu.Lock()
+	// drop the old finished jobs, so they don't pile up for the life of the process
+	now := time.Now()
+	for id, existing := range l.jobs {
+		if !existing.finishedAt.IsZero() && now.Sub(existing.finishedAt) > finishedJobsRetention {
+			delete(l.jobs, id)
+		}
+	}
+	l.nextID++
+	id := l.nextID
+	job := &localJob{
+		status: JobStatus{ID: id, Status: JobStatusRunning},
+		cancel: cancel,
+	}
+	l.jobs[id] = job
+	l.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		err := fn(ctx)
+
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		job.finishedAt = time.Now()
+		switch {
+		case err == nil:
+			job.status.Status = JobStatusSucceeded
+			job.status.FractionCompleted = 1
+		case ctx.Err() != nil:
+			job.status.Status = JobStatusCanceled
+			job.status.Error = err.Error()
+		default:
+			job.status.Status = JobStatusFailed
+			job.status.Error = err.Error()
+		}
+	}()
+	return id
+}
+
+// Job returns the current status of the job with the given id
+func (l *LocalJobs) Job(id int64) (JobStatus, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	job, ok := l.jobs[id]
+	if !ok {
+		return JobStatus{}, fmt.Errorf("job %d not found", id)
+	}
+	return job.status, nil
+}
+
+// Cancel cancels the job with the given id
+func (l *LocalJobs) Cancel(id int64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	job, ok := l.jobs[id]
+	if !ok {
+		return fmt.Errorf("job %d not found", id)
+	}
+	job.cancel()
+	return nil
+}
@@ -0,0 +1,62 @@
+package cluster
+
+import (
+	"regexp"
+	"sort"
+	"sync"
+)
+
+const (
+	// DefaultName is the name of the cluster configured in the DB section
+	DefaultName = "default"
+	// IngestName is the name reserved for the collections of ingested artifacts
+	IngestName = "ingest"
+)
+
+// validName only allows names that are safe as URL and directory path element. Underscores are not
+// allowed because they separate the path elements in zip file names.
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9.-]{0,62}$`)
+
+// ValidName returns true if name can be used as cluster or collection name
+func ValidName(name string) bool {
+	return validName.MatchString(name)
+}
+
+// Registry holds the engines of all configured clusters by name
+type Registry struct {
+	mu      sync.RWMutex
+	engines map[string]Engine
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		engines: make(map[string]Engine),
+	}
+}
+
+// Add registers the engine of the cluster with the given name
+func (r *Registry) Add(name string, engine Engine) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.engines[name] = engine
+}
+
+// Get returns the engine of the cluster with the given name
+func (r *Registry) Get(name string) (Engine, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	engine, ok := r.engines[name]
+	return engine, ok
+}
+
+// Names returns the sorted names of all registered clusters
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.engines))
+	for name := range r.engines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -1,36 +1,147 @@
 package crdb
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
 	"gitlab.cmpayments.local/payments-gateway/backupsmanager/pkg/database"
 	"go.uber.org/zap"
 	"net/url"
 	"path"
+	"strings"
 )
 
 type Wrapper struct {
 	logger             *zap.Logger
 	db                 *sql.DB
 	fileServerEndpoint string
+	// secrets are redacted from the errors of CRDB, which may contain the backup URL
+	secrets []string
 }
 
+// NewWrapper returns the engine of a CRDB cluster writing its backups to fileServerEndpoint, which may contain the
+// WebDAV credentials of the cluster
 func NewWrapper(logger *zap.Logger, db *sql.DB, fileServerEndpoint string) *Wrapper {
+	var secrets []string
+	if u, err := url.Parse(fileServerEndpoint); err == nil {
+		if password, ok := u.User.Password(); ok && password != "" {
+			secrets = append(secrets, u.User.String(), password)
+		}
+	}
 	return &Wrapper{
 		logger:             logger,
 		db:                 db,
 		fileServerEndpoint: fileServerEndpoint,
+		secrets:            secrets,
 	}
 }
 
-func (w *Wrapper) TriggerBackup(backupsDir string) error {
+// redactedError is an error of CRDB without the secrets of the Wrapper
+type redactedError struct {
+	message string
+	err     error
+}
+
+func (e *redactedError) Error() string {
+	return e.message
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// redact removes the secrets from err, so the WebDAV credentials don't end up in logs and responses
+func (w *Wrapper) redact(err error) error {
+	if err == nil || len(w.secrets) == 0 {
+		return err
+	}
+	return &redactedError{message: w.redactString(err.Error()), err: err}
+}
+
+func (w *Wrapper) redactString(s string) string {
+	for _, secret := range w.secrets {
+		s = strings.ReplaceAll(s, secret, "redacted")
+	}
+	return s
+}
+
+// Ping checks the connection with the cluster
+func (w *Wrapper) Ping(ctx context.Context) error {
+	if err := w.db.PingContext(ctx); err != nil {
+		return &database.Error{Err: err}
+	}
+	return nil
+}
+
+// Restore runs a RESTORE statement for the backup subdir of the collection in backupsDir.
+// An empty subdir restores the LATEST backup. It returns the ID of the CRDB job running the restore.
+func (w *Wrapper) Restore(backupsDir string, subdir string, options RestoreOptions) (int64, error) {
+	options.Normalize()
+	query, err := restoreStatement(w.collectionURL(backupsDir), subdir, options)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := w.db.Query(query)
+	if err != nil {
+		err = w.redact(err)
+		w.logger.Error("Restore: error triggering restore", zap.Error(err))
+		return 0, &database.Error{Err: err}
+	}
+	defer rows.Close()
+	return w.firstJobID(rows)
+}
+
+// collectionURL returns the URL of the backups collection in backupsDir as seen by CRDB
+func (w *Wrapper) collectionURL(backupsDir string) string {
 	u, _ := url.Parse(w.fileServerEndpoint)
 	u.Path = path.Join(u.Path, backupsDir)
-	query := fmt.Sprintf("BACKUP INTO '%s' AS OF SYSTEM TIME '-10s'", u.String())
+	return u.String()
+}
+
+// TriggerBackup runs a BACKUP INTO statement for backupsDir with the given options.
+// It returns the ID of the CRDB job running the backup.
+func (w *Wrapper) TriggerBackup(backupsDir string, options BackupOptions) (int64, error) {
+	options.Normalize()
+	query, err := backupStatement(w.collectionURL(backupsDir), options)
+	if err != nil {
+		return 0, err
+	}
 
-	if _, err := w.db.Exec(query); err != nil {
+	rows, err := w.db.Query(query)
+	if err != nil {
+		err = w.redact(err)
 		w.logger.Error("TriggerBackup: error triggering backup", zap.Error(err))
-		return &database.Error{Err: err}
+		return 0, &database.Error{Err: err}
 	}
-	return nil
+	defer rows.Close()
+
+	return w.firstJobID(rows)
+}
+
+// firstJobID reads the job_id from the first row of a BACKUP or RESTORE result. The job_id is always the
+// first column, both for detached and regular jobs.
+func (w *Wrapper) firstJobID(rows *sql.Rows) (int64, error) {
+	var jobID int64
+	if rows.Next() {
+		columns, err := rows.Columns()
+		if err != nil {
+			return 0, &database.Error{Err: err}
+		}
+		values := make([]interface{}, len(columns))
+		values[0] = &jobID
+		for i := 1; i < len(values); i++ {
+			values[i] = new(interface{})
+		}
+		if err := rows.Scan(values...); err != nil {
+			err = w.redact(err)
+			w.logger.Error("firstJobID: error reading job result", zap.Error(err))
+			return 0, &database.Error{Err: err}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		err = w.redact(err)
+		w.logger.Error("firstJobID: error reading job result", zap.Error(err))
+		return 0, &database.Error{Err: err}
+	}
+	return jobID, nil
 }
@@ -0,0 +1,48 @@
+package crdb
+
+import (
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/cluster"
+)
+
+var _ cluster.Engine = (*Wrapper)(nil)
+
+// Name returns the engine name of CRDB clusters
+func (w *Wrapper) Name() string {
+	return cluster.EngineCRDB
+}
+
+// StartBackup triggers a backup into collection with the JSON encoded BackupOptions
+func (w *Wrapper) StartBackup(collection string, options []byte) (cluster.JobRef, error) {
+	backupOptions := DefaultBackupOptions()
+	if err := cluster.DecodeOptions(options, &backupOptions); err != nil {
+		return cluster.JobRef{}, err
+	}
+	backupOptions.Normalize()
+	if err := backupOptions.Assert(); err != nil {
+		return cluster.JobRef{}, &cluster.OptionsError{Err: err}
+	}
+
+	jobID, err := w.TriggerBackup("/"+collection, backupOptions)
+	if err != nil {
+		return cluster.JobRef{}, err
+	}
+	return cluster.JobRef{ID: jobID, Detached: backupOptions.Detached}, nil
+}
+
+// StartRestore triggers a restore of the backup subdir of collection with the JSON encoded RestoreOptions
+func (w *Wrapper) StartRestore(collection string, subdir string, options []byte) (cluster.JobRef, error) {
+	var restoreOptions RestoreOptions
+	if err := cluster.DecodeOptions(options, &restoreOptions); err != nil {
+		return cluster.JobRef{}, err
+	}
+	restoreOptions.Normalize()
+	if err := restoreOptions.Assert(); err != nil {
+		return cluster.JobRef{}, &cluster.OptionsError{Err: err}
+	}
+
+	jobID, err := w.Restore("/"+collection, subdir, restoreOptions)
+	if err != nil {
+		return cluster.JobRef{}, err
+	}
+	return cluster.JobRef{ID: jobID, Detached: restoreOptions.Detached}, nil
+}
@@ -0,0 +1,56 @@
+package crdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/cluster"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/pkg/database"
+	"go.uber.org/zap"
+	"time"
+)
+
+// Job returns the current status of the CRDB job with the given id
+func (w *Wrapper) Job(ctx context.Context, jobID int64) (cluster.JobStatus, error) {
+	const query = `SELECT job_id, status, COALESCE(fraction_completed, 0), COALESCE(error, '') FROM crdb_internal.jobs WHERE job_id = $1`
+
+	var status cluster.JobStatus
+	err := w.db.QueryRowContext(ctx, query, jobID).Scan(&status.ID, &status.Status, &status.FractionCompleted, &status.Error)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			w.logger.Error("Job: error reading job status", zap.Int64("jobID", jobID), zap.Error(err))
+		}
+		return cluster.JobStatus{}, &database.Error{Err: err}
+	}
+	status.Error = w.redactString(status.Error)
+	return status, nil
+}
+
+// WaitForJob polls the CRDB job with the given id every interval until it is finished or ctx is done.
+// onProgress is called with every polled status, including the final one.
+func (w *Wrapper) WaitForJob(ctx context.Context, jobID int64, interval time.Duration, onProgress func(cluster.JobStatus)) (cluster.JobStatus, error) {
+	return cluster.WaitForJob(ctx, w, jobID, interval, onProgress)
+}
+
+// PauseJob pauses the CRDB job with the given id
+func (w *Wrapper) PauseJob(ctx context.Context, jobID int64) error {
+	return w.controlJob(ctx, "PAUSE", jobID)
+}
+
+// ResumeJob resumes the paused CRDB job with the given id
+func (w *Wrapper) ResumeJob(ctx context.Context, jobID int64) error {
+	return w.controlJob(ctx, "RESUME", jobID)
+}
+
+// CancelJob cancels the CRDB job with the given id
+func (w *Wrapper) CancelJob(ctx context.Context, jobID int64) error {
+	return w.controlJob(ctx, "CANCEL", jobID)
+}
+
+func (w *Wrapper) controlJob(ctx context.Context, command string, jobID int64) error {
+	if _, err := w.db.ExecContext(ctx, fmt.Sprintf("%s JOB $1", command), jobID); err != nil {
+		w.logger.Error("controlJob: error controlling job", zap.String("command", command), zap.Int64("jobID", jobID), zap.Error(err))
+		return &database.Error{Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package crdb
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// BackupScope determines which objects of the cluster end up in a backup
+type BackupScope string
+
+const (
+	// ScopeCluster backs up the whole cluster
+	ScopeCluster BackupScope = "cluster"
+	// ScopeDatabases backs up the databases listed in BackupOptions.Databases
+	ScopeDatabases BackupScope = "databases"
+	// ScopeTables backs up the tables listed in BackupOptions.Tables
+	ScopeTables BackupScope = "tables"
+)
+
+const (
+	// defaultAsOfSystemTime is used when no AS OF SYSTEM TIME offset is requested
+	defaultAsOfSystemTime = "-10s"
+	// maxNameLength keeps database and table names within sane bounds
+	maxNameLength = 128
+	// maxNames limits the amount of databases or tables in a single backup
+	maxNames = 64
+)
+
+// BackupOptions holds the user-selectable options of a BACKUP statement
+type BackupOptions struct {
+	// Scope of the backup, defaults to ScopeCluster
+	Scope BackupScope `json:"scope"`
+	// Databases to back up when Scope is ScopeDatabases
+	Databases []string `json:"databases"`
+	// Tables to back up when Scope is ScopeTables, as `table`, `db.table`, `db.schema.table` or `db.*`
+	Tables []string `json:"tables"`
+	// AsOfSystemTime negative offset (e.g. -10s, -1m30s), defaults to defaultAsOfSystemTime
+	AsOfSystemTime string `json:"as_of_system_time"`
+	// RevisionHistory enables the revision_history option
+	RevisionHistory bool `json:"revision_history"`
+	// Detached runs the backup as a detached CRDB job, enabled by default
+	Detached bool `json:"detached"`
+	// EncryptionPassphrase enables CRDB encryption with the given passphrase
+	EncryptionPassphrase string `json:"encryption_passphrase"`
+	// KMS enables CRDB encryption with the given KMS URIs
+	KMS []string `json:"kms"`
+}
+
+// DefaultBackupOptions returns the options used when a request does not specify any
+func DefaultBackupOptions() BackupOptions {
+	return BackupOptions{
+		Scope:          ScopeCluster,
+		AsOfSystemTime: defaultAsOfSystemTime,
+		Detached:       true,
+	}
+}
+
+// Normalize fills in defaults for the options left empty
+func (o *BackupOptions) Normalize() {
+	if o.Scope == "" {
+		o.Scope = ScopeCluster
+	}
+	if o.AsOfSystemTime == "" {
+		o.AsOfSystemTime = defaultAsOfSystemTime
+	}
+}
+
+func (o BackupOptions) Assert() error {
+	switch o.Scope {
+	case ScopeCluster:
+		if len(o.Databases) > 0 || len(o.Tables) > 0 {
+			return errors.New("databases and tables are not allowed for scope cluster")
+		}
+	case ScopeDatabases:
+		if len(o.Databases) == 0 {
+			return errors.New("at least one database is required for scope databases")
+		}
+		if len(o.Tables) > 0 {
+			return errors.New("tables are not allowed for scope databases")
+		}
+		if err := assertNames(o.Databases, false); err != nil {
+			return fmt.Errorf("%w in databases", err)
+		}
+	case ScopeTables:
+		if len(o.Tables) == 0 {
+			return errors.New("at least one table is required for scope tables")
+		}
+		if len(o.Databases) > 0 {
+			return errors.New("databases are not allowed for scope tables")
+		}
+		if err := assertNames(o.Tables, true); err != nil {
+			return fmt.Errorf("%w in tables", err)
+		}
+	default:
+		return fmt.Errorf("unknown scope %q", o.Scope)
+	}
+
+	if _, err := asOfSystemTimeOffset(o.AsOfSystemTime); err != nil {
+		return err
+	}
+
+	if o.EncryptionPassphrase != "" && len(o.KMS) > 0 {
+		return errors.New("encryption_passphrase and kms are mutually exclusive")
+	}
+	for _, uri := range o.KMS {
+		if strings.TrimSpace(uri) == "" {
+			return errors.New("kms URIs can't be empty")
+		}
+	}
+	return nil
+}
+
+// RestoreOptions holds the user-selectable options of a RESTORE statement
+type RestoreOptions struct {
+	// Scope of the restore, defaults to ScopeCluster
+	Scope BackupScope `json:"scope"`
+	// Databases to restore when Scope is ScopeDatabases
+	Databases []string `json:"databases"`
+	// Tables to restore when Scope is ScopeTables
+	Tables []string `json:"tables"`
+	// IntoDB restores the tables into this database instead of the original one
+	IntoDB string `json:"into_db"`
+	// NewDBName restores a single database under a new name
+	NewDBName string `json:"new_db_name"`
+	// Detached runs the restore as a detached CRDB job
+	Detached bool `json:"detached"`
+	// SkipMissingForeignKeys enables the skip_missing_foreign_keys option
+	SkipMissingForeignKeys bool `json:"skip_missing_foreign_keys"`
+	// SkipMissingSequences enables the skip_missing_sequences option
+	SkipMissingSequences bool `json:"skip_missing_sequences"`
+	// SkipMissingViews enables the skip_missing_views option
+	SkipMissingViews bool `json:"skip_missing_views"`
+	// EncryptionPassphrase of an encrypted backup
+	EncryptionPassphrase string `json:"encryption_passphrase"`
+	// KMS URIs of an encrypted backup
+	KMS []string `json:"kms"`
+}
+
+// Normalize fills in defaults for the options left empty
+func (o *RestoreOptions) Normalize() {
+	if o.Scope == "" {
+		o.Scope = ScopeCluster
+	}
+}
+
+func (o RestoreOptions) Assert() error {
+	switch o.Scope {
+	case ScopeCluster:
+		if len(o.Databases) > 0 || len(o.Tables) > 0 {
+			return errors.New("databases and tables are not allowed for scope cluster")
+		}
+	case ScopeDatabases:
+		if len(o.Databases) == 0 {
+			return errors.New("at least one database is required for scope databases")
+		}
+		if err := assertNames(o.Databases, false); err != nil {
+			return fmt.Errorf("%w in databases", err)
+		}
+	case ScopeTables:
+		if len(o.Tables) == 0 {
+			return errors.New("at least one table is required for scope tables")
+		}
+		if err := assertNames(o.Tables, true); err != nil {
+			return fmt.Errorf("%w in tables", err)
+		}
+	default:
+		return fmt.Errorf("unknown scope %q", o.Scope)
+	}
+
+	if o.IntoDB != "" && o.Scope != ScopeTables {
+		return errors.New("into_db is only allowed for scope tables")
+	}
+	if o.NewDBName != "" && (o.Scope != ScopeDatabases || len(o.Databases) != 1) {
+		return errors.New("new_db_name is only allowed when restoring a single database")
+	}
+	if o.EncryptionPassphrase != "" && len(o.KMS) > 0 {
+		return errors.New("encryption_passphrase and kms are mutually exclusive")
+	}
+	return nil
+}
+
+// asOfSystemTimeOffset parses a negative AS OF SYSTEM TIME offset and returns it in canonical form.
+// The canonical form only contains digits, a dot, a minus sign and unit letters.
+func asOfSystemTimeOffset(offset string) (string, error) {
+	d, err := time.ParseDuration(offset)
+	if err != nil {
+		return "", fmt.Errorf("as_of_system_time is invalid: %w", err)
+	}
+	if d >= 0 {
+		return "", errors.New("as_of_system_time must be a negative offset")
+	}
+	return d.String(), nil
+}
+
+// assertNames validates database or table names, qualified names are only accepted for tables
+func assertNames(names []string, qualified bool) error {
+	if len(names) > maxNames {
+		return fmt.Errorf("at most %d names are allowed", maxNames)
+	}
+	for _, name := range names {
+		parts := []string{name}
+		if qualified {
+			parts = strings.Split(name, ".")
+			if len(parts) > 3 {
+				return fmt.Errorf("name %q has too many parts", name)
+			}
+		}
+		for i, part := range parts {
+			if qualified && part == "*" && i == len(parts)-1 && i > 0 {
+				continue
+			}
+			if part == "" || len(part) > maxNameLength || strings.ContainsRune(part, 0) {
+				return fmt.Errorf("name %q is invalid", name)
+			}
+		}
+	}
+	return nil
+}
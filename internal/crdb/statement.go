@@ -0,0 +1,277 @@
+package crdb
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// optionKind describes which kind of value a WITH option takes
+type optionKind int
+
+const (
+	// optionFlag is an option without value, e.g. WITH detached
+	optionFlag optionKind = iota
+	// optionString is an option with a single string value, e.g. WITH encryption_passphrase = 'secret'
+	optionString
+	// optionStringList is an option with one or more string values, e.g. WITH kms = ('uri1', 'uri2')
+	optionStringList
+)
+
+// backupOptionKinds whitelists the WITH options accepted in BACKUP statements
+var backupOptionKinds = map[string]optionKind{
+	"revision_history":      optionFlag,
+	"detached":              optionFlag,
+	"encryption_passphrase": optionString,
+	"kms":                   optionStringList,
+}
+
+// restoreOptionKinds whitelists the WITH options accepted in RESTORE statements
+var restoreOptionKinds = map[string]optionKind{
+	"detached":                  optionFlag,
+	"skip_missing_foreign_keys": optionFlag,
+	"skip_missing_sequences":    optionFlag,
+	"skip_missing_views":        optionFlag,
+	"into_db":                   optionString,
+	"new_db_name":               optionString,
+	"encryption_passphrase":     optionString,
+	"kms":                       optionStringList,
+}
+
+var errInvalidString = errors.New("strings must be valid UTF-8 without NUL characters")
+
+// QuoteLiteral returns s as SQL string literal. Quotes are doubled, backslashes have no special meaning
+// in standard string literals so they are kept as is.
+func QuoteLiteral(s string) (string, error) {
+	if !validString(s) {
+		return "", errInvalidString
+	}
+	return "'" + strings.Replace(s, "'", "''", -1) + "'", nil
+}
+
+// QuoteIdentifier returns s as SQL delimited identifier
+func QuoteIdentifier(s string) (string, error) {
+	if s == "" {
+		return "", errors.New("identifiers can't be empty")
+	}
+	if !validString(s) {
+		return "", errInvalidString
+	}
+	return `"` + strings.Replace(s, `"`, `""`, -1) + `"`, nil
+}
+
+func validString(s string) bool {
+	return utf8.ValidString(s) && !strings.ContainsRune(s, 0)
+}
+
+// statement builds a CRDB statement. Keywords are trusted text written by this package, anything else is
+// quoted as identifier or literal. The first error is kept and returned by String.
+type statement struct {
+	sb          strings.Builder
+	with        []string
+	optionKinds map[string]optionKind
+	err         error
+}
+
+func newStatement(keyword string, optionKinds map[string]optionKind) *statement {
+	s := &statement{optionKinds: optionKinds}
+	s.sb.WriteString(keyword)
+	return s
+}
+
+// keyword appends trusted SQL text
+func (s *statement) keyword(keyword string) *statement {
+	s.sb.WriteString(" ")
+	s.sb.WriteString(keyword)
+	return s
+}
+
+// literal appends value as string literal
+func (s *statement) literal(value string) *statement {
+	quoted, err := QuoteLiteral(value)
+	if err != nil {
+		s.fail(fmt.Errorf("invalid literal: %w", err))
+		return s
+	}
+	return s.keyword(quoted)
+}
+
+// names appends a comma separated list of identifiers. For qualified names every part is quoted separately
+// and the last part may be the * wildcard.
+func (s *statement) names(names []string, qualified bool) *statement {
+	if len(names) == 0 {
+		s.fail(errors.New("at least one name is required"))
+		return s
+	}
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		parts := []string{name}
+		if qualified {
+			parts = strings.Split(name, ".")
+		}
+		for j, part := range parts {
+			if qualified && part == "*" && j == len(parts)-1 && j > 0 {
+				continue
+			}
+			q, err := QuoteIdentifier(part)
+			if err != nil {
+				s.fail(fmt.Errorf("invalid name %q: %w", name, err))
+				return s
+			}
+			parts[j] = q
+		}
+		quoted[i] = strings.Join(parts, ".")
+	}
+	return s.keyword(strings.Join(quoted, ", "))
+}
+
+// flag adds a WITH option without value
+func (s *statement) flag(name string) *statement {
+	if s.checkOption(name, optionFlag) {
+		s.with = append(s.with, name)
+	}
+	return s
+}
+
+// option adds a WITH option with a single string value
+func (s *statement) option(name string, value string) *statement {
+	if !s.checkOption(name, optionString) {
+		return s
+	}
+	quoted, err := QuoteLiteral(value)
+	if err != nil {
+		s.fail(fmt.Errorf("invalid value for option %s: %w", name, err))
+		return s
+	}
+	s.with = append(s.with, name+" = "+quoted)
+	return s
+}
+
+// optionList adds a WITH option with a list of string values
+func (s *statement) optionList(name string, values []string) *statement {
+	if !s.checkOption(name, optionStringList) {
+		return s
+	}
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		q, err := QuoteLiteral(value)
+		if err != nil {
+			s.fail(fmt.Errorf("invalid value for option %s: %w", name, err))
+			return s
+		}
+		quoted[i] = q
+	}
+	s.with = append(s.with, fmt.Sprintf("%s = (%s)", name, strings.Join(quoted, ", ")))
+	return s
+}
+
+func (s *statement) checkOption(name string, kind optionKind) bool {
+	if k, ok := s.optionKinds[name]; !ok || k != kind {
+		s.fail(fmt.Errorf("option %s is not allowed", name))
+		return false
+	}
+	return true
+}
+
+func (s *statement) fail(err error) {
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+// String returns the statement, or the first error found while building it
+func (s *statement) String() (string, error) {
+	if s.err != nil {
+		return "", s.err
+	}
+	query := s.sb.String()
+	if len(s.with) > 0 {
+		query += " WITH " + strings.Join(s.with, ", ")
+	}
+	return query, nil
+}
+
+// backupStatement builds the BACKUP INTO statement for the collection at destination
+func backupStatement(destination string, options BackupOptions) (string, error) {
+	if err := options.Assert(); err != nil {
+		return "", err
+	}
+	offset, err := asOfSystemTimeOffset(options.AsOfSystemTime)
+	if err != nil {
+		return "", err
+	}
+
+	s := newStatement("BACKUP", backupOptionKinds)
+	switch options.Scope {
+	case ScopeDatabases:
+		s.keyword("DATABASE").names(options.Databases, false)
+	case ScopeTables:
+		s.keyword("TABLE").names(options.Tables, true)
+	}
+	s.keyword("INTO").literal(destination)
+	s.keyword("AS OF SYSTEM TIME").literal(offset)
+
+	if options.RevisionHistory {
+		s.flag("revision_history")
+	}
+	if options.Detached {
+		s.flag("detached")
+	}
+	if options.EncryptionPassphrase != "" {
+		s.option("encryption_passphrase", options.EncryptionPassphrase)
+	}
+	if len(options.KMS) > 0 {
+		s.optionList("kms", options.KMS)
+	}
+	return s.String()
+}
+
+// restoreStatement builds the RESTORE statement for the backup subdir of the collection at collection.
+// An empty subdir restores the LATEST backup of the collection.
+func restoreStatement(collection string, subdir string, options RestoreOptions) (string, error) {
+	if err := options.Assert(); err != nil {
+		return "", err
+	}
+
+	s := newStatement("RESTORE", restoreOptionKinds)
+	switch options.Scope {
+	case ScopeDatabases:
+		s.keyword("DATABASE").names(options.Databases, false)
+	case ScopeTables:
+		s.keyword("TABLE").names(options.Tables, true)
+	}
+	s.keyword("FROM")
+	if subdir == "" {
+		s.keyword("LATEST")
+	} else {
+		s.literal(subdir)
+	}
+	s.keyword("IN").literal(collection)
+
+	if options.Detached {
+		s.flag("detached")
+	}
+	if options.SkipMissingForeignKeys {
+		s.flag("skip_missing_foreign_keys")
+	}
+	if options.SkipMissingSequences {
+		s.flag("skip_missing_sequences")
+	}
+	if options.SkipMissingViews {
+		s.flag("skip_missing_views")
+	}
+	if options.IntoDB != "" {
+		s.option("into_db", options.IntoDB)
+	}
+	if options.NewDBName != "" {
+		s.option("new_db_name", options.NewDBName)
+	}
+	if options.EncryptionPassphrase != "" {
+		s.option("encryption_passphrase", options.EncryptionPassphrase)
+	}
+	if len(options.KMS) > 0 {
+		s.optionList("kms", options.KMS)
+	}
+	return s.String()
+}
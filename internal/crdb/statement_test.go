@@ -0,0 +1,171 @@
+//go:build go1.18
+// +build go1.18
+
+package crdb
+
+import (
+	"strings"
+	"testing"
+)
+
+// sqlToken is a piece of a statement: trusted text, a string literal or a delimited identifier, with the quotes
+// removed and unescaped
+type sqlToken struct {
+	kind  byte // 'k' for text, 'l' for literals, 'i' for identifiers
+	value string
+}
+
+// lex splits a statement the way CRDB reads its standard string literals and delimited identifiers. ok is false
+// when a quote is left open.
+func lex(query string) (tokens []sqlToken, ok bool) {
+	var text strings.Builder
+	for i := 0; i < len(query); {
+		quote := query[i]
+		if quote != '\'' && quote != '"' {
+			text.WriteByte(quote)
+			i++
+			continue
+		}
+		if text.Len() > 0 {
+			tokens = append(tokens, sqlToken{kind: 'k', value: text.String()})
+			text.Reset()
+		}
+		var value strings.Builder
+		closed := false
+		for i++; i < len(query); i++ {
+			if query[i] != quote {
+				value.WriteByte(query[i])
+				continue
+			}
+			if i+1 < len(query) && query[i+1] == quote {
+				value.WriteByte(quote)
+				i++
+				continue
+			}
+			closed = true
+			i++
+			break
+		}
+		if !closed {
+			return nil, false
+		}
+		kind := byte('l')
+		if quote == '"' {
+			kind = 'i'
+		}
+		tokens = append(tokens, sqlToken{kind: kind, value: value.String()})
+	}
+	if text.Len() > 0 {
+		tokens = append(tokens, sqlToken{kind: 'k', value: text.String()})
+	}
+	return tokens, true
+}
+
+// skeleton returns the trusted text of tokens, with ? for every literal and identifier
+func skeleton(tokens []sqlToken) string {
+	var sb strings.Builder
+	for _, t := range tokens {
+		if t.kind == 'k' {
+			sb.WriteString(t.value)
+		} else {
+			sb.WriteString("?")
+		}
+	}
+	return sb.String()
+}
+
+func FuzzQuoteLiteral(f *testing.F) {
+	for _, seed := range []string{"", "secret", "'", "''", `\'`, `'; DROP DATABASE defaultdb; --`, `' OR '1'='1`, "é'ü", "a\x00b", "\xff"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		quoted, err := QuoteLiteral(s)
+		if err != nil {
+			if validString(s) {
+				t.Fatalf("QuoteLiteral(%q) failed: %v", s, err)
+			}
+			return
+		}
+		tokens, ok := lex("SELECT " + quoted + " AS x")
+		if !ok {
+			t.Fatalf("QuoteLiteral(%q) = %s leaves the literal open", s, quoted)
+		}
+		if len(tokens) != 3 || tokens[1].kind != 'l' || skeleton(tokens) != "SELECT ? AS x" {
+			t.Fatalf("QuoteLiteral(%q) = %s terminates the literal: %q", s, quoted, tokens)
+		}
+		if tokens[1].value != s {
+			t.Fatalf("QuoteLiteral(%q) = %s reads back as %q", s, quoted, tokens[1].value)
+		}
+	})
+}
+
+func FuzzBackupStatement(f *testing.F) {
+	f.Add("http://localhost:31000/backups/default/x", "db.public.t", "secret", "")
+	f.Add("http://localhost:31000/backups/default/x", `db."t"; DROP TABLE t; --`, `'); DROP DATABASE defaultdb; --`, "")
+	f.Add("http://localhost:31000/backups/default/x'", "db.*", "", "gs://key?AUTH=implicit', 'x")
+	f.Add("", "t", "", `\'`)
+	f.Fuzz(func(t *testing.T, destination string, table string, passphrase string, kms string) {
+		options := BackupOptions{
+			Scope:                ScopeTables,
+			Tables:               []string{table},
+			AsOfSystemTime:       defaultAsOfSystemTime,
+			RevisionHistory:      true,
+			Detached:             true,
+			EncryptionPassphrase: passphrase,
+		}
+		if passphrase == "" && kms != "" {
+			options.KMS = []string{kms}
+		}
+		query, err := backupStatement(destination, options)
+		if err != nil {
+			return
+		}
+
+		tokens, ok := lex(query)
+		if !ok {
+			t.Fatalf("%s leaves a quote open", query)
+		}
+
+		parts := strings.Split(table, ".")
+		names := make([]string, len(parts))
+		var identifiers []string
+		for i, part := range parts {
+			names[i] = "?"
+			if part == "*" && i == len(parts)-1 && i > 0 {
+				names[i] = "*"
+				continue
+			}
+			identifiers = append(identifiers, part)
+		}
+		offset, _ := asOfSystemTimeOffset(defaultAsOfSystemTime)
+		literals := []string{destination, offset}
+		want := "BACKUP TABLE " + strings.Join(names, ".") + " INTO ? AS OF SYSTEM TIME ? WITH revision_history, detached"
+		switch {
+		case passphrase != "":
+			want += ", encryption_passphrase = ?"
+			literals = append(literals, passphrase)
+		case kms != "":
+			want += ", kms = (?)"
+			literals = append(literals, kms)
+		}
+		if got := skeleton(tokens); got != want {
+			t.Fatalf("%s has the statement text %s, want %s", query, got, want)
+		}
+
+		var gotIdentifiers, gotLiterals []string
+		for _, token := range tokens {
+			switch token.kind {
+			case 'i':
+				gotIdentifiers = append(gotIdentifiers, token.value)
+			case 'l':
+				gotLiterals = append(gotLiterals, token.value)
+			}
+		}
+		if strings.Join(gotIdentifiers, "\x00") != strings.Join(identifiers, "\x00") {
+			t.Fatalf("%s reads back the identifiers %q, want %q", query, gotIdentifiers, identifiers)
+		}
+		if strings.Join(gotLiterals, "\x00") != strings.Join(literals, "\x00") {
+			t.Fatalf("%s reads back the literals %q, want %q", query, gotLiterals, literals)
+		}
+	})
+}
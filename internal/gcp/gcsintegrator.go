@@ -7,25 +7,34 @@ import (
 	"errors"
 	"fmt"
 	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/app"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/tracing"
 	"go.uber.org/zap"
-	"golang.org/x/sync/semaphore"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 	"io/ioutil"
 	"os"
 	"path"
+	"time"
 )
 
+// Object is an object in the bucket
+type Object struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	Updated time.Time `json:"updated"`
+}
+
 type GCSIntegrator struct {
 	ctx               context.Context
 	logger            *zap.Logger
-	sem               *semaphore.Weighted
+	sem               app.Semaphore
 	downloadsRootPath string
 	client            *storage.Client
 	bucket            *storage.BucketHandle
 	bucketName        string
 }
 
-func NewGCSIntegrator(ctx context.Context, logger *zap.Logger, sem *semaphore.Weighted, downloadsRootPath string, config Config) *GCSIntegrator {
+func NewGCSIntegrator(ctx context.Context, logger *zap.Logger, sem app.Semaphore, downloadsRootPath string, config Config) *GCSIntegrator {
 	if err := os.MkdirAll(downloadsRootPath, os.ModePerm); err != nil && !os.IsExist(err) {
 		logger.Fatal("FATAL %v", zap.Error(err))
 	}
@@ -47,31 +56,85 @@ func NewGCSIntegrator(ctx context.Context, logger *zap.Logger, sem *semaphore.We
 	}
 }
 
-func (g *GCSIntegrator) UploadToStorage(toBucket <-chan app.DTO) {
+// Ping checks that the bucket is reachable with the configured credentials
+func (g *GCSIntegrator) Ping(ctx context.Context) error {
+	if g.client == nil {
+		return errors.New("storage client is not set")
+	}
+	if _, err := g.bucket.Attrs(ctx); err != nil {
+		return fmt.Errorf("error getting attributes of bucket %s: %w", g.bucketName, err)
+	}
+	return nil
+}
+
+// List returns the objects in the bucket whose name starts with prefix
+func (g *GCSIntegrator) List(ctx context.Context, prefix string) ([]Object, error) {
+	if g.client == nil {
+		return nil, errors.New("storage client is not set")
+	}
+	var objects []Object
+	it := g.bucket.Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return objects, nil
+		}
+		if err != nil {
+			g.logger.Error("List: unable to list objects in bucket", zap.String("bucketName", g.bucketName), zap.String("prefix", prefix), zap.Error(err))
+			return nil, fmt.Errorf("error while listing bucket: %w", err)
+		}
+		objects = append(objects, Object{Name: attrs.Name, Size: attrs.Size, Updated: attrs.Updated})
+	}
+}
+
+// Delete deletes the object with the given name from the bucket
+func (g *GCSIntegrator) Delete(ctx context.Context, name string) error {
+	if g.client == nil {
+		return errors.New("storage client is not set")
+	}
+	if err := g.bucket.Object(name).Delete(ctx); err != nil {
+		g.logger.Error("Delete: unable to delete object from bucket", zap.String("bucketName", g.bucketName), zap.String("fileName", name), zap.Error(err))
+		return fmt.Errorf("error while deleting from bucket: %w", err)
+	}
+	return nil
+}
+
+// UploadToStorage uploads the first file received from toBucket in a span of ctx, reporting the bytes uploaded so far to progress,
+// which may be nil. The result is sent on the returned stream, which is buffered so callers are free to ignore it.
+func (g *GCSIntegrator) UploadToStorage(ctx context.Context, toBucket <-chan app.DTO, progress app.Progress) <-chan app.DTO {
+	resultStream := make(chan app.DTO, 1)
 	go func() {
+		defer close(resultStream)
 		select {
 		case <-g.ctx.Done():
 			return
 		case tb, more := <-toBucket:
 			if more {
-				g.uploadToBucket(tb)
+				resultStream <- g.uploadToBucket(ctx, tb, progress)
 			}
 			return
 		}
 	}()
+	return resultStream
 }
 
-func (g *GCSIntegrator) uploadToBucket(toBucket app.DTO) app.DTO {
+func (g *GCSIntegrator) uploadToBucket(ctx context.Context, toBucket app.DTO, progress app.Progress) (result app.DTO) {
 	if g.client == nil {
-		g.logger.Warn("uploadToBucket: skipping, storage client is not set")
+		g.logger.Warn("uploadToBucket: skipping, storage client is not set", tracing.LogFields(ctx)...)
 		return app.NewDTOInstance(fmt.Errorf("skipping upload to bucket, storage client is not set"), "")
 	}
 
 	if toBucket.Err() != nil {
-		g.logger.Warn("uploadToBucket: skipping, source has already an error", zap.Error(toBucket.Err()))
-		return app.NewDTOInstance(fmt.Errorf("skipping upload to bucket, source has already an error"), "")
+		g.logger.Warn("uploadToBucket: skipping, source has already an error", append(tracing.LogFields(ctx), zap.Error(toBucket.Err()))...)
+		return app.NewDTOInstance(fmt.Errorf("skipping upload to bucket, source has already an error: %w", toBucket.Err()), "")
 	}
 
+	ctx, span := tracing.Tracer().Start(ctx, string(app.StageUpload))
+	defer func() {
+		tracing.End(span, result.Err())
+	}()
+	logger := g.logger.With(tracing.LogFields(ctx)...)
+
 	// get and release local semaphore
 	semErr := g.sem.Acquire(g.ctx, 1)
 	defer func() {
@@ -80,7 +143,7 @@ func (g *GCSIntegrator) uploadToBucket(toBucket app.DTO) app.DTO {
 		}
 	}()
 	if semErr != nil {
-		g.logger.Error("uploadToBucket: skipping, unable to obtain local semaphore")
+		logger.Error("uploadToBucket: skipping, unable to obtain local semaphore")
 		return app.NewDTOInstance(fmt.Errorf("error while encrypting: %v", errors.New("skipping, unable to obtain local semaphore")), "")
 	}
 
@@ -92,18 +155,28 @@ func (g *GCSIntegrator) uploadToBucket(toBucket app.DTO) app.DTO {
 
 	ciphered, err := ioutil.ReadFile(toBucket.Content())
 	if err != nil {
-		g.logger.Error("uploadToBucket: unable read data to be uploaded in bucket", zap.Error(err))
+		logger.Error("uploadToBucket: unable read data to be uploaded in bucket", zap.Error(err))
 		return app.NewDTOInstance(fmt.Errorf("error while uploading to bucket: %v", err), "")
 	}
+	if progress != nil {
+		// called by the writer once a chunk was uploaded
+		total := int64(len(ciphered))
+		wc.ProgressFunc = func(uploaded int64) {
+			progress(uploaded, total)
+		}
+	}
 
 	if _, err := wc.Write(ciphered); err != nil {
-		g.logger.Error("uploadToBucket: unable to write data to bucket", zap.Error(err))
+		logger.Error("uploadToBucket: unable to write data to bucket", zap.Error(err))
 		return app.NewDTOInstance(fmt.Errorf("error while uploading to bucket: %v", err), "")
 	}
 	if err := wc.Close(); err != nil {
-		g.logger.Error("uploadToBucket: unable to close bucket", zap.Error(err))
+		logger.Error("uploadToBucket: unable to close bucket", zap.Error(err))
 		return app.NewDTOInstance(fmt.Errorf("error while uploading to bucket: %v", err), "")
 	}
+	if progress != nil {
+		progress(int64(len(ciphered)), int64(len(ciphered)))
+	}
 
 	return app.NewDTOInstance(nil, path.Join(g.bucketName, toBucket.Content()))
 }
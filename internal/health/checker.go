@@ -0,0 +1,166 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"go.uber.org/zap"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Statuses of the probes and their checks
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// CheckFunc returns an error when the checked dependency is unhealthy
+type CheckFunc func(ctx context.Context) error
+
+type check struct {
+	name     string
+	liveness bool
+	fn       CheckFunc
+}
+
+// CheckResult is the outcome of a single check
+type CheckResult struct {
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+	// Gating is false for the checks which are reported but don't fail the probe
+	Gating     bool  `json:"gating"`
+	DurationMs int64 `json:"durationMs"`
+}
+
+// Report is the JSON body of the probes
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// Checker runs the registered checks for the liveness and readiness probes. Liveness only runs the checks of the
+// process itself, readiness runs all checks and fails when one of the gating checks fails.
+type Checker struct {
+	logger    *zap.Logger
+	timeout   time.Duration
+	readiness map[string]bool
+	mu        sync.RWMutex
+	checks    []check
+}
+
+func NewChecker(logger *zap.Logger, config Config) *Checker {
+	timeout := time.Duration(config.TimeoutInSeconds) * time.Second
+	if timeout == 0 {
+		timeout = 3 * time.Second
+	}
+	readiness := make(map[string]bool, len(config.ReadinessChecks))
+	for _, name := range config.ReadinessChecks {
+		readiness[name] = true
+	}
+	return &Checker{
+		logger:    logger,
+		timeout:   timeout,
+		readiness: readiness,
+	}
+}
+
+// Add registers a readiness check
+func (c *Checker) Add(name string, fn CheckFunc) {
+	c.add(check{name: name, fn: fn})
+}
+
+// AddLiveness registers a check which is part of both the liveness and the readiness probe
+func (c *Checker) AddLiveness(name string, fn CheckFunc) {
+	c.add(check{name: name, liveness: true, fn: fn})
+}
+
+func (c *Checker) add(chk check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, chk)
+}
+
+// gating returns true if the check named name gates readiness, db:{cluster} checks are configured as db
+func (c *Checker) gating(name string) bool {
+	if len(c.readiness) == 0 {
+		return true
+	}
+	return c.readiness[strings.SplitN(name, ":", 2)[0]]
+}
+
+// Run runs the checks of the probe concurrently, each with the configured timeout
+func (c *Checker) Run(ctx context.Context, liveness bool) Report {
+	c.mu.RLock()
+	checks := make([]check, 0, len(c.checks))
+	for _, chk := range c.checks {
+		if chk.liveness || !liveness {
+			checks = append(checks, chk)
+		}
+	}
+	c.mu.RUnlock()
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, chk := range checks {
+		wg.Add(1)
+		go func(i int, chk check) {
+			defer wg.Done()
+			results[i] = c.run(ctx, chk, liveness || c.gating(chk.name))
+		}(i, chk)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(checks))}
+	for i, chk := range checks {
+		report.Checks[chk.name] = results[i]
+		if results[i].Status == StatusFail && results[i].Gating {
+			report.Status = StatusFail
+		}
+	}
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, chk check, gating bool) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	start := time.Now()
+	err := chk.fn(ctx)
+	result := CheckResult{
+		Status:     StatusOK,
+		Gating:     gating,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		result.Status, result.Message = StatusFail, err.Error()
+		c.logger.Warn("run: check failed", zap.String("check", chk.name), zap.Bool("gating", gating), zap.Error(err))
+	}
+	return result
+}
+
+// Handler serves GET /probes/liveness and GET /probes/readiness, responding 503 when the probe fails
+func (c *Checker) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var liveness bool
+		switch strings.TrimPrefix(r.URL.Path, "/probes/") {
+		case "liveness":
+			liveness = true
+		case "readiness":
+		default:
+			http.NotFound(w, r)
+			return
+		}
+
+		report := c.Run(r.Context(), liveness)
+		status := http.StatusOK
+		if report.Status == StatusFail {
+			status = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		body, _ := json.Marshal(report)
+		_, _ = w.Write(body)
+	})
+}
@@ -0,0 +1,58 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// errFreeSpaceNotSupported is returned by freeSpace on platforms without statfs
+var errFreeSpaceNotSupported = errors.New("free space is not supported on this platform")
+
+// WorkingDir checks that dir is writable and has at least minFreeSpace bytes available
+func WorkingDir(dir string, minFreeSpace uint64) CheckFunc {
+	return func(ctx context.Context) error {
+		f, err := ioutil.TempFile(dir, ".probe-")
+		if err != nil {
+			return fmt.Errorf("working dir is not writable: %w", err)
+		}
+		_, err = f.WriteString("probe")
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if removeErr := os.Remove(f.Name()); err == nil {
+			err = removeErr
+		}
+		if err != nil {
+			return fmt.Errorf("working dir is not writable: %w", err)
+		}
+
+		free, err := freeSpace(dir)
+		if errors.Is(err, errFreeSpaceNotSupported) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("error getting free space of working dir: %w", err)
+		}
+		if free < minFreeSpace {
+			return fmt.Errorf("working dir has %d MB free, %d MB required", free>>20, minFreeSpace>>20)
+		}
+		return nil
+	}
+}
+
+// Heartbeat checks that lastBeat is at most maxAge ago, for background routines which beat while they are alive
+func Heartbeat(lastBeat func() time.Time, maxAge time.Duration) CheckFunc {
+	return func(ctx context.Context) error {
+		last := lastBeat()
+		if last.IsZero() {
+			return errors.New("not started")
+		}
+		if age := time.Since(last); age > maxAge {
+			return fmt.Errorf("last heartbeat %s ago", age.Round(time.Second))
+		}
+		return nil
+	}
+}
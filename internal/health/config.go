@@ -0,0 +1,54 @@
+package health
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Check names, the database checks are named db:{cluster} and gated by CheckDB
+const (
+	CheckDB         = "db"
+	CheckWorkingDir = "workingDir"
+	CheckStorage    = "storage"
+	CheckScheduler  = "scheduler"
+)
+
+var checkNames = map[string]bool{
+	CheckDB:         true,
+	CheckWorkingDir: true,
+	CheckStorage:    true,
+	CheckScheduler:  true,
+}
+
+type Config struct {
+	// ReadinessChecks are the checks which gate readiness, all of them when empty. The other checks are reported
+	// but don't fail the probe.
+	ReadinessChecks []string
+	// MinFreeSpaceInMB is the free space the working dir needs to be ready, defaults to 1024
+	MinFreeSpaceInMB int
+	// TimeoutInSeconds of each check, defaults to 3
+	TimeoutInSeconds int
+}
+
+func (c Config) Assert() error {
+	for _, name := range c.ReadinessChecks {
+		if !checkNames[name] {
+			return fmt.Errorf("unknown check %q in c.ReadinessChecks", name)
+		}
+	}
+	if c.MinFreeSpaceInMB < 0 {
+		return errors.New("c.MinFreeSpaceInMB must not be negative")
+	}
+	if c.TimeoutInSeconds < 0 {
+		return errors.New("c.TimeoutInSeconds must not be negative")
+	}
+	return nil
+}
+
+// MinFreeSpace returns the free space the working dir needs in bytes
+func (c Config) MinFreeSpace() uint64 {
+	if c.MinFreeSpaceInMB == 0 {
+		return 1024 << 20
+	}
+	return uint64(c.MinFreeSpaceInMB) << 20
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package health
+
+// freeSpace is not supported on this platform, the free space threshold is not checked
+func freeSpace(string) (uint64, error) {
+	return 0, errFreeSpaceNotSupported
+}
@@ -0,0 +1,17 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package health
+
+import (
+	"syscall"
+)
+
+// freeSpace returns the bytes available to unprivileged users in the file system of dir
+func freeSpace(dir string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
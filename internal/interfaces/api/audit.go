@@ -0,0 +1,232 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/audit"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/auth"
+	"go.opentelemetry.io/otel/trace"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultAuditLimit is the maximum number of records returned by /audit without limit parameter
+const defaultAuditLimit = 1000
+
+// webdavReadMethods are not audited on the WebDAV mount, downloads with GET are
+var webdavReadMethods = map[string]bool{
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	"PROPFIND":         true,
+}
+
+// readMethods only read the routes which audit their operations
+var readMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+}
+
+// webdavRead reports whether r only reads the WebDAV mount
+func webdavRead(r *http.Request) bool {
+	return webdavReadMethods[r.Method]
+}
+
+// jobRead reports whether r only reads /, /{id} or /{id}/events, the operations of the jobs are audited with any
+// method
+func jobRead(r *http.Request) bool {
+	elements := pathElements(r)
+	return readMethods[r.Method] && (len(elements) <= 1 || (len(elements) == 2 && elements[1] == "events"))
+}
+
+// clusterRead reports whether r only reads / or /{cluster}/health, the backups and restores are audited with any
+// method
+func clusterRead(r *http.Request) bool {
+	elements := pathElements(r)
+	return readMethods[r.Method] && (len(elements) == 0 || (len(elements) == 2 && elements[1] == "health"))
+}
+
+// statusRecorder keeps the status code of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(statusCode int) {
+	if s.status == 0 {
+		s.status = statusCode
+	}
+	s.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// Status returns the status code of the response, 200 when nothing was written
+func (s *statusRecorder) Status() int {
+	if s.status == 0 {
+		return http.StatusOK
+	}
+	return s.status
+}
+
+// Flush supports streamed responses
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// audited records the requests passed to next in the audit log, except those for which read is true. A nil read
+// records every request.
+func (h *Handler) audited(read func(r *http.Request) bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if read != nil && read(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+
+		h.appendRecord(r, recorder.Status(), start)
+	})
+}
+
+// appendRecord records r, answered with status after it started at start, in the audit log
+func (h *Handler) appendRecord(r *http.Request, status int, start time.Time) {
+	result := audit.ResultSucceeded
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		result = audit.ResultDenied
+	case status >= http.StatusBadRequest:
+		result = audit.ResultFailed
+	}
+	remoteAddr, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remoteAddr = r.RemoteAddr
+	}
+	_ = h.auditLog.Append(audit.Record{
+		Actor:      h.actor(r),
+		RemoteAddr: remoteAddr,
+		Method:     r.Method,
+		// the original path, before the prefix of the route was stripped
+		Endpoint:   strings.SplitN(r.RequestURI, "?", 2)[0],
+		Params:     r.URL.Query(),
+		Status:     status,
+		Result:     result,
+		DurationMs: time.Since(start).Milliseconds(),
+		TraceID:    traceID(r.Context()),
+		RequestID:  requestID(r.Context()),
+	})
+}
+
+// auditDenied records r, denied with status, in the audit log unless audited records it already
+func (h *Handler) auditDenied(w http.ResponseWriter, r *http.Request, status int) {
+	if _, ok := w.(*statusRecorder); ok {
+		return
+	}
+	h.appendRecord(r, status, time.Now())
+}
+
+// denied answers r, denied with status, and records it in the audit log unless audited records it already
+func (h *Handler) denied(w http.ResponseWriter, r *http.Request, status int) {
+	h.auditDenied(w, r, status)
+	deniedResponse(w, r, status)
+}
+
+// Unauthorized answers r, rejected by the authenticator because it has no valid bearer token, and records it in the
+// audit log
+func (h *Handler) Unauthorized(w http.ResponseWriter, r *http.Request) {
+	h.appendRecord(r, http.StatusUnauthorized, time.Now())
+	deniedResponse(w, r, http.StatusUnauthorized)
+}
+
+// traceID returns the ID of the trace of ctx, empty when it is not traced
+func traceID(ctx context.Context) string {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return ""
+	}
+	return spanContext.TraceID().String()
+}
+
+// actor returns the name of the caller of r, the WebDAV user for requests without bearer token when they are
+// required to use one
+func (h *Handler) actor(r *http.Request) string {
+	identity, _ := auth.FromContext(r.Context())
+	if (identity.Unrestricted || identity.Unauthenticated) && h.webdavBasicAuth {
+		if user, _, ok := r.BasicAuth(); ok {
+			return user
+		}
+	}
+	return identity.Name
+}
+
+// auditQuery serves GET /audit with the optional filters actor, endpoint (prefix), result, since and until
+// (RFC 3339) and limit, returning the latest matching records. The chain of the whole log is verified.
+func (h *Handler) auditQuery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowedResponse(w)
+		return
+	}
+	query := r.URL.Query()
+	var since, until time.Time
+	var err error
+	if value := query.Get("since"); value != "" {
+		if since, err = time.Parse(time.RFC3339, value); err != nil {
+			badRequestResponse(w, codeInvalidParameter, "Invalid since")
+			return
+		}
+	}
+	if value := query.Get("until"); value != "" {
+		if until, err = time.Parse(time.RFC3339, value); err != nil {
+			badRequestResponse(w, codeInvalidParameter, "Invalid until")
+			return
+		}
+	}
+	limit := defaultAuditLimit
+	if value := query.Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 {
+			badRequestResponse(w, codeInvalidParameter, "Invalid limit")
+			return
+		}
+	}
+
+	records, err := h.auditLog.Query(func(record audit.Record) bool {
+		return (query.Get("actor") == "" || record.Actor == query.Get("actor")) &&
+			strings.HasPrefix(record.Endpoint, query.Get("endpoint")) &&
+			(query.Get("result") == "" || record.Result == query.Get("result")) &&
+			(since.IsZero() || !record.Time.Before(since)) &&
+			(until.IsZero() || record.Time.Before(until))
+	})
+	var chainErr *audit.ChainError
+	if err != nil && !errors.As(err, &chainErr) {
+		internalServerErrResponse(w, "Some Error Occurred (while reading the audit log)")
+		return
+	}
+	if len(records) > limit {
+		records = records[len(records)-limit:]
+	}
+	if records == nil {
+		records = []audit.Record{}
+	}
+
+	resp := struct {
+		Verified bool           `json:"verified"`
+		Error    string         `json:"error,omitempty"`
+		Records  []audit.Record `json:"records"`
+	}{Verified: chainErr == nil, Records: records}
+	if chainErr != nil {
+		resp.Error = chainErr.Error()
+	}
+	jsonResponse(w, http.StatusOK, resp)
+}
@@ -0,0 +1,226 @@
+package api
+
+import (
+	"context"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/app"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/auth"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/cluster"
+	"go.uber.org/zap"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// permission returns the action a request performs and the collection of the cluster it is performed on. An
+// empty collection is an action on the cluster, an empty cluster an action on the service.
+type permission func(r *http.Request) (action auth.Action, clusterName string, collection string)
+
+// authorize only passes requests to next when the caller is allowed to perform the action returned by permission
+func (h *Handler) authorize(permission permission, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		action, clusterName, collection := permission(r)
+		identity, ok := auth.FromContext(r.Context())
+		if !ok || !identity.Allowed(action, clusterName, collection) {
+			h.logger.Warn("authorize: access denied",
+				zap.String("actor", identity.Name),
+				zap.String("remoteAddr", r.RemoteAddr),
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.Path),
+				zap.String("action", string(action)),
+				zap.String("cluster", clusterName),
+				zap.String("collection", collection))
+			h.auditDenied(w, r, http.StatusForbidden)
+			errorResponse(w, http.StatusForbidden, codeForbidden, "Forbidden")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authorizePublic is authorize for the routes which may be published, their requests are passed to next without
+// authorization when their path doesn't require a bearer token
+func (h *Handler) authorizePublic(permission permission, next http.Handler) http.Handler {
+	authorized := h.authorize(permission, next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if identity, ok := auth.FromContext(r.Context()); ok && identity.Unauthenticated {
+			next.ServeHTTP(w, r)
+			return
+		}
+		authorized.ServeHTTP(w, r)
+	})
+}
+
+// inScope returns true when the collection of the cluster is in the scope of the caller of ctx
+func inScope(ctx context.Context, clusterName string, collection string) bool {
+	identity, ok := auth.FromContext(ctx)
+	return ok && identity.InScope(clusterName, collection)
+}
+
+// pathElements returns the non-empty elements of the path of r
+func pathElements(r *http.Request) []string {
+	var elements []string
+	for _, element := range strings.Split(r.URL.Path, "/") {
+		if element != "" {
+			elements = append(elements, element)
+		}
+	}
+	return elements
+}
+
+// crdbBackupPermission backs up /{collection} of the default cluster
+func crdbBackupPermission(r *http.Request) (auth.Action, string, string) {
+	return auth.ActionBackup, cluster.DefaultName, path.Base(r.URL.Path)
+}
+
+// ingestPermission backs up /{collection} of the ingest cluster
+func ingestPermission(r *http.Request) (auth.Action, string, string) {
+	return auth.ActionBackup, cluster.IngestName, path.Base(r.URL.Path)
+}
+
+// adminPermission administers the service
+func adminPermission(_ *http.Request) (auth.Action, string, string) {
+	return auth.ActionAdmin, "", ""
+}
+
+// readPermission reads the service
+func readPermission(_ *http.Request) (auth.Action, string, string) {
+	return auth.ActionRead, "", ""
+}
+
+// webdavPermission reads /{cluster}/{collection}/... with the read-only WebDAV methods and backs it up with
+// all others (PUT, DELETE, MKCOL, ...)
+func webdavPermission(r *http.Request) (auth.Action, string, string) {
+	action := auth.ActionBackup
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, "PROPFIND":
+		action = auth.ActionRead
+	}
+	elements := append(pathElements(r), "", "")
+	return action, elements[0], elements[1]
+}
+
+// webdavScope only passes WebDAV requests to next when their whole scope is allowed to the caller: changes need
+// the collection of the cluster they are made in, listings of the mount or of a cluster need all its collections
+// in scope, and COPY and MOVE need the backup action on the collection of their Destination as well
+func (h *Handler) webdavScope(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, _ := auth.FromContext(r.Context())
+		elements := pathElements(r)
+		action, clusterName, _ := webdavPermission(r)
+		allowed := true
+		switch {
+		case action != auth.ActionRead && len(elements) < 2:
+			allowed = false
+		case action == auth.ActionRead && r.Method != http.MethodOptions && len(elements) < 2:
+			allowed = identity.Covers(clusterName)
+		}
+		if destination := r.Header.Get("Destination"); allowed && destination != "" {
+			elements := destinationElements(destination)
+			allowed = len(elements) >= 2 && identity.Allowed(auth.ActionBackup, elements[0], elements[1])
+		}
+		if !allowed {
+			h.logger.Warn("webdavScope: access denied",
+				zap.String("actor", identity.Name),
+				zap.String("remoteAddr", r.RemoteAddr),
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.Path),
+				zap.String("destination", r.Header.Get("Destination")))
+			h.auditDenied(w, r, http.StatusForbidden)
+			errorResponse(w, http.StatusForbidden, codeForbidden, "Forbidden")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// destinationElements returns the non-empty elements of the path of the Destination header of a WebDAV request,
+// nil when it is no URL
+func destinationElements(destination string) []string {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return nil
+	}
+	return pathElements(&http.Request{URL: u})
+}
+
+// fromBucketPermission restores /{cluster}_{collection}_{year}_... from the bucket
+func fromBucketPermission(r *http.Request) (auth.Action, string, string) {
+	return objectPermission(auth.ActionRestore, r)
+}
+
+// verifyPermission reads /{cluster}_{collection}_{year}_... from the bucket to verify it
+func verifyPermission(r *http.Request) (auth.Action, string, string) {
+	return objectPermission(auth.ActionRead, r)
+}
+
+// objectPermission performs action on the collection of the object /{cluster}_{collection}_{year}_...
+func objectPermission(action auth.Action, r *http.Request) (auth.Action, string, string) {
+	clusterName, collection := app.ObjectCollection(path.Base(r.URL.Path))
+	if clusterName == "" {
+		// not a backup name, an empty cluster would not be limited by the scope
+		return action, "/", "/"
+	}
+	return action, clusterName, collection
+}
+
+// clusterPermission reads /, /{cluster}/health, backs up /{cluster}/backup/{collection} and restores
+// /{cluster}/restore/{collection}
+func clusterPermission(r *http.Request) (auth.Action, string, string) {
+	elements := pathElements(r)
+	switch {
+	case len(elements) == 3 && elements[1] == "backup":
+		return auth.ActionBackup, elements[0], elements[2]
+	case len(elements) == 3 && elements[1] == "restore":
+		return auth.ActionRestore, elements[0], elements[2]
+	case len(elements) > 0:
+		return auth.ActionRead, elements[0], ""
+	}
+	return auth.ActionRead, "", ""
+}
+
+// jobPermission reads /{id} and /{id}/events and controls /{id}/{operation} as backup or restore, in the collection
+// of the job
+func (h *Handler) jobPermission(r *http.Request) (auth.Action, string, string) {
+	elements := pathElements(r)
+	if len(elements) == 0 {
+		return auth.ActionRead, "", ""
+	}
+	job, ok := h.jobs.Get(elements[0])
+	if !ok {
+		return auth.ActionRead, "", ""
+	}
+	action := auth.ActionRead
+	if len(elements) > 1 && elements[1] != "events" {
+		action = auth.ActionBackup
+		if job.Kind == app.JobRestore {
+			action = auth.ActionRestore
+		}
+	}
+	return action, job.Cluster, job.Collection
+}
+
+// caller is the identity of the caller of GET /me
+type caller struct {
+	Name        string        `json:"name"`
+	Roles       []string      `json:"roles"`
+	Collections []string      `json:"collections"`
+	Actions     []auth.Action `json:"actions"`
+}
+
+// me serves GET /me with the identity of the caller and the actions it may perform on the collections in its scope,
+// so clients like the web UI only offer these
+func (h *Handler) me(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowedResponse(w)
+		return
+	}
+	identity, _ := auth.FromContext(r.Context())
+	me := caller{Name: identity.Name, Roles: identity.Roles, Collections: identity.Collections, Actions: []auth.Action{}}
+	for _, action := range []auth.Action{auth.ActionRead, auth.ActionBackup, auth.ActionRestore, auth.ActionAdmin} {
+		if identity.Allowed(action, "", "") {
+			me.Actions = append(me.Actions, action)
+		}
+	}
+	jsonResponse(w, http.StatusOK, me)
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/app"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/gcp"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/tracing"
+	"go.uber.org/zap"
+	"net/http"
+	"os"
+	"path"
+	"time"
+)
+
+// bucketObjects serves GET /bucket with the optional prefix parameter, listing the backups in the bucket in the
+// scope of the caller
+func (h *Handler) bucketObjects(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowedResponse(w)
+		return
+	}
+	if !h.gcpIntegration {
+		errorResponse(w, http.StatusNotImplemented, codeNotSupported, "The GCP integration is disabled")
+		return
+	}
+
+	objects, err := h.gcsIntegrator.List(r.Context(), r.URL.Query().Get("prefix"))
+	if err != nil {
+		internalServerErrResponse(w, "Some Error Occurred (while listing the bucket)")
+		return
+	}
+	inScopeObjects := make([]gcp.Object, 0, len(objects))
+	for _, object := range objects {
+		clusterName, collection := app.ObjectCollection(object.Name)
+		if clusterName == "" || !inScope(r.Context(), clusterName, collection) {
+			continue
+		}
+		inScopeObjects = append(inScopeObjects, object)
+	}
+	jsonResponse(w, http.StatusOK, inScopeObjects)
+}
+
+// verify serves POST /verify/{object}, starting a job which downloads the object, decrypts it and reads the files
+// of its zip. A failed verification is notified as verification.failed.
+func (h *Handler) verify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowedResponse(w)
+		return
+	}
+	if !h.gcpIntegration {
+		errorResponse(w, http.StatusNotImplemented, codeNotSupported, "The GCP integration is disabled")
+		return
+	}
+	object := path.Base(r.URL.Path)
+	clusterName, collection := app.ObjectCollection(object)
+	if clusterName == "" {
+		badRequestResponse(w, codeInvalidName, "Invalid object name")
+		return
+	}
+
+	ctx, span := h.startJobSpan(r.Context(), app.JobVerify, clusterName, collection)
+	job, _ := h.jobs.Update(h.jobs.Create(app.JobVerify, clusterName, collection, 0).ID, func(j *app.Job) {
+		j.Object = object
+	})
+	h.runJob(ctx, span, job.ID, func(ctx context.Context) {
+		h.verifyJob(ctx, job)
+	})
+	jsonResponse(w, http.StatusAccepted, map[string]string{"message": "Verification job started", "jobId": job.ID})
+}
+
+// verifyJob downloads and verifies the object of a verify job
+func (h *Handler) verifyJob(ctx context.Context, job app.Job) {
+	logger := h.logger.With(tracing.LogFields(ctx)...)
+	semErr := h.sem.Acquire(ctx, 1)
+	if semErr != nil {
+		h.failJob(ctx, job.ID, fmt.Errorf("unable to obtain local semaphore: %v", semErr))
+		return
+	}
+	defer h.sem.Release(1)
+
+	start := time.Now()
+	downloaded, err := h.gcsIntegrator.DownloadFromBucket(job.Object)
+	if err != nil {
+		h.failJob(ctx, job.ID, err)
+		return
+	}
+	defer os.Remove(downloaded)
+	h.observeFileStage(ctx, string(app.StageDownload), start, downloaded)
+
+	h.setJobStage(job.ID, app.StageVerify)
+	files, size, err := h.encryptor.Verify(downloaded)
+	if err != nil {
+		logger.Warn("verifyJob: verification failed", zap.String("object", job.Object), zap.Error(err))
+		h.failJob(ctx, job.ID, err)
+		return
+	}
+	logger.Info("verifyJob: object verified", zap.String("object", job.Object), zap.Int("files", files), zap.Int64("bytes", size))
+	h.finishJob(ctx, job.ID)
+}
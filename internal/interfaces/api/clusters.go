@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// clusterHealthTimeout limits the time spent pinging a single cluster
+const clusterHealthTimeout = 5 * time.Second
+
+type clusterHealth struct {
+	Name    string `json:"name"`
+	Engine  string `json:"engine,omitempty"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// clusterRoutes serves:
+//
+//	GET /clusters                               list the configured clusters with their health
+//	GET /clusters/{name}/health                 check the health of a cluster
+//	POST /clusters/{name}/backup/{collection}   trigger a backup of a cluster into a collection
+//	POST /clusters/{name}/restore/{collection}  restore a backup of a collection into a cluster
+func (h *Handler) clusterRoutes(w http.ResponseWriter, r *http.Request) {
+	elements := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(elements) == 1 && elements[0] == "":
+		health := make([]clusterHealth, 0)
+		for _, name := range h.clusters.Names() {
+			if !inScope(r.Context(), name, "") {
+				continue
+			}
+			health = append(health, h.clusterHealth(r.Context(), name))
+		}
+		jsonResponse(w, http.StatusOK, health)
+	case len(elements) == 2 && elements[1] == "health":
+		if _, ok := h.clusters.Get(elements[0]); !ok {
+			errorResponse(w, http.StatusNotFound, codeClusterNotFound, "Cluster not found")
+			return
+		}
+		health := h.clusterHealth(r.Context(), elements[0])
+		if health.Status != "ok" {
+			jsonResponse(w, http.StatusServiceUnavailable, health)
+			return
+		}
+		jsonResponse(w, http.StatusOK, health)
+	case len(elements) == 3 && elements[1] == "backup":
+		h.triggerBackup(w, r, elements[0], elements[2])
+	case len(elements) == 3 && elements[1] == "restore":
+		h.triggerRestore(w, r, elements[0], elements[2])
+	default:
+		badRequestResponse(w, codeBadRequest, "Invalid request")
+	}
+}
+
+func (h *Handler) clusterHealth(ctx context.Context, name string) clusterHealth {
+	engine, ok := h.clusters.Get(name)
+	if !ok {
+		return clusterHealth{Name: name, Status: "unknown"}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, clusterHealthTimeout)
+	defer cancel()
+	if err := engine.Ping(ctx); err != nil {
+		h.logger.Warn("clusterHealth: cluster is unavailable", zap.String("cluster", name), zap.Error(err))
+		return clusterHealth{Name: name, Engine: engine.Name(), Status: "unavailable", Message: err.Error()}
+	}
+	return clusterHealth{Name: name, Engine: engine.Name(), Status: "ok"}
+}
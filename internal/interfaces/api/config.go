@@ -3,15 +3,38 @@ package api
 import (
 	"errors"
 	"fmt"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/pkg/server"
 	"net/url"
+	"time"
 )
 
+// minIngestRate is the upload rate in bytes per second at which MaxIngestSizeInMB must be reachable within the read
+// and write timeouts of the server, which also apply to the uploads to the ingest endpoint
+const minIngestRate = 10 << 20
+
 type Config struct {
 	// The public URL where this application is being served. Must not end in a slash.
 	// A request to this URL must hit our http.Server listening on Listen
 	BaseURL string
 	// Addr for the HTTP server to listen on for inbound requests
 	Listen string
+	// GRPCListen is the addr for the gRPC API to listen on, the gRPC API is disabled when empty
+	GRPCListen string
+	// TLS of the server, plain HTTP when no certificate is configured. The gRPC API uses the same certificate.
+	TLS server.TLSConfig
+	// WebDAVBasicAuth requires the WebDAV credentials of a cluster for its backups, unless the request was
+	// authenticated with a bearer token
+	WebDAVBasicAuth bool
+	// JobPollIntervalInSeconds interval to poll the status of detached CRDB jobs, defaults to 5
+	JobPollIntervalInSeconds int
+	// MaxIngestSizeInMB maximum size of an artifact uploaded to the ingest endpoint, defaults to the size uploaded at
+	// 10 MB/s within the read and write timeouts (50 by default). The timeouts must allow such an upload.
+	MaxIngestSizeInMB int
+	// ReadTimeoutInSeconds maximum duration for reading a request including its body, defaults to 5
+	ReadTimeoutInSeconds int
+	// WriteTimeoutInSeconds maximum duration from the end of the request headers to the end of the response,
+	// defaults to 10
+	WriteTimeoutInSeconds int
 }
 
 func (c Config) Assert() error {
@@ -24,9 +47,73 @@ func (c Config) Assert() error {
 		return errors.New("BaseURL must be absolute")
 	} else if baseURL.Opaque != "" {
 		return errors.New("BaseURL must not be opaque")
+	} else if baseURL.Scheme != "http" && baseURL.Scheme != "https" {
+		return errors.New("BaseURL must be an http or https URL")
+	} else if c.TLS.Enabled() && baseURL.Scheme != "https" {
+		// CRDB is told to write the backups to BaseURL, it must not fall back to plain HTTP
+		return errors.New("BaseURL must be an https URL when TLS is enabled")
 	}
 	if c.Listen == "" {
 		return errors.New("c.Listen can't be empty")
 	}
+	if c.GRPCListen != "" && c.GRPCListen == c.Listen {
+		return errors.New("c.GRPCListen can't be the same as c.Listen")
+	}
+	if err := c.TLS.Assert(); err != nil {
+		return fmt.Errorf("%w in TLS Config", err)
+	}
+	if c.JobPollIntervalInSeconds < 0 {
+		return errors.New("c.JobPollIntervalInSeconds can't be negative")
+	}
+	if c.MaxIngestSizeInMB < 0 {
+		return errors.New("c.MaxIngestSizeInMB can't be negative")
+	}
+	if c.ReadTimeoutInSeconds < 0 || c.WriteTimeoutInSeconds < 0 {
+		return errors.New("c.ReadTimeoutInSeconds and c.WriteTimeoutInSeconds can't be negative")
+	}
+	if seconds := (c.MaxIngestSize() + minIngestRate - 1) / minIngestRate; time.Duration(seconds)*time.Second > c.uploadTimeout() {
+		return fmt.Errorf("c.ReadTimeoutInSeconds and c.WriteTimeoutInSeconds must be at least %d to upload c.MaxIngestSizeInMB at 10 MB/s", seconds)
+	}
 	return nil
 }
+
+// JobPollInterval returns the interval to poll the status of detached CRDB jobs
+func (c Config) JobPollInterval() time.Duration {
+	if c.JobPollIntervalInSeconds == 0 {
+		return 5 * time.Second
+	}
+	return time.Duration(c.JobPollIntervalInSeconds) * time.Second
+}
+
+// MaxIngestSize returns the maximum size in bytes of an artifact uploaded to the ingest endpoint
+func (c Config) MaxIngestSize() int64 {
+	if c.MaxIngestSizeInMB == 0 {
+		return int64(c.uploadTimeout()/time.Second) * minIngestRate
+	}
+	return int64(c.MaxIngestSizeInMB) << 20
+}
+
+// uploadTimeout returns the maximum duration of an upload, which is limited by both the read timeout of its body and
+// the write timeout of its response
+func (c Config) uploadTimeout() time.Duration {
+	if c.ReadTimeout() < c.WriteTimeout() {
+		return c.ReadTimeout()
+	}
+	return c.WriteTimeout()
+}
+
+// ReadTimeout returns the maximum duration for reading a request including its body
+func (c Config) ReadTimeout() time.Duration {
+	if c.ReadTimeoutInSeconds == 0 {
+		return 5 * time.Second
+	}
+	return time.Duration(c.ReadTimeoutInSeconds) * time.Second
+}
+
+// WriteTimeout returns the maximum duration before timing out writes of a response
+func (c Config) WriteTimeout() time.Duration {
+	if c.WriteTimeoutInSeconds == 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(c.WriteTimeoutInSeconds) * time.Second
+}
@@ -0,0 +1,416 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/app"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/audit"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/auth"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/cluster"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/metrics"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/notify"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/tracing"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/watchdog"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/pkg/webdav"
+	"go.uber.org/zap"
+	"golang.org/x/sync/semaphore"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testRequestID is sent with every request, the error responses must return it
+const testRequestID = "contract-test"
+
+// testTokens are the bearer tokens accepted by the test server by name
+var testTokens = map[string]auth.Token{
+	"admin":  {Roles: []string{auth.RoleAdmin}},
+	"reader": {Roles: []string{auth.RoleReader}, Collections: []string{cluster.DefaultName + "/payments"}},
+}
+
+// testEngine is a healthy cluster which fails every job
+type testEngine struct{}
+
+func (testEngine) Name() string                   { return cluster.EngineCRDB }
+func (testEngine) Ping(ctx context.Context) error { return nil }
+func (testEngine) StartBackup(string, []byte) (cluster.JobRef, error) {
+	return cluster.JobRef{}, errors.New("not implemented")
+}
+func (testEngine) StartRestore(string, string, []byte) (cluster.JobRef, error) {
+	return cluster.JobRef{}, errors.New("not implemented")
+}
+func (testEngine) Job(context.Context, int64) (cluster.JobStatus, error) {
+	return cluster.JobStatus{}, errors.New("not implemented")
+}
+func (testEngine) WaitForJob(context.Context, int64, time.Duration, func(cluster.JobStatus)) (cluster.JobStatus, error) {
+	return cluster.JobStatus{}, errors.New("not implemented")
+}
+func (testEngine) PauseJob(context.Context, int64) error  { return errors.New("not implemented") }
+func (testEngine) ResumeJob(context.Context, int64) error { return errors.New("not implemented") }
+func (testEngine) CancelJob(context.Context, int64) error { return errors.New("not implemented") }
+
+// testServer returns the API with authentication as it is served, without GCP integration, and the WebDAV
+// credentials of the default cluster
+func testServer(t *testing.T) (http.Handler, webdav.Credentials) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	logger := zap.NewNop()
+	workingDir := t.TempDir()
+
+	tokens := make(map[string]auth.Token, len(testTokens))
+	for name, token := range testTokens {
+		hash := sha256.Sum256([]byte(name + "-token"))
+		token.SHA256 = hex.EncodeToString(hash[:])
+		tokens[name] = token
+	}
+	authenticator, err := auth.NewAuthenticator(logger, auth.Config{Enabled: true, Tokens: tokens, ExceptPaths: []string{endpointBackups}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	appMetrics := metrics.NewMetrics(workingDir)
+	sem := appMetrics.Semaphore(semaphore.NewWeighted(10))
+	fileSystemWrapper := app.NewFileSystemWrapper(ctx, logger, workingDir)
+	clusters := cluster.NewRegistry()
+	clusters.Add(cluster.DefaultName, testEngine{})
+	credentials := webdav.Credentials{User: "crdb", Password: "webdav-password"}
+	webdavWrapper := webdav.NewWrapper(logger, fileSystemWrapper.PathBackups(), map[string]webdav.Credentials{cluster.DefaultName: credentials})
+	catalog := app.NewCatalog(logger, fileSystemWrapper.PathCatalog())
+	auditLog, err := audit.NewLog(logger, fileSystemWrapper.PathAudit())
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifier := notify.NewDispatcher(logger)
+	mux := http.NewServeMux()
+	handler := RegisterHandler(ctx, logger, false, sem, clusters, webdavWrapper,
+		app.NewZipper(ctx, logger, sem, fileSystemWrapper),
+		app.NewEncryptor(ctx, logger, sem, fileSystemWrapper.PathEncrypted(), fileSystemWrapper.PathDecrypted()),
+		nil, fileSystemWrapper, app.NewJobs(), catalog, auditLog, appMetrics, notifier,
+		watchdog.NewWatchdog(logger, watchdog.Config{}, catalog, appMetrics, notifier),
+		Config{WebDAVBasicAuth: true}, mux)
+	return RequestID(tracing.Middleware(authenticator.Middleware(mux, http.HandlerFunc(handler.Unauthorized)))), credentials
+}
+
+// openAPIDocument is the part of openapi.json the responses are checked against
+type openAPIDocument struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas   map[string]json.RawMessage `json:"schemas"`
+		Responses map[string]json.RawMessage `json:"responses"`
+	} `json:"components"`
+}
+
+type openAPIOperation struct {
+	Responses map[string]json.RawMessage `json:"responses"`
+}
+
+type openAPIResponse struct {
+	Ref     string `json:"$ref"`
+	Content map[string]struct {
+		Schema json.RawMessage `json:"schema"`
+	} `json:"content"`
+}
+
+type openAPISchema struct {
+	Ref                  string                     `json:"$ref"`
+	Type                 string                     `json:"type"`
+	Format               string                     `json:"format"`
+	Enum                 []interface{}              `json:"enum"`
+	Required             []string                   `json:"required"`
+	Properties           map[string]json.RawMessage `json:"properties"`
+	Items                json.RawMessage            `json:"items"`
+	AdditionalProperties json.RawMessage            `json:"additionalProperties"`
+}
+
+func loadOpenAPI(t *testing.T) *openAPIDocument {
+	var doc openAPIDocument
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		t.Fatalf("openapi.json is invalid: %v", err)
+	}
+	return &doc
+}
+
+// response returns the documented response of the operation for status
+func (d *openAPIDocument) response(path string, method string, status int) (openAPIResponse, error) {
+	var op openAPIOperation
+	raw, ok := d.Paths[path][strings.ToLower(method)]
+	if !ok {
+		return openAPIResponse{}, fmt.Errorf("%s %s is not documented", method, path)
+	}
+	if err := json.Unmarshal(raw, &op); err != nil {
+		return openAPIResponse{}, err
+	}
+	raw, ok = op.Responses[strconv.Itoa(status)]
+	if !ok {
+		return openAPIResponse{}, fmt.Errorf("status %d of %s %s is not documented", status, method, path)
+	}
+	var response openAPIResponse
+	if err := json.Unmarshal(raw, &response); err != nil {
+		return openAPIResponse{}, err
+	}
+	if response.Ref != "" {
+		raw, ok = d.Components.Responses[strings.TrimPrefix(response.Ref, "#/components/responses/")]
+		if !ok {
+			return openAPIResponse{}, fmt.Errorf("unknown response %s", response.Ref)
+		}
+		response = openAPIResponse{}
+		if err := json.Unmarshal(raw, &response); err != nil {
+			return openAPIResponse{}, err
+		}
+	}
+	return response, nil
+}
+
+// validate returns the differences between value and the schema raw, at is the location of value
+func (d *openAPIDocument) validate(raw json.RawMessage, value interface{}, at string) []string {
+	var schema openAPISchema
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		return []string{fmt.Sprintf("%s: invalid schema: %v", at, err)}
+	}
+	if schema.Ref != "" {
+		ref, ok := d.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+		if !ok {
+			return []string{fmt.Sprintf("%s: unknown schema %s", at, schema.Ref)}
+		}
+		return d.validate(ref, value, at)
+	}
+
+	var problems []string
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if schema.Type != "object" {
+			return []string{fmt.Sprintf("%s: is an object, want %s", at, schema.Type)}
+		}
+		for _, name := range schema.Required {
+			if _, ok := v[name]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: %s is required", at, name))
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			property, ok := schema.Properties[name]
+			if !ok {
+				property = schema.AdditionalProperties
+			}
+			if len(property) == 0 || string(property) == "false" {
+				if schema.Properties != nil || string(property) == "false" {
+					problems = append(problems, fmt.Sprintf("%s: %s is not documented", at, name))
+				}
+				continue
+			}
+			if string(property) == "true" {
+				continue
+			}
+			problems = append(problems, d.validate(property, v[name], at+"."+name)...)
+		}
+	case []interface{}:
+		if schema.Type != "array" {
+			return []string{fmt.Sprintf("%s: is an array, want %s", at, schema.Type)}
+		}
+		for i, item := range v {
+			problems = append(problems, d.validate(schema.Items, item, fmt.Sprintf("%s[%d]", at, i))...)
+		}
+	case string:
+		if schema.Type != "string" {
+			return []string{fmt.Sprintf("%s: is a string, want %s", at, schema.Type)}
+		}
+		if schema.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, v); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %q is not a date-time", at, v))
+			}
+		}
+	case float64:
+		if schema.Type != "number" && (schema.Type != "integer" || v != float64(int64(v))) {
+			return []string{fmt.Sprintf("%s: is the number %v, want %s", at, v, schema.Type)}
+		}
+	case bool:
+		if schema.Type != "boolean" {
+			return []string{fmt.Sprintf("%s: is a boolean, want %s", at, schema.Type)}
+		}
+	case nil:
+		return []string{fmt.Sprintf("%s: is null", at)}
+	}
+	if schema.Enum != nil {
+		found := false
+		for _, allowed := range schema.Enum {
+			if allowed == value {
+				found = true
+			}
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("%s: %v is not one of %v", at, value, schema.Enum))
+		}
+	}
+	return problems
+}
+
+// checkResponse checks the status, the content type and the body of a response against the documented response
+// of the operation, and the request ID of the error responses
+func (d *openAPIDocument) checkResponse(t *testing.T, path string, method string, recorder *httptest.ResponseRecorder) {
+	t.Helper()
+	response, err := d.response(path, method, recorder.Code)
+	if err != nil {
+		t.Fatalf("%v, body: %s", err, recorder.Body)
+	}
+	if len(response.Content) == 0 {
+		return
+	}
+	mediaType, _, err := mime.ParseMediaType(recorder.Header().Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("invalid Content-Type %q", recorder.Header().Get("Content-Type"))
+	}
+	content, ok := response.Content[mediaType]
+	if !ok {
+		t.Fatalf("Content-Type %s is not documented for status %d", mediaType, recorder.Code)
+	}
+	if mediaType != "application/json" || len(content.Schema) == 0 {
+		return
+	}
+	var body interface{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body is not JSON: %v: %s", err, recorder.Body)
+	}
+	for _, problem := range d.validate(content.Schema, body, "body") {
+		t.Error(problem)
+	}
+	if recorder.Code >= http.StatusBadRequest {
+		if id, _ := body.(map[string]interface{})["requestId"].(string); id != testRequestID {
+			t.Errorf("requestId is %q, want %q", id, testRequestID)
+		}
+	}
+}
+
+func TestContract(t *testing.T) {
+	doc := loadOpenAPI(t)
+	server, _ := testServer(t)
+
+	tests := []struct {
+		method string
+		target string
+		// path of the operation in openapi.json
+		path string
+		// documented is the method of the operation in openapi.json when it documents the responses to the other
+		// methods, e.g. 405
+		documented string
+		token      string
+		status     int
+		code       string
+	}{
+		{method: http.MethodGet, target: "/openapi.json", path: "/openapi.json", token: "reader", status: http.StatusOK},
+		{method: http.MethodGet, target: "/me", path: "/me", token: "reader", status: http.StatusOK},
+		{method: http.MethodGet, target: "/me", path: "/me", status: http.StatusUnauthorized, code: codeUnauthorized},
+		{method: http.MethodGet, target: "/me", path: "/me", token: "unknown", status: http.StatusUnauthorized, code: codeUnauthorized},
+		{method: http.MethodGet, target: "/listBackups", path: "/listBackups", token: "reader", status: http.StatusOK},
+		{method: http.MethodGet, target: "/status", path: "/status", token: "reader", status: http.StatusOK},
+		{method: http.MethodPost, target: "/status", path: "/status", documented: http.MethodGet, token: "reader", status: http.StatusMethodNotAllowed, code: codeMethodNotAllowed},
+		{method: http.MethodGet, target: "/audit", path: "/audit", token: "reader", status: http.StatusForbidden, code: codeForbidden},
+		{method: http.MethodGet, target: "/audit?limit=x", path: "/audit", token: "admin", status: http.StatusBadRequest, code: codeInvalidParameter},
+		{method: http.MethodGet, target: "/audit", path: "/audit", token: "admin", status: http.StatusOK},
+		{method: http.MethodGet, target: "/jobs/", path: "/jobs/", token: "reader", status: http.StatusOK},
+		{method: http.MethodGet, target: "/jobs/unknown", path: "/jobs/{id}", token: "admin", status: http.StatusNotFound, code: codeJobNotFound},
+		{method: http.MethodGet, target: "/clusters/", path: "/clusters/", token: "reader", status: http.StatusOK},
+		{method: http.MethodGet, target: "/clusters/default/health", path: "/clusters/{cluster}/health", token: "reader", status: http.StatusOK},
+		{method: http.MethodGet, target: "/clusters/unknown/health", path: "/clusters/{cluster}/health", token: "admin", status: http.StatusNotFound, code: codeClusterNotFound},
+		{method: http.MethodPost, target: "/clusters/default/backup/payments", path: "/clusters/{cluster}/backup/{collection}", token: "reader", status: http.StatusForbidden, code: codeForbidden},
+		{method: http.MethodPost, target: "/clusters/default/backup/payments", path: "/clusters/{cluster}/backup/{collection}", status: http.StatusUnauthorized, code: codeUnauthorized},
+		{method: http.MethodGet, target: "/clusters/default/backup/payments", path: "/clusters/{cluster}/backup/{collection}", documented: http.MethodPost, token: "admin", status: http.StatusMethodNotAllowed, code: codeMethodNotAllowed},
+		{method: http.MethodPost, target: "/crdbBackup/x", path: "/crdbBackup/{collection}", token: "reader", status: http.StatusForbidden, code: codeForbidden},
+		{method: http.MethodPost, target: "/ingest/payments", path: "/ingest/{collection}", token: "reader", status: http.StatusForbidden, code: codeForbidden},
+		{method: http.MethodGet, target: "/metrics", path: "/metrics", token: "reader", status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target+" "+tt.token, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.target, nil)
+			r.Header.Set(requestIDHeader, testRequestID)
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token+"-token")
+			}
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, r)
+
+			if recorder.Code != tt.status {
+				t.Fatalf("status is %d, want %d: %s", recorder.Code, tt.status, recorder.Body)
+			}
+			documented := tt.method
+			if tt.documented != "" {
+				documented = tt.documented
+			}
+			doc.checkResponse(t, tt.path, documented, recorder)
+			if tt.code != "" {
+				var body errorBody
+				_ = json.Unmarshal(recorder.Body.Bytes(), &body)
+				if body.Code != tt.code {
+					t.Errorf("code is %q, want %q", body.Code, tt.code)
+				}
+			}
+			if tt.status == http.StatusUnauthorized && !strings.HasPrefix(recorder.Header().Get("WWW-Authenticate"), "Bearer ") {
+				t.Errorf("WWW-Authenticate is %q", recorder.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+// TestContractErrors checks the responses outside of the documented operations, which use the error model too
+func TestContractErrors(t *testing.T) {
+	doc := loadOpenAPI(t)
+	server, credentials := testServer(t)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		user   string
+		status int
+		code   string
+	}{
+		{name: "unknown path", method: http.MethodGet, target: "/unknown", status: http.StatusNotFound, code: codeNotFound},
+		{name: "WebDAV without credentials", method: "PROPFIND", target: "/backups/default/payments", status: http.StatusUnauthorized, code: codeUnauthorized},
+		{name: "WebDAV with wrong credentials", method: http.MethodPut, target: "/backups/default/payments/x", user: "other", status: http.StatusUnauthorized, code: codeUnauthorized},
+		{name: "WebDAV write in a cluster", method: http.MethodDelete, target: "/backups/default", user: credentials.User, status: http.StatusForbidden, code: codeForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.target, nil)
+			r.Header.Set(requestIDHeader, testRequestID)
+			r.Header.Set("Authorization", "Bearer admin-token")
+			if tt.user != "" {
+				r.Header.Del("Authorization")
+				r.SetBasicAuth(tt.user, credentials.Password)
+			} else if strings.HasPrefix(tt.target, endpointBackups) {
+				r.Header.Del("Authorization")
+			}
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, r)
+
+			if recorder.Code != tt.status {
+				t.Fatalf("status is %d, want %d: %s", recorder.Code, tt.status, recorder.Body)
+			}
+			if contentType := recorder.Header().Get("Content-Type"); contentType != "application/json" {
+				t.Errorf("Content-Type is %q", contentType)
+			}
+			var body interface{}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+				t.Fatalf("body is not JSON: %v: %s", err, recorder.Body)
+			}
+			for _, problem := range doc.validate(json.RawMessage(`{"$ref": "#/components/schemas/Error"}`), body, "body") {
+				t.Error(problem)
+			}
+			if m, _ := body.(map[string]interface{}); m["code"] != tt.code || m["requestId"] != testRequestID {
+				t.Errorf("body is %v, want the code %s and the request ID %s", body, tt.code, testRequestID)
+			}
+		})
+	}
+}
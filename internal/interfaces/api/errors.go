@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"regexp"
+)
+
+// Codes of the error responses, clients act upon these rather than upon the messages
+const (
+	codeBadRequest       = "bad_request"
+	codeInvalidName      = "invalid_name"
+	codeInvalidOptions   = "invalid_options"
+	codeInvalidArtifact  = "invalid_artifact"
+	codeInvalidParameter = "invalid_parameter"
+	codeUnauthorized     = "unauthorized"
+	codeForbidden        = "forbidden"
+	codeNotFound         = "not_found"
+	codeClusterNotFound  = "cluster_not_found"
+	codeJobNotFound      = "job_not_found"
+	codeMethodNotAllowed = "method_not_allowed"
+	codeJobNotRunning    = "job_not_running"
+	codeNotSupported     = "not_supported"
+	codeBackupExists     = "backup_exists"
+	codeInternal         = "internal_error"
+)
+
+// requestIDHeader carries the ID of a request, set by the caller or generated by RequestID
+const requestIDHeader = "X-Request-Id"
+
+// validRequestID matches the request IDs accepted from the callers
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// errorBody is the body of every error response of the API
+type errorBody struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// Error is an error of an operation shared with the gRPC API, e.g. an unknown cluster or invalid options. The
+// other errors of these operations are internal errors.
+type Error struct {
+	// Status is the HTTP status of the error response
+	Status  int
+	Code    string
+	Message string
+}
+
+func newError(status int, code string, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// operationErrorResponse writes the error response of err returned by an operation, an internal error with the
+// given message unless err is an *Error
+func operationErrorResponse(w http.ResponseWriter, err error, internalMessage string) {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		errorResponse(w, apiErr.Status, apiErr.Code, apiErr.Message)
+		return
+	}
+	internalServerErrResponse(w, internalMessage)
+}
+
+// errorResponse writes an error response with the request ID set by RequestID
+func errorResponse(w http.ResponseWriter, statusCode int, code string, message string) {
+	jsonResponse(w, statusCode, errorBody{Code: code, Message: message, RequestID: w.Header().Get(requestIDHeader)})
+}
+
+func badRequestResponse(w http.ResponseWriter, code string, message string) {
+	errorResponse(w, http.StatusBadRequest, code, message)
+}
+
+func internalServerErrResponse(w http.ResponseWriter, message string) {
+	errorResponse(w, http.StatusInternalServerError, codeInternal, message)
+}
+
+// deniedResponse writes the error response of a request denied with the status 401 or 403
+func deniedResponse(w http.ResponseWriter, _ *http.Request, statusCode int) {
+	if statusCode == http.StatusUnauthorized {
+		errorResponse(w, statusCode, codeUnauthorized, "Unauthorized")
+		return
+	}
+	errorResponse(w, statusCode, codeForbidden, "Forbidden")
+}
+
+func methodNotAllowedResponse(w http.ResponseWriter) {
+	errorResponse(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, "Method not allowed")
+}
+
+type requestIDKey struct{}
+
+// RequestID identifies every request with the valid X-Request-Id of the caller, or a generated one. The ID is
+// returned in the X-Request-Id header and in error responses, and recorded in the audit log.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID.MatchString(id) {
+			b := make([]byte, 16)
+			_, _ = rand.Read(b)
+			id = hex.EncodeToString(b)
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// requestID returns the ID of the request of ctx, empty outside of RequestID
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// notFound serves the paths without route
+func notFound(w http.ResponseWriter, _ *http.Request) {
+	errorResponse(w, http.StatusNotFound, codeNotFound, "Not found")
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/app"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	// eventsRetry is the delay before clients reconnect to an event stream, which ends before the write timeout
+	eventsRetry = time.Second
+	// eventsKeepAlive is the maximum interval of the comments keeping an idle event stream open through proxies, it
+	// is shortened to fit in streams which end sooner
+	eventsKeepAlive = 15 * time.Second
+	// eventDone is the last event of a stream, with the finished job
+	eventDone = "done"
+)
+
+// jobEvents serves GET /jobs/{id}/events as a stream of server-sent events: the job when the stream starts, its
+// changes (job), stage transitions (stage) and the bytes processed by the stages of the pipeline (progress), until
+// it finished (done). The stream ends a second before the write timeout of the server, EventSource clients
+// reconnect after eventsRetry.
+func (h *Handler) jobEvents(w http.ResponseWriter, r *http.Request, id string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		internalServerErrResponse(w, "Streaming not supported")
+		return
+	}
+	job, events, cancel, ok := h.jobs.Subscribe(id)
+	if !ok {
+		errorResponse(w, http.StatusNotFound, codeJobNotFound, "Job not found")
+		return
+	}
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// disables the buffering of reverse proxies like nginx
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprintf(w, "retry: %d\n\n", eventsRetry.Milliseconds())
+	writeEvent(w, string(app.JobEventUpdated), job)
+	flusher.Flush()
+
+	streamDuration := h.writeTimeout - time.Second
+	if streamDuration < time.Second {
+		streamDuration = time.Second
+	}
+	deadline := time.NewTimer(streamDuration)
+	defer deadline.Stop()
+	keepAliveInterval := eventsKeepAlive
+	if keepAliveInterval > streamDuration/2 {
+		keepAliveInterval = streamDuration / 2
+	}
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-deadline.C:
+			return
+		case <-keepAlive.C:
+			_, _ = io.WriteString(w, ": keep-alive\n\n")
+		case event, more := <-events:
+			if !more {
+				// events may have been dropped, the final state is sent from the store
+				if job, ok := h.jobs.Get(id); ok && job.Finished() {
+					writeEvent(w, eventDone, job)
+				}
+				flusher.Flush()
+				return
+			}
+			if event.Type == app.JobEventProgress {
+				writeEvent(w, string(event.Type), event.Progress)
+			} else {
+				writeEvent(w, string(event.Type), event.Job)
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// writeEvent writes a server-sent event with data encoded as JSON
+func writeEvent(w io.Writer, event string, data interface{}) {
+	body, _ := json.Marshal(data)
+	_, _ = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, body)
+}
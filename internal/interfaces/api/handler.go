@@ -2,106 +2,399 @@ package api
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/app"
-	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/crdb"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/audit"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/auth"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/cluster"
 	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/gcp"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/metrics"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/notify"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/tracing"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/watchdog"
 	webdav2 "gitlab.cmpayments.local/payments-gateway/backupsmanager/pkg/webdav"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
-	"golang.org/x/sync/semaphore"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
+// maxOptionsSize limits the size of the JSON options accepted when triggering backups and restores
+const maxOptionsSize = 1 << 20
+
 type Handler struct {
 	ctx               context.Context
 	logger            *zap.Logger
-	sem               *semaphore.Weighted
+	sem               app.Semaphore
 	gcpIntegration    bool
-	crdbWrapper       *crdb.Wrapper
+	clusters          *cluster.Registry
 	webdavWrapper     *webdav2.Wrapper
 	zipper            *app.Zipper
 	encryptor         *app.Encryptor
 	gcsIntegrator     *gcp.GCSIntegrator
 	fileSystemWrapper *app.FileSystemWrapper
+	jobs              *app.Jobs
+	catalog           *app.Catalog
+	auditLog          *audit.Log
+	metrics           *metrics.Metrics
+	notifier          *notify.Dispatcher
+	watchdog          *watchdog.Watchdog
+	tracer            trace.Tracer
+	engineSpans       *spanRegistry
+	webdavBasicAuth   bool
+	jobPollInterval   time.Duration
+	maxIngestSize     int64
+	writeTimeout      time.Duration
 }
 
-func RegisterHandler(ctx context.Context, logger *zap.Logger, gcpIntegration bool, sem *semaphore.Weighted, crdbWrapper *crdb.Wrapper, webdavWrapper *webdav2.Wrapper, zipper *app.Zipper, encryptor *app.Encryptor, gcsIntegrator *gcp.GCSIntegrator, fileSystemWrapper *app.FileSystemWrapper, mux *http.ServeMux) {
+// RegisterHandler registers the routes of the API on mux and returns the Handler, whose backup and restore pipeline
+// is shared with the gRPC API
+func RegisterHandler(ctx context.Context, logger *zap.Logger, gcpIntegration bool, sem app.Semaphore, clusters *cluster.Registry, webdavWrapper *webdav2.Wrapper, zipper *app.Zipper, encryptor *app.Encryptor, gcsIntegrator *gcp.GCSIntegrator, fileSystemWrapper *app.FileSystemWrapper, jobs *app.Jobs, catalog *app.Catalog, auditLog *audit.Log, metrics *metrics.Metrics, notifier *notify.Dispatcher, watchdog *watchdog.Watchdog, config Config, mux *http.ServeMux) *Handler {
 	handler := &Handler{
 		ctx:               ctx,
 		logger:            logger,
 		sem:               sem,
 		gcpIntegration:    gcpIntegration,
-		crdbWrapper:       crdbWrapper,
+		clusters:          clusters,
 		webdavWrapper:     webdavWrapper,
 		zipper:            zipper,
 		encryptor:         encryptor,
 		gcsIntegrator:     gcsIntegrator,
 		fileSystemWrapper: fileSystemWrapper,
+		jobs:              jobs,
+		catalog:           catalog,
+		auditLog:          auditLog,
+		metrics:           metrics,
+		notifier:          notifier,
+		watchdog:          watchdog,
+		tracer:            tracing.Tracer(),
+		engineSpans:       newSpanRegistry(),
+		webdavBasicAuth:   config.WebDAVBasicAuth,
+		jobPollInterval:   config.JobPollInterval(),
+		maxIngestSize:     config.MaxIngestSize(),
+		writeTimeout:      config.WriteTimeout(),
+	}
+
+	// every route is authorized with the roles and collections of the caller, and its operations are audited
+	mux.Handle(endpointCRDBBackup, http.StripPrefix("/crdbBackup", handler.audited(nil, handler.authorize(crdbBackupPermission, handler.pathValidationInterceptor(http.HandlerFunc(handler.TriggerCRDBBackup))))))
+
+	// the WebDAV credentials of a cluster authorize the requests without bearer token
+	webdavHandler := handler.authorize(webdavPermission, handler.webdavScope(handler.backupsDirectoriesInterceptor(handler.webdavWrapper.Handler)))
+	if config.WebDAVBasicAuth {
+		webdavHandler = handler.webdavCredentialsInterceptor(webdavHandler)
 	}
+	mux.Handle(endpointBackups, http.StripPrefix("/backups", handler.stripDestinationPrefix("/backups", handler.webdavTracing(handler.webdavMetrics(handler.audited(webdavRead, webdavHandler))))))
+
+	mux.Handle(endpointFromBucket, http.StripPrefix("/fromBucket", handler.audited(nil, handler.authorize(fromBucketPermission, handler.pathValidationInterceptor(http.HandlerFunc(handler.fromBucket))))))
+
+	mux.Handle(endpointListBackups, handler.authorize(readPermission, http.HandlerFunc(handler.listBackups)))
+
+	mux.Handle(endpointJobs, http.StripPrefix("/jobs", handler.audited(jobRead, handler.authorize(handler.jobPermission, http.HandlerFunc(handler.job)))))
+
+	mux.Handle(endpointClusters, http.StripPrefix("/clusters", handler.audited(clusterRead, handler.authorize(clusterPermission, http.HandlerFunc(handler.clusterRoutes)))))
 
-	mux.Handle(endpointCRDBBackup, http.StripPrefix("/crdbBackup", handler.pathValidationInterceptor(http.HandlerFunc(handler.TriggerCRDBBackup))))
+	mux.Handle(endpointIngest, http.StripPrefix("/ingest", handler.audited(nil, handler.authorize(ingestPermission, handler.pathValidationInterceptor(http.HandlerFunc(handler.ingest))))))
 
-	mux.Handle(endpointBackups, http.StripPrefix("/backups", handler.backupsDirectoriesInterceptor(handler.webdavWrapper.Handler)))
+	mux.Handle(endpointAudit, handler.authorize(adminPermission, http.HandlerFunc(handler.auditQuery)))
 
-	mux.Handle(endpointFromBucket, http.StripPrefix("/fromBucket", handler.pathValidationInterceptor(http.HandlerFunc(handler.fromBucket))))
+	mux.Handle(endpointStatus, handler.authorize(readPermission, http.HandlerFunc(handler.status)))
 
-	mux.Handle(endpointListBackups, http.HandlerFunc(handler.listBackups))
+	// the metrics and the OpenAPI document may be published by listing them in Auth.ExceptPaths
+	mux.Handle(endpointMetrics, handler.authorizePublic(readPermission, metrics.Handler()))
+
+	mux.Handle(endpointOpenAPI, handler.authorizePublic(readPermission, http.HandlerFunc(handler.openAPI)))
+
+	mux.Handle(endpointBucket, handler.authorize(readPermission, http.HandlerFunc(handler.bucketObjects)))
+
+	mux.Handle(endpointVerify, http.StripPrefix("/verify", handler.audited(nil, handler.authorize(verifyPermission, handler.pathValidationInterceptor(http.HandlerFunc(handler.verify))))))
+
+	mux.Handle(endpointMe, handler.authorize(readPermission, http.HandlerFunc(handler.me)))
+
+	// the UI is not authenticated, it calls the API with the token of the user
+	mux.Handle(endpointUI, http.StripPrefix(endpointUI, uiHandler()))
+
+	// the paths without route respond with the error model of the API too
+	mux.HandleFunc("/", notFound)
+	return handler
 }
 
 func (h *Handler) pathValidationInterceptor(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if path.Base(r.URL.Path) == "/" || strings.Count(r.URL.Path, "/") != 1 {
-			w.WriteHeader(http.StatusBadRequest)
-			w.Header().Set("Content-Type", "application/json")
-			resp := make(map[string]string)
-			resp["message"] = "Invalid request"
-			jsonResp, _ := json.Marshal(resp)
-			_, _ = w.Write(jsonResp)
+			badRequestResponse(w, codeBadRequest, "Invalid request")
 			return
 		}
 		next.ServeHTTP(w, r)
 	})
 }
 
+// TriggerCRDBBackup triggers a backup of the collection in the path in the default cluster
 func (h *Handler) TriggerCRDBBackup(w http.ResponseWriter, r *http.Request) {
-	err := h.crdbWrapper.TriggerBackup(r.URL.Path)
+	h.triggerBackup(w, r, cluster.DefaultName, path.Base(r.URL.Path))
+}
+
+// triggerBackup triggers a backup of the cluster into the given collection
+func (h *Handler) triggerBackup(w http.ResponseWriter, r *http.Request, clusterName string, collection string) {
+	if r.Method != http.MethodPost {
+		methodNotAllowedResponse(w)
+		return
+	}
+
+	options, err := readOptions(w, r)
 	if err != nil {
-		internalServerErrResponse(w, "Some Error Occurred (while triggering TriggerCRDBBackup")
+		badRequestResponse(w, codeInvalidOptions, "Invalid backup options")
 		return
 	}
 
-	if h.gcpIntegration {
-		latest, err := ioutil.ReadFile(path.Join(h.fileSystemWrapper.PathBackups(), r.URL.Path, "LATEST"))
-		if err != nil {
-			h.logger.Error("TriggerCRDBBackup: error finding LATEST file", zap.Error(err))
-			internalServerErrResponse(w, "Some Error Occurred (while reading LATEST file from backups")
-			return
+	job, detached, err := h.StartBackup(r.Context(), clusterName, collection, options)
+	if err != nil {
+		operationErrorResponse(w, err, "Some Error Occurred (while triggering TriggerCRDBBackup)")
+		return
+	}
+	if detached {
+		jsonResponse(w, http.StatusAccepted, map[string]string{"message": "Backup job started", "jobId": job.ID})
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]string{"message": "Backup triggered successfully", "jobId": job.ID})
+}
+
+// StartBackup starts a backup of the cluster into the given collection with the engine specific JSON options and
+// returns its job, which is processed in the background. detached is true while the engine still runs the backup.
+// The caller must be authorized to back up the collection.
+func (h *Handler) StartBackup(ctx context.Context, clusterName string, collection string, options []byte) (job app.Job, detached bool, err error) {
+	engine, ok := h.clusters.Get(clusterName)
+	if !ok {
+		return app.Job{}, false, newError(http.StatusNotFound, codeClusterNotFound, "Cluster not found")
+	}
+	if !cluster.ValidName(collection) {
+		return app.Job{}, false, newError(http.StatusBadRequest, codeInvalidName, "Invalid collection name")
+	}
+
+	// the WebDAV requests of the engine are linked to the span of the job while the engine writes the backup
+	ctx, span := h.startJobSpan(ctx, app.JobBackup, clusterName, collection)
+	h.engineSpans.add(clusterName, collection, span.SpanContext())
+	_, startSpan := h.tracer.Start(ctx, "StartBackup")
+	jobRef, err := engine.StartBackup(collection, options)
+	tracing.End(startSpan, err)
+	if err != nil || !jobRef.Detached {
+		h.engineSpans.remove(clusterName, collection)
+	}
+	if err != nil {
+		tracing.End(span, err)
+		var optionsErr *cluster.OptionsError
+		if errors.As(err, &optionsErr) {
+			h.logger.Warn("StartBackup: invalid backup options", append(tracing.LogFields(ctx), zap.Error(err))...)
+			return app.Job{}, false, newError(http.StatusBadRequest, codeInvalidOptions, fmt.Sprintf("Invalid backup options: %v", err))
 		}
+		return app.Job{}, false, err
+	}
+	h.metrics.BackupTriggered(clusterName, collection)
 
-		latestBackupDir := path.Join(h.fileSystemWrapper.PathBackups(), r.URL.Path, string(latest))
-		if _, err := os.Stat(latestBackupDir); err != nil {
-			h.logger.Error("TriggerCRDBBackup: LATEST backup dir not found", zap.Error(err))
-			internalServerErrResponse(w, "Some Error Occurred (while getting LATEST backup")
-			return
+	job = h.jobs.Create(app.JobBackup, clusterName, collection, jobRef.ID)
+	if jobRef.Detached {
+		// the backup is still running, it is followed in the background and processed once it succeeds
+		h.runJob(ctx, span, job.ID, func(ctx context.Context) {
+			h.followJob(ctx, job)
+		})
+		return job, true, nil
+	}
+
+	// the backup already finished, it is processed in the background
+	h.runJob(ctx, span, job.ID, func(ctx context.Context) {
+		h.processBackupJob(ctx, job)
+	})
+	return job, false, nil
+}
+
+// triggerRestore starts a restore of a backup of the collection into the cluster. The backup query parameter
+// selects the backup (e.g. /2022/01/24-163045.99), the LATEST one is restored by default.
+func (h *Handler) triggerRestore(w http.ResponseWriter, r *http.Request, clusterName string, collection string) {
+	if _, ok := h.clusters.Get(clusterName); !ok {
+		errorResponse(w, http.StatusNotFound, codeClusterNotFound, "Cluster not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		methodNotAllowedResponse(w)
+		return
+	}
+
+	options, err := readOptions(w, r)
+	if err != nil {
+		badRequestResponse(w, codeInvalidOptions, "Invalid restore options")
+		return
+	}
+
+	job, detached, err := h.StartRestore(r.Context(), clusterName, collection, r.URL.Query().Get("backup"), options)
+	if err != nil {
+		operationErrorResponse(w, err, "Some Error Occurred (while triggering restore)")
+		return
+	}
+	if !detached {
+		jsonResponse(w, http.StatusOK, map[string]string{"message": "Restore finished successfully"})
+		return
+	}
+	jsonResponse(w, http.StatusAccepted, map[string]string{"message": "Restore job started", "jobId": job.ID})
+}
+
+// StartRestore restores the backup (e.g. /2022/01/24-163045.99) of the collection into the cluster with the engine
+// specific JSON options, an empty backup restores the LATEST one. detached is true while the engine still runs the
+// restore, which is then followed by the returned job. Otherwise the restore already finished and there is no job.
+// The caller must be authorized to restore the collection.
+func (h *Handler) StartRestore(ctx context.Context, clusterName string, collection string, backup string, options []byte) (job app.Job, detached bool, err error) {
+	engine, ok := h.clusters.Get(clusterName)
+	if !ok {
+		return app.Job{}, false, newError(http.StatusNotFound, codeClusterNotFound, "Cluster not found")
+	}
+	if !cluster.ValidName(collection) || (backup != "" && !cluster.ValidBackupDirName(backup)) {
+		return app.Job{}, false, newError(http.StatusBadRequest, codeInvalidName, "Invalid collection or backup name")
+	}
+
+	ctx, span := h.startJobSpan(ctx, app.JobRestore, clusterName, collection)
+	h.engineSpans.add(clusterName, collection, span.SpanContext())
+	_, startSpan := h.tracer.Start(ctx, "StartRestore")
+	jobRef, err := engine.StartRestore(collection, backup, options)
+	tracing.End(startSpan, err)
+	if err != nil || !jobRef.Detached {
+		h.engineSpans.remove(clusterName, collection)
+		tracing.End(span, err)
+	}
+	if err != nil {
+		h.completeRestore(ctx, clusterName, collection, backup, err)
+		var optionsErr *cluster.OptionsError
+		if errors.As(err, &optionsErr) {
+			h.logger.Warn("StartRestore: invalid restore options", append(tracing.LogFields(ctx), zap.Error(err))...)
+			return app.Job{}, false, newError(http.StatusBadRequest, codeInvalidOptions, fmt.Sprintf("Invalid restore options: %v", err))
 		}
+		return app.Job{}, false, err
+	}
+
+	if !jobRef.Detached {
+		h.completeRestore(ctx, clusterName, collection, backup, nil)
+		return app.Job{}, false, nil
+	}
+
+	job = h.jobs.Create(app.JobRestore, clusterName, collection, jobRef.ID)
+	h.runJob(ctx, span, job.ID, func(ctx context.Context) {
+		h.followJob(ctx, job)
+	})
+	return job, true, nil
+}
+
+// latestBackupDir returns the full path of the LATEST backup in the collection backupsDir (/{cluster}/{collection})
+func (h *Handler) latestBackupDir(backupsDir string) (string, error) {
+	latest, err := ioutil.ReadFile(path.Join(h.fileSystemWrapper.PathBackups(), backupsDir, "LATEST"))
+	if err != nil {
+		h.logger.Error("latestBackupDir: error finding LATEST file", zap.Error(err))
+		return "", err
+	}
+
+	latestBackupDir := path.Join(h.fileSystemWrapper.PathBackups(), backupsDir, string(latest))
+	if _, err := os.Stat(latestBackupDir); err != nil {
+		h.logger.Error("latestBackupDir: LATEST backup dir not found", zap.Error(err))
+		return "", err
+	}
+	return latestBackupDir, nil
+}
+
+// processBackup zips, encrypts and uploads backupDir. When jobID is set, the job stage follows the pipeline and the
+// bytes processed by the stages are published to the subscribers of the job.
+func (h *Handler) processBackup(ctx context.Context, backupDir string, jobID string) <-chan app.DTO {
+	h.setJobStage(jobID, app.StageZip)
+	timer := &stageTimer{ctx: ctx, start: time.Now()}
+	zipperResultStream := h.trackStage(jobID, app.StageEncrypt, h.measureStage(timer, app.StageZip, h.zipper.Zip(ctx, backupDir, h.jobs.Progress(jobID, app.StageZip))))
+	encryptorResultStream := h.trackStage(jobID, app.StageUpload, h.measureStage(timer, app.StageEncrypt, h.encryptor.Encrypt(ctx, zipperResultStream, h.jobs.Progress(jobID, app.StageEncrypt))))
+	return h.measureStage(timer, app.StageUpload, h.gcsIntegrator.UploadToStorage(ctx, encryptorResultStream, h.jobs.Progress(jobID, app.StageUpload)))
+}
 
-		zipperResultStream := h.zipper.Zip(latestBackupDir)
-		encryptorResultStream := h.encryptor.Encrypt(zipperResultStream)
-		h.gcsIntegrator.UploadToStorage(encryptorResultStream)
+// readOptions reads the engine specific JSON options from the request body, which may be empty
+func readOptions(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
 	}
+	return ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxOptionsSize))
+}
+
+// webdavTracing starts a span for the WebDAV requests to a collection with a running engine job, linked to the
+// span of the job, since the engines don't propagate the trace
+func (h *Handler) webdavTracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		elements := pathElements(r)
+		if len(elements) < 2 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		jobSpanContext, ok := h.engineSpans.get(elements[0], elements[1])
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, span := h.tracer.Start(r.Context(), "WebDAV "+r.Method,
+			trace.WithLinks(trace.Link{SpanContext: jobSpanContext}),
+			trace.WithAttributes(tracing.ClusterKey.String(elements[0]), tracing.CollectionKey.String(elements[1])))
+		defer span.End()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// webdavMetrics counts the WebDAV requests by method and status
+func (h *Handler) webdavMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+		h.metrics.WebDAVRequest(r.Method, recorder.Status())
+	})
+}
+
+// webdavCredentialsInterceptor requires the WebDAV credentials of the cluster, unless the request is authenticated
+// with a bearer token. The credentials of a cluster may back up and read its collections, like a token with the
+// operator role limited to them.
+func (h *Handler) webdavCredentialsInterceptor(next http.Handler) http.Handler {
+	basicAuth := h.webdavWrapper.BasicAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _, _ := r.BasicAuth()
+		identity := auth.Identity{
+			Name:        user,
+			Roles:       []string{auth.RoleOperator},
+			Collections: []string{pathElements(r)[0] + "/*"},
+		}
+		next.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), identity)))
+	}), h.denied)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if identity, ok := auth.FromContext(r.Context()); ok && !identity.Unrestricted && !identity.Unauthenticated {
+			next.ServeHTTP(w, r)
+			return
+		}
+		basicAuth.ServeHTTP(w, r)
+	})
+}
 
-	w.WriteHeader(http.StatusOK)
-	w.Header().Set("Content-Type", "application/json")
-	resp := make(map[string]string)
-	resp["message"] = "Backup triggered successfully"
-	jsonResp, _ := json.Marshal(resp)
-	_, _ = w.Write(jsonResp)
+// stripDestinationPrefix removes prefix from the path of the Destination header of COPY and MOVE requests, like
+// http.StripPrefix does for their URL, so the WebDAV server copies and moves within its mount. Destinations
+// outside of the mount are forbidden.
+func (h *Handler) stripDestinationPrefix(prefix string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		destination := r.Header.Get("Destination")
+		if destination == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		u, err := url.Parse(destination)
+		if err != nil || !strings.HasPrefix(u.Path, prefix+"/") {
+			h.auditDenied(w, r, http.StatusForbidden)
+			errorResponse(w, http.StatusForbidden, codeForbidden, "Forbidden")
+			return
+		}
+		u.Path = strings.TrimPrefix(u.Path, prefix)
+		u.RawPath = ""
+		r.Header.Set("Destination", u.String())
+		next.ServeHTTP(w, r)
+	})
 }
 
 // backupsDirectoriesInterceptor intercepts HTTP requests and creates local directories needed
@@ -136,15 +429,6 @@ func (h *Handler) backupsDirectoriesInterceptor(next http.Handler) http.Handler
 	})
 }
 
-func internalServerErrResponse(w http.ResponseWriter, message string) {
-	w.WriteHeader(http.StatusInternalServerError)
-	w.Header().Set("Content-Type", "application/json")
-	resp := make(map[string]string)
-	resp["message"] = message
-	jsonResp, _ := json.Marshal(resp)
-	_, _ = w.Write(jsonResp)
-}
-
 func (h *Handler) fromBucket(w http.ResponseWriter, r *http.Request) {
 	// get and release local semaphore
 	semErr := h.sem.Acquire(h.ctx, 1)
@@ -160,36 +444,51 @@ func (h *Handler) fromBucket(w http.ResponseWriter, r *http.Request) {
 	}
 
 	fileName := path.Base(r.URL.Path)
+	start := time.Now()
 	downloadedFile, err := h.gcsIntegrator.DownloadFromBucket(fileName)
 	if err != nil {
 		internalServerErrResponse(w, "Some Error Occurred (while downloading)")
 		return
 	}
+	start = h.observeFileStage(r.Context(), "download", start, downloadedFile)
 
 	zipFile, err := h.encryptor.DecryptFileAs(downloadedFile, ".zip")
 	if err != nil {
 		internalServerErrResponse(w, "Some Error Occurred (while decrypting)")
 		return
 	}
+	start = h.observeFileStage(r.Context(), "decrypt", start, zipFile)
 
 	backupResult, err := h.useZipAsBackup(zipFile)
 	if err != nil {
 		internalServerErrResponse(w, "Some Error Occurred")
 		return
 	}
+	h.observeFileStage(r.Context(), "unzip", start, "")
+
+	jsonResponse(w, http.StatusOK, map[string]string{"message": fmt.Sprintf("Backup result: %s", backupResult)})
+}
 
-	w.WriteHeader(http.StatusOK)
-	w.Header().Set("Content-Type", "application/json")
-	resp := make(map[string]string)
-	resp["message"] = fmt.Sprintf("Backup result: %s", backupResult)
-	jsonResp, _ := json.Marshal(resp)
-	_, _ = w.Write(jsonResp)
+// observeFileStage records the duration and span of a stage which started at start and produced filePath, returning
+// its end
+func (h *Handler) observeFileStage(ctx context.Context, stage string, start time.Time, filePath string) time.Time {
+	end := time.Now()
+	_, span := h.tracer.Start(ctx, stage, trace.WithTimestamp(start))
+	span.End(trace.WithTimestamp(end))
+	h.metrics.ObserveStage(stage, end.Sub(start))
+	if info, err := os.Stat(filePath); err == nil {
+		h.metrics.AddBytes(stage, info.Size())
+	}
+	return end
 }
 
 func (h *Handler) useZipAsBackup(zipFile string) (string, error) {
 	// check if directory already exists under backups
-	fileName := path.Base(zipFile)
-	backupsDirFileBased := "/" + strings.Replace(strings.Replace(fileName, ".zip", "", -1), "_", "/", -1)
+	clusterName, collection, backup := app.ObjectBackup(path.Base(zipFile))
+	if clusterName == "" {
+		return "", fmt.Errorf("error while using as backup: %s is not the name of a backup", path.Base(zipFile))
+	}
+	backupsDirFileBased := path.Join("/", clusterName, collection, backup)
 	backupsDirFullPath := path.Join(h.fileSystemWrapper.PathBackups(), backupsDirFileBased)
 	if _, err := os.Stat(backupsDirFullPath); err == nil {
 		h.logger.Warn("useZipAsBackup: skipping, file already exists", zap.String("backupsDirFullPath", backupsDirFullPath))
@@ -210,6 +509,17 @@ func (h *Handler) useZipAsBackup(zipFile string) (string, error) {
 }
 
 func (h *Handler) listBackups(w http.ResponseWriter, r *http.Request) {
+	backups, err := h.Backups(r.Context())
+	if err != nil {
+		internalServerErrResponse(w, "Some Error Occurred")
+		return
+	}
+	jsonResponse(w, http.StatusOK, backups)
+}
+
+// Backups returns the local backups (e.g. /{cluster}/{collection}/2022/01/24-163045.99) per collection
+// ({cluster}/{collection}) in the scope of the caller
+func (h *Handler) Backups(ctx context.Context) (map[string][]string, error) {
 	var backupDataPaths []string
 	err := filepath.Walk(h.fileSystemWrapper.PathBackups(),
 		func(path string, info os.FileInfo, err error) error {
@@ -231,31 +541,26 @@ func (h *Handler) listBackups(w http.ResponseWriter, r *http.Request) {
 			return nil
 		})
 	if err != nil {
-		internalServerErrResponse(w, "Some Error Occurred")
-		return
+		return nil, err
 	}
 
-	// create response
-	backupsResponse := make(map[string]*[]string)
+	backups := make(map[string][]string)
 	for _, fullBackupsDataPath := range backupDataPaths {
 		backupsPath := strings.Replace(fullBackupsDataPath, h.fileSystemWrapper.PathBackups(), "", -1)
-		// get key
+		// get key, backups are stored as /{cluster}/{collection}/{year}/{month}/{day-time}
 		pathElements := strings.Split(backupsPath, "/")
-		backupRootDir := pathElements[1]
+		if len(pathElements) < 3 {
+			continue
+		}
+		if !inScope(ctx, pathElements[1], pathElements[2]) {
+			continue
+		}
+		backupRootDir := path.Join(pathElements[1], pathElements[2])
 		// get content
-		backupRootPathFiltered := strings.Join(strings.SplitN(backupsPath, "/", 4), "/")
-		if strings.Count(backupRootPathFiltered, "/") == 4 {
-			// create or update response map entry
-			if contents, exists := backupsResponse[backupRootDir]; exists {
-				*contents = append(*contents, backupRootPathFiltered)
-			} else {
-				backupsResponse[backupRootDir] = &[]string{backupRootPathFiltered}
-			}
+		backupRootPathFiltered := strings.Join(strings.SplitN(backupsPath, "/", 5), "/")
+		if strings.Count(backupRootPathFiltered, "/") == 5 {
+			backups[backupRootDir] = append(backups[backupRootDir], backupRootPathFiltered)
 		}
 	}
-
-	w.WriteHeader(http.StatusOK)
-	w.Header().Set("Content-Type", "application/json")
-	jsonResp, _ := json.Marshal(backupsResponse)
-	_, _ = w.Write(jsonResp)
+	return backups, nil
 }
@@ -0,0 +1,224 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/app"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/cluster"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/tracing"
+	"go.uber.org/zap"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"time"
+)
+
+// defaultArtifactName is the file name of a streamed artifact uploaded without the name query parameter
+const defaultArtifactName = "artifact"
+
+// maxBackupDirAttempts is the number of backup directory names tried by an ingest, the names have a granularity of
+// 10ms so concurrent ingests into a collection take the following ones
+const maxBackupDirAttempts = 10
+
+// errBackupExists is returned when all the backup directory names tried by an ingest are taken
+var errBackupExists = errors.New("backup directory exists")
+
+// validArtifactName matches the file names accepted for ingested artifacts
+var validArtifactName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,254}$`)
+
+// ingest serves POST /ingest/{collection}. The request body is either the artifact itself, named by the name
+// query parameter, or a multipart/form-data body with one or more files. The artifacts are stored as a new
+// backup of the collection in the ingest cluster and processed like any other backup.
+func (h *Handler) ingest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowedResponse(w)
+		return
+	}
+	collection := path.Base(r.URL.Path)
+	if !cluster.ValidName(collection) {
+		badRequestResponse(w, codeInvalidName, "Invalid collection name")
+		return
+	}
+
+	// get and release local semaphore
+	semErr := h.sem.Acquire(r.Context(), 1)
+	defer func() {
+		if semErr == nil {
+			h.sem.Release(1)
+		}
+	}()
+	if semErr != nil {
+		h.logger.Error("ingest: unable to obtain local semaphore")
+		internalServerErrResponse(w, "Some Error Occurred")
+		return
+	}
+
+	collectionDir := path.Join(h.fileSystemWrapper.PathBackups(), cluster.IngestName, collection)
+	subdir, err := createBackupDir(collectionDir, time.Now())
+	if err == errBackupExists {
+		errorResponse(w, http.StatusConflict, codeBackupExists, "A backup of the collection is being ingested, try again")
+		return
+	}
+	if err != nil {
+		h.logger.Error("ingest: error creating backup directory", zap.String("collection", collection), zap.Error(err))
+		internalServerErrResponse(w, "Some Error Occurred")
+		return
+	}
+	dataDir := path.Join(collectionDir, subdir, "data")
+	if err := os.Mkdir(dataDir, 0700); err != nil {
+		h.logger.Error("ingest: error creating backup directory", zap.String("directory", dataDir), zap.Error(err))
+		internalServerErrResponse(w, "Some Error Occurred")
+		return
+	}
+
+	ctx, span := h.startJobSpan(r.Context(), app.JobIngest, cluster.IngestName, collection)
+	_, storeSpan := h.tracer.Start(ctx, string(app.StageIngest))
+	body := http.MaxBytesReader(w, r.Body, h.maxIngestSize)
+	err = h.storeArtifacts(r, body, dataDir)
+	tracing.End(storeSpan, err)
+	if err != nil {
+		tracing.End(span, err)
+		_ = os.RemoveAll(path.Join(collectionDir, subdir))
+		var invalidErr *invalidArtifactError
+		if errors.As(err, &invalidErr) {
+			badRequestResponse(w, codeInvalidArtifact, invalidErr.Error())
+			return
+		}
+		h.logger.Error("ingest: error storing artifact", zap.String("collection", collection), zap.Error(err))
+		internalServerErrResponse(w, "Some Error Occurred (while storing the artifact)")
+		return
+	}
+
+	// LATEST points to the last complete backup, as for the collections of the engines
+	if err := ioutil.WriteFile(path.Join(collectionDir, "LATEST"), []byte(subdir), 0600); err != nil {
+		tracing.End(span, err)
+		h.logger.Error("ingest: error writing LATEST", zap.String("collection", collection), zap.Error(err))
+		internalServerErrResponse(w, "Some Error Occurred")
+		return
+	}
+
+	h.metrics.BackupTriggered(cluster.IngestName, collection)
+	job := h.jobs.Create(app.JobIngest, cluster.IngestName, collection, 0)
+	h.runJob(ctx, span, job.ID, func(ctx context.Context) {
+		h.processBackupJob(ctx, job)
+	})
+
+	h.logger.Info("ingest: artifact stored", append(tracing.LogFields(ctx), zap.String("collection", collection), zap.String("subdir", subdir), zap.String("job", job.ID))...)
+	jsonResponse(w, http.StatusAccepted, map[string]string{"message": "Artifact ingested", "backup": subdir, "jobId": job.ID})
+}
+
+// createBackupDir creates a new backup directory in collectionDir named after now, or after the following 10ms when
+// the name is taken, and returns its name. errBackupExists is returned when all the names tried are taken.
+func createBackupDir(collectionDir string, now time.Time) (string, error) {
+	for attempt := 0; attempt < maxBackupDirAttempts; attempt++ {
+		subdir := cluster.BackupDirName(now.Add(time.Duration(attempt) * 10 * time.Millisecond))
+		dir := path.Join(collectionDir, subdir)
+		if err := os.MkdirAll(path.Dir(dir), 0700); err != nil {
+			return "", err
+		}
+		err := os.Mkdir(dir, 0700)
+		if err == nil {
+			return subdir, nil
+		}
+		if !os.IsExist(err) {
+			return "", err
+		}
+	}
+	return "", errBackupExists
+}
+
+// invalidArtifactError is returned for uploads which are rejected because of the client
+type invalidArtifactError struct {
+	message string
+}
+
+func (e *invalidArtifactError) Error() string {
+	return e.message
+}
+
+// storeArtifacts writes the artifacts in body into dataDir
+func (h *Handler) storeArtifacts(r *http.Request, body io.Reader, dataDir string) error {
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			name = defaultArtifactName
+		}
+		if !validArtifactName.MatchString(name) {
+			return &invalidArtifactError{message: "Invalid artifact name"}
+		}
+		return writeArtifact(path.Join(dataDir, name), body)
+	}
+
+	if params["boundary"] == "" {
+		return &invalidArtifactError{message: "Invalid multipart body"}
+	}
+	reader := multipart.NewReader(body, params["boundary"])
+	stored := 0
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return &invalidArtifactError{message: fmt.Sprintf("Error reading the multipart body: %v", err)}
+		}
+		if part.FileName() == "" {
+			// form fields are ignored, only files are artifacts
+			continue
+		}
+		name := path.Base(part.FileName())
+		if !validArtifactName.MatchString(name) {
+			return &invalidArtifactError{message: fmt.Sprintf("Invalid artifact name %q", name)}
+		}
+		if _, err := os.Stat(path.Join(dataDir, name)); err == nil {
+			return &invalidArtifactError{message: fmt.Sprintf("Duplicate artifact name %q", name)}
+		}
+		if err := writeArtifact(path.Join(dataDir, name), part); err != nil {
+			return err
+		}
+		stored++
+	}
+	if stored == 0 {
+		return &invalidArtifactError{message: "No artifact in multipart body"}
+	}
+	return nil
+}
+
+// writeArtifact copies src into the new file filePath. Errors reading src, e.g. because the upload is too large
+// or was interrupted, are returned as client errors.
+func writeArtifact(filePath string, src io.Reader) error {
+	f, err := os.OpenFile(filePath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	reader := &errReader{reader: src}
+	if _, err := io.Copy(f, reader); err != nil {
+		_ = f.Close()
+		if reader.err != nil {
+			return &invalidArtifactError{message: fmt.Sprintf("Error reading the artifact: %v", reader.err)}
+		}
+		return err
+	}
+	return f.Close()
+}
+
+// errReader keeps the error of the underlying reader, to tell read errors from write errors
+type errReader struct {
+	reader io.Reader
+	err    error
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
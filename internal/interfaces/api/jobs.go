@@ -0,0 +1,436 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/app"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/cluster"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/notify"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/tracing"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// runJob runs fn for the job in the background, ending span with the outcome of the job
+func (h *Handler) runJob(ctx context.Context, span trace.Span, jobID string, fn func(ctx context.Context)) {
+	span.SetAttributes(tracing.JobKey.String(jobID))
+	go func() {
+		fn(ctx)
+		var err error
+		if job, ok := h.jobs.Get(jobID); ok && job.Status != app.JobSucceeded {
+			err = fmt.Errorf("job %s: %s", job.Status, job.Error)
+		}
+		tracing.End(span, err)
+	}()
+}
+
+// startJobSpan starts the span of a job triggered by the request of ctx, which outlives the request
+func (h *Handler) startJobSpan(ctx context.Context, kind app.JobKind, clusterName string, collection string) (context.Context, trace.Span) {
+	return h.tracer.Start(tracing.Detach(h.ctx, ctx), string(kind)+" job",
+		trace.WithAttributes(tracing.ClusterKey.String(clusterName), tracing.CollectionKey.String(collection)))
+}
+
+// followJob polls the engine job of a detached backup or restore. Backups are processed once they succeeded.
+func (h *Handler) followJob(ctx context.Context, job app.Job) {
+	logger := h.logger.With(tracing.LogFields(ctx)...)
+	engine, ok := h.clusters.Get(job.Cluster)
+	if !ok {
+		h.failJob(ctx, job.ID, fmt.Errorf("unknown cluster %s", job.Cluster))
+		return
+	}
+
+	_, stageSpan := h.tracer.Start(ctx, string(job.Stage))
+	status, err := engine.WaitForJob(ctx, job.EngineJobID, h.jobPollInterval, func(s cluster.JobStatus) {
+		h.jobs.Update(job.ID, func(j *app.Job) {
+			j.FractionCompleted = s.FractionCompleted
+			if s.Status == cluster.JobStatusPaused {
+				j.Status = app.JobPaused
+			} else if !s.Finished() {
+				j.Status = app.JobRunning
+			}
+		})
+	})
+	h.engineSpans.remove(job.Cluster, job.Collection)
+	if err != nil {
+		tracing.End(stageSpan, err)
+		logger.Error("followJob: error following engine job", zap.String("job", job.ID), zap.Int64("engineJobID", job.EngineJobID), zap.Error(err))
+		h.failJob(ctx, job.ID, fmt.Errorf("error following engine job: %v", err))
+		return
+	}
+
+	switch status.Status {
+	case cluster.JobStatusSucceeded:
+		stageSpan.End()
+		h.metrics.ObserveStage(string(job.Stage), time.Since(job.CreatedAt))
+	case cluster.JobStatusFailed:
+		tracing.End(stageSpan, errors.New(status.Error))
+		h.failJob(ctx, job.ID, fmt.Errorf("engine job failed: %s", status.Error))
+		return
+	case cluster.JobStatusCanceled:
+		tracing.End(stageSpan, errors.New("engine job canceled"))
+		h.jobs.Update(job.ID, func(j *app.Job) {
+			j.Status = app.JobCanceled
+		})
+		return
+	}
+
+	if job.Kind != app.JobBackup {
+		h.finishJob(ctx, job.ID)
+		return
+	}
+	h.processBackupJob(ctx, job)
+}
+
+// processBackupJob zips, encrypts and uploads the LATEST backup in the collection of a backup job when the GCP
+// integration is enabled, and records the outcome in the catalog
+func (h *Handler) processBackupJob(ctx context.Context, job app.Job) {
+	backupsDir := path.Join("/", job.Cluster, job.Collection)
+	entry := app.CatalogEntry{
+		JobID:      job.ID,
+		Cluster:    job.Cluster,
+		Collection: job.Collection,
+		Source:     h.source(job.Cluster),
+		Status:     app.CatalogSucceeded,
+	}
+	defer func() {
+		_ = h.catalog.Add(entry)
+	}()
+
+	latestBackupDir, err := h.latestBackupDir(backupsDir)
+	if err != nil {
+		entry.Status, entry.Error = app.CatalogFailed, err.Error()
+		h.failJob(ctx, job.ID, fmt.Errorf("error getting LATEST backup: %v", err))
+		return
+	}
+	entry.Path = latestBackupDir
+	entry.Backup = strings.TrimPrefix(latestBackupDir, path.Join(h.fileSystemWrapper.PathBackups(), backupsDir))
+	h.jobs.Update(job.ID, func(j *app.Job) {
+		j.Backup = entry.Backup
+	})
+
+	if !h.gcpIntegration {
+		h.finishJob(ctx, job.ID)
+		return
+	}
+
+	result, more := <-h.processBackup(ctx, latestBackupDir, job.ID)
+	switch {
+	case !more:
+		err = errors.New("backup processing was interrupted")
+	case result.Err() != nil:
+		err = result.Err()
+	}
+	if err != nil {
+		entry.Status, entry.Error = app.CatalogFailed, err.Error()
+		h.failJob(ctx, job.ID, err)
+		return
+	}
+	entry.Object = path.Base(result.Content())
+	h.jobs.Update(job.ID, func(j *app.Job) {
+		j.Object = entry.Object
+	})
+	h.finishJob(ctx, job.ID)
+}
+
+// source returns the producer of the backups of a cluster, as recorded in the catalog
+func (h *Handler) source(clusterName string) string {
+	if clusterName == cluster.IngestName {
+		return cluster.IngestName
+	}
+	if engine, ok := h.clusters.Get(clusterName); ok {
+		return engine.Name()
+	}
+	return ""
+}
+
+// trackStage forwards the results of a pipeline stage, moving the job to nextStage once a result passes
+func (h *Handler) trackStage(jobID string, nextStage app.JobStage, in <-chan app.DTO) <-chan app.DTO {
+	if jobID == "" {
+		return in
+	}
+	out := make(chan app.DTO)
+	go func() {
+		defer close(out)
+		for dto := range in {
+			if dto.Err() == nil {
+				h.setJobStage(jobID, nextStage)
+			}
+			select {
+			case <-h.ctx.Done():
+				return
+			case out <- dto:
+			}
+		}
+	}()
+	return out
+}
+
+func (h *Handler) setJobStage(jobID string, stage app.JobStage) {
+	if jobID == "" {
+		return
+	}
+	h.jobs.Update(jobID, func(j *app.Job) {
+		j.Stage = stage
+	})
+}
+
+func (h *Handler) finishJob(ctx context.Context, jobID string) {
+	finished := false
+	job, _ := h.jobs.Update(jobID, func(j *app.Job) {
+		j.Status = app.JobSucceeded
+		j.Stage = app.StageDone
+		j.FractionCompleted = 1
+		finished = true
+	})
+	if !finished {
+		return
+	}
+	switch job.Kind {
+	case app.JobBackup, app.JobIngest:
+		h.metrics.BackupSucceeded(job.Cluster, job.Collection)
+	case app.JobRestore:
+		h.metrics.RestoreSucceeded(job.Cluster, job.Collection)
+	}
+	h.notifyJob(ctx, job)
+}
+
+func (h *Handler) failJob(ctx context.Context, jobID string, err error) {
+	failed := false
+	job, _ := h.jobs.Update(jobID, func(j *app.Job) {
+		j.Status = app.JobFailed
+		j.Error = err.Error()
+		failed = true
+	})
+	if !failed {
+		return
+	}
+	switch job.Kind {
+	case app.JobBackup, app.JobIngest:
+		h.metrics.BackupFailed(job.Cluster, job.Collection)
+	case app.JobRestore:
+		h.metrics.RestoreFailed(job.Cluster, job.Collection)
+	}
+	h.notifyJob(ctx, job)
+}
+
+// completeRestore records the outcome of a restore without job, which the engine finished right away or which could
+// not be started, like finishJob and failJob do for the restores followed by a job
+func (h *Handler) completeRestore(ctx context.Context, clusterName string, collection string, backup string, err error) {
+	job := app.Job{
+		Kind:       app.JobRestore,
+		Status:     app.JobSucceeded,
+		Cluster:    clusterName,
+		Collection: collection,
+		Backup:     backup,
+	}
+	if err != nil {
+		job.Status, job.Error = app.JobFailed, err.Error()
+		h.metrics.RestoreFailed(clusterName, collection)
+	} else {
+		h.metrics.RestoreSucceeded(clusterName, collection)
+	}
+	h.notifyJob(ctx, job)
+}
+
+// notifyJob notifies the outcome of a finished job, verifications only when they failed
+func (h *Handler) notifyJob(ctx context.Context, job app.Job) {
+	if job.Kind == app.JobVerify && job.Status != app.JobFailed {
+		return
+	}
+	event := notify.Event{
+		Type:       notify.EventBackupSucceeded,
+		Status:     notify.StatusSucceeded,
+		Cluster:    job.Cluster,
+		Collection: job.Collection,
+		JobID:      job.ID,
+		Backup:     job.Backup,
+		Object:     job.Object,
+		Error:      job.Error,
+		TraceID:    traceID(ctx),
+	}
+	if job.Status == app.JobFailed {
+		event.Type, event.Status = notify.EventBackupFailed, notify.StatusFailed
+	}
+	switch job.Kind {
+	case app.JobRestore:
+		event.Type = notify.EventRestoreCompleted
+	case app.JobVerify:
+		event.Type = notify.EventVerificationFailed
+	}
+	h.notifier.Notify(event)
+}
+
+// stageTimer measures the consecutive stages of the processing pipeline, a stage starts once the previous one
+// passed its result
+type stageTimer struct {
+	ctx   context.Context
+	mu    sync.Mutex
+	start time.Time
+}
+
+// measureStage forwards the results of a pipeline stage, recording its duration and the size of the file it
+// produced. The stages record their spans themselves.
+func (h *Handler) measureStage(timer *stageTimer, stage app.JobStage, in <-chan app.DTO) <-chan app.DTO {
+	out := make(chan app.DTO)
+	go func() {
+		defer close(out)
+		for dto := range in {
+			timer.mu.Lock()
+			if dto.Err() == nil {
+				h.metrics.ObserveStage(string(stage), time.Since(timer.start))
+				timer.start = time.Now()
+				if info, err := os.Stat(dto.Content()); err == nil {
+					h.metrics.AddBytes(string(stage), info.Size())
+				}
+			} else {
+				h.logger.With(tracing.LogFields(timer.ctx)...).Error("measureStage: stage failed", zap.String("stage", string(stage)), zap.Error(dto.Err()))
+			}
+			timer.mu.Unlock()
+			select {
+			case <-h.ctx.Done():
+				return
+			case out <- dto:
+			}
+		}
+	}()
+	return out
+}
+
+// job serves GET /jobs, GET /jobs/{id}, GET /jobs/{id}/events and POST /jobs/{id}/{pause|resume|cancel} to control its
+// engine job
+func (h *Handler) job(w http.ResponseWriter, r *http.Request) {
+	elements := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(elements) == 1 && elements[0] == "" && r.Method == http.MethodGet {
+		h.listJobs(w, r)
+		return
+	}
+	if len(elements) == 0 || len(elements) > 2 || elements[0] == "" {
+		badRequestResponse(w, codeBadRequest, "Invalid request")
+		return
+	}
+
+	job, ok := h.Job(elements[0])
+	if !ok {
+		errorResponse(w, http.StatusNotFound, codeJobNotFound, "Job not found")
+		return
+	}
+
+	if len(elements) == 1 {
+		if r.Method != http.MethodGet {
+			methodNotAllowedResponse(w)
+			return
+		}
+		jsonResponse(w, http.StatusOK, job)
+		return
+	}
+
+	if elements[1] == "events" {
+		if r.Method != http.MethodGet {
+			methodNotAllowedResponse(w)
+			return
+		}
+		h.jobEvents(w, r, job.ID)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		methodNotAllowedResponse(w)
+		return
+	}
+	engine, ok := h.clusters.Get(job.Cluster)
+	if !ok || (job.Stage != app.StageBackup && job.Stage != app.StageRestore) || job.Finished() {
+		errorResponse(w, http.StatusConflict, codeJobNotRunning, "Job has no running engine job")
+		return
+	}
+
+	var err error
+	switch elements[1] {
+	case "pause":
+		err = engine.PauseJob(r.Context(), job.EngineJobID)
+	case "resume":
+		err = engine.ResumeJob(r.Context(), job.EngineJobID)
+	case "cancel":
+		err = engine.CancelJob(r.Context(), job.EngineJobID)
+	default:
+		badRequestResponse(w, codeBadRequest, "Invalid request")
+		return
+	}
+	if errors.Is(err, cluster.ErrNotSupported) {
+		errorResponse(w, http.StatusNotImplemented, codeNotSupported, fmt.Sprintf("The engine of the cluster does not support to %s jobs", elements[1]))
+		return
+	}
+	if err != nil {
+		internalServerErrResponse(w, fmt.Sprintf("Some Error Occurred (while trying to %s the engine job)", elements[1]))
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]string{"message": fmt.Sprintf("Engine job %s requested", elements[1])})
+}
+
+// listJobs serves GET /jobs/ with the jobs of the collections in the scope of the caller, the newest first. The
+// optional kind and status parameters filter them.
+func (h *Handler) listJobs(w http.ResponseWriter, r *http.Request) {
+	kind, status := r.URL.Query().Get("kind"), r.URL.Query().Get("status")
+	jobs := make([]app.Job, 0)
+	for _, job := range h.jobs.List() {
+		if (kind != "" && string(job.Kind) != kind) || (status != "" && string(job.Status) != status) {
+			continue
+		}
+		if inScope(r.Context(), job.Cluster, job.Collection) {
+			jobs = append(jobs, job)
+		}
+	}
+	jsonResponse(w, http.StatusOK, jobs)
+}
+
+// Job returns the job with the given id. The caller must be authorized to read its collection.
+func (h *Handler) Job(id string) (app.Job, bool) {
+	return h.jobs.Get(id)
+}
+
+func jsonResponse(w http.ResponseWriter, statusCode int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	jsonResp, _ := json.Marshal(body)
+	_, _ = w.Write(jsonResp)
+}
+
+// spanRegistry keeps the spans of the running engine jobs per collection, to link the WebDAV requests of the
+// engines to them
+type spanRegistry struct {
+	mu    sync.Mutex
+	spans map[string]trace.SpanContext
+}
+
+func newSpanRegistry() *spanRegistry {
+	return &spanRegistry{
+		spans: make(map[string]trace.SpanContext),
+	}
+}
+
+func (s *spanRegistry) add(clusterName string, collection string, spanContext trace.SpanContext) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.spans[path.Join(clusterName, collection)] = spanContext
+}
+
+func (s *spanRegistry) remove(clusterName string, collection string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.spans, path.Join(clusterName, collection))
+}
+
+func (s *spanRegistry) get(clusterName string, collection string) (trace.SpanContext, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	spanContext, ok := s.spans[path.Join(clusterName, collection)]
+	return spanContext, ok
+}
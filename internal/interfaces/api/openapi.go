@@ -0,0 +1,22 @@
+package api
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPISpec is the OpenAPI 3 document of the API, keep it in line with the routes and their responses
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// openAPI serves GET /openapi.json
+func (h *Handler) openAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowedResponse(w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(openAPISpec)
+}
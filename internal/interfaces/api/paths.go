@@ -3,7 +3,7 @@ package api
 const (
 	// endpoints
 
-	// trigger backup command in the configured CRDB
+	// trigger backup command in the default CRDB cluster
 	endpointCRDBBackup = "/crdbBackup/"
 
 	// endpoint used by CRDB to store the backups
@@ -14,6 +14,39 @@ const (
 
 	// get backup from bucket
 	endpointFromBucket = "/fromBucket/"
+
+	// get the status of a job, or pause, resume or cancel its CRDB job
+	endpointJobs = "/jobs/"
+
+	// list the configured clusters, check their health and trigger backups per cluster
+	endpointClusters = "/clusters/"
+
+	// query the audit log
+	endpointAudit = "/audit"
+
+	// freshness SLOs of the collections
+	endpointStatus = "/status"
+
+	// Prometheus metrics
+	endpointMetrics = "/metrics"
+
+	// OpenAPI document of the API
+	endpointOpenAPI = "/openapi.json"
+
+	// upload an artifact of any producer into a collection, to be processed like any other backup
+	endpointIngest = "/ingest/"
+
+	// list the backups in the bucket
+	endpointBucket = "/bucket"
+
+	// verify a backup in the bucket
+	endpointVerify = "/verify/"
+
+	// identity and allowed actions of the caller
+	endpointMe = "/me"
+
+	// static files of the web UI
+	endpointUI = "/ui/"
 )
 
 var Paths paths
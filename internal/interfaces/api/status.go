@@ -0,0 +1,29 @@
+package api
+
+import (
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/watchdog"
+	"net/http"
+)
+
+// status serves GET /status with the freshness SLOs of the collections in the scope of the caller
+func (h *Handler) status(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowedResponse(w)
+		return
+	}
+
+	resp := struct {
+		Healthy bool              `json:"healthy"`
+		SLOs    []watchdog.Status `json:"slos"`
+	}{Healthy: true, SLOs: []watchdog.Status{}}
+	for _, status := range h.watchdog.Statuses() {
+		if !inScope(r.Context(), status.Cluster, status.Collection) {
+			continue
+		}
+		resp.SLOs = append(resp.SLOs, status)
+		if status.Violated {
+			resp.Healthy = false
+		}
+	}
+	jsonResponse(w, http.StatusOK, resp)
+}
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// uiFiles are the static files of the web UI, served under /ui/
+//
+//go:embed ui
+var uiFiles embed.FS
+
+// uiHandler serves the static files of the web UI. The files are served to anyone, the UI calls the API with the
+// token of the user, so the headers keep other sites from framing it or running their scripts in it.
+func uiHandler() http.Handler {
+	files, err := fs.Sub(uiFiles, "ui")
+	if err != nil {
+		panic(err)
+	}
+	fileServer := http.FileServer(http.FS(files))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			methodNotAllowedResponse(w)
+			return
+		}
+		w.Header().Set("Content-Security-Policy", "default-src 'self'; frame-ancestors 'none'")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("X-Frame-Options", "DENY")
+		w.Header().Set("Cache-Control", "no-cache")
+		fileServer.ServeHTTP(w, r)
+	})
+}
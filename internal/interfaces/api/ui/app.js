@@ -0,0 +1,265 @@
+'use strict';
+
+// The UI calls the API of the service serving it, with the bearer token entered by the user. The token is kept in
+// the session storage of the tab only.
+const tokenKey = 'backupsmanager.token';
+const jobsInterval = 3000;
+
+let actions = [];
+
+// api calls the API and returns its JSON response, throwing an Error with the code, message and request ID of the
+// error responses
+async function api(method, path) {
+  const headers = { Accept: 'application/json' };
+  const token = sessionStorage.getItem(tokenKey);
+  if (token) {
+    headers.Authorization = 'Bearer ' + token;
+  }
+  const resp = await fetch(path, { method: method, headers: headers });
+  const text = await resp.text();
+  let body = null;
+  try {
+    body = text ? JSON.parse(text) : null;
+  } catch (e) {
+    body = { message: text };
+  }
+  if (!resp.ok) {
+    const err = new Error((body && body.message) || resp.statusText);
+    err.status = resp.status;
+    err.code = (body && body.code) || String(resp.status);
+    err.requestId = (body && body.requestId) || resp.headers.get('X-Request-Id') || '';
+    throw err;
+  }
+  return body;
+}
+
+function showError(err) {
+  const box = document.getElementById('error');
+  if (!err) {
+    box.hidden = true;
+    return;
+  }
+  let text = err.code ? err.code + ': ' + err.message : err.message;
+  if (err.requestId) {
+    text += ' (request ' + err.requestId + ')';
+  }
+  box.textContent = text;
+  box.hidden = false;
+}
+
+// el creates an element with the given text, never parsing it as HTML
+function el(tag, text, className) {
+  const e = document.createElement(tag);
+  if (text !== undefined && text !== null) {
+    e.textContent = text;
+  }
+  if (className) {
+    e.className = className;
+  }
+  return e;
+}
+
+function row(cells) {
+  const tr = document.createElement('tr');
+  cells.forEach((cell) => tr.appendChild(cell instanceof Node ? cell : el('td', cell)));
+  return tr;
+}
+
+function allowed(action) {
+  return actions.includes(action);
+}
+
+function formatTime(value) {
+  return value ? new Date(value).toLocaleString() : '';
+}
+
+function formatSize(bytes) {
+  const units = ['B', 'KiB', 'MiB', 'GiB', 'TiB'];
+  let i = 0;
+  while (bytes >= 1024 && i < units.length - 1) {
+    bytes /= 1024;
+    i++;
+  }
+  return bytes.toFixed(i ? 1 : 0) + ' ' + units[i];
+}
+
+// confirmAction resolves to true when the user confirms the action in the dialog
+function confirmAction(title, message) {
+  const dialog = document.getElementById('confirm');
+  document.getElementById('confirm-title').textContent = title;
+  document.getElementById('confirm-message').textContent = message;
+  return new Promise((resolve) => {
+    dialog.addEventListener('close', () => resolve(dialog.returnValue === 'ok'), { once: true });
+    dialog.returnValue = 'cancel';
+    dialog.showModal();
+  });
+}
+
+// perform runs a confirmed action and refreshes the jobs it started
+async function perform(title, message, method, path) {
+  if (!await confirmAction(title, message)) {
+    return;
+  }
+  try {
+    const resp = await api(method, path);
+    showError(null);
+    if (resp && resp.message) {
+      alert(resp.message);
+    }
+  } catch (err) {
+    showError(err);
+  }
+  loadJobs();
+}
+
+function actionButton(label, action, onClick) {
+  const button = el('button', label);
+  button.type = 'button';
+  button.hidden = !allowed(action);
+  button.addEventListener('click', onClick);
+  return button;
+}
+
+function triggerBackup(cluster, collection) {
+  return perform('Back up ' + collection,
+    'Back up the cluster ' + cluster + ' into the collection ' + collection + '?',
+    'POST', '/clusters/' + encodeURIComponent(cluster) + '/backup/' + encodeURIComponent(collection));
+}
+
+async function loadIdentity() {
+  const me = await api('GET', '/me');
+  actions = me.actions || [];
+  let text = me.name;
+  if (me.collections && me.collections.length) {
+    text += ' (' + me.collections.join(', ') + ')';
+  }
+  document.getElementById('identity').textContent = text;
+  document.querySelectorAll('[data-action]').forEach((e) => {
+    e.hidden = !allowed(e.dataset.action);
+  });
+}
+
+async function loadCollections() {
+  const clusters = await api('GET', '/clusters/');
+  const select = document.getElementById('backup-cluster');
+  select.replaceChildren(...clusters.map((c) => el('option', c.name)));
+
+  const backups = await api('GET', '/listBackups');
+  const tbody = document.getElementById('collections');
+  tbody.replaceChildren();
+  Object.keys(backups || {}).sort().forEach((key) => {
+    const [cluster, collection] = key.split('/');
+    const dirs = (backups[key] || []).map((dir) => dir.slice(key.length + 1)).sort();
+    const actionsCell = el('td', null, 'actions');
+    actionsCell.appendChild(actionButton('Back up now', 'backup', () => triggerBackup(cluster, collection)));
+    tbody.appendChild(row([cluster, collection, String(dirs.length), dirs[dirs.length - 1] || '', actionsCell]));
+  });
+}
+
+async function loadBucket() {
+  const prefix = document.getElementById('bucket-prefix').value;
+  const tbody = document.getElementById('objects');
+  let objects;
+  try {
+    objects = await api('GET', '/bucket?prefix=' + encodeURIComponent(prefix));
+  } catch (err) {
+    if (err.status === 501) {
+      document.getElementById('bucket-disabled').hidden = false;
+      tbody.replaceChildren();
+      return;
+    }
+    throw err;
+  }
+  tbody.replaceChildren();
+  objects.forEach((object) => {
+    const actionsCell = el('td', null, 'actions');
+    actionsCell.appendChild(actionButton('Verify', 'read', () => perform('Verify ' + object.name,
+      'Download, decrypt and check the files of ' + object.name + '?',
+      'POST', '/verify/' + encodeURIComponent(object.name))));
+    actionsCell.appendChild(actionButton('Restore', 'restore', () => perform('Restore ' + object.name,
+      'Download ' + object.name + ' and make it the latest local backup of its collection? ' +
+      'The collection can then be restored into its cluster.',
+      'POST', '/fromBucket/' + encodeURIComponent(object.name))));
+    tbody.appendChild(row([object.name, formatSize(object.size), formatTime(object.updated), actionsCell]));
+  });
+}
+
+async function loadJobs() {
+  const params = new URLSearchParams();
+  const kind = document.getElementById('jobs-kind').value;
+  const status = document.getElementById('jobs-status').value;
+  if (kind) {
+    params.set('kind', kind);
+  }
+  if (status) {
+    params.set('status', status);
+  }
+  let jobs;
+  try {
+    jobs = await api('GET', '/jobs/?' + params.toString());
+  } catch (err) {
+    showError(err);
+    return;
+  }
+  const tbody = document.getElementById('jobs');
+  tbody.replaceChildren();
+  jobs.forEach((job) => {
+    const progress = el('td');
+    if (job.status === 'running' || job.status === 'paused') {
+      const bar = el('progress');
+      bar.max = 1;
+      bar.value = job.fractionCompleted || 0;
+      progress.appendChild(bar);
+    }
+    const details = job.error || job.object || job.backup || '';
+    tbody.appendChild(row([
+      formatTime(job.createdAt),
+      job.kind,
+      job.cluster + '/' + job.collection,
+      el('td', job.status, 'status-' + job.status),
+      job.stage,
+      progress,
+      details,
+    ]));
+  });
+}
+
+async function load() {
+  try {
+    await loadIdentity();
+    await Promise.all([loadCollections(), loadBucket(), loadJobs()]);
+    showError(null);
+  } catch (err) {
+    showError(err);
+  }
+}
+
+document.addEventListener('DOMContentLoaded', () => {
+  document.getElementById('login').addEventListener('submit', (e) => {
+    e.preventDefault();
+    const input = document.getElementById('token');
+    sessionStorage.setItem(tokenKey, input.value);
+    input.value = '';
+    load();
+  });
+  document.getElementById('logout').addEventListener('click', () => {
+    sessionStorage.removeItem(tokenKey);
+    window.location.reload();
+  });
+  document.getElementById('backup').addEventListener('submit', (e) => {
+    e.preventDefault();
+    triggerBackup(document.getElementById('backup-cluster').value, document.getElementById('backup-collection').value);
+  });
+  document.getElementById('bucket-filter').addEventListener('submit', (e) => {
+    e.preventDefault();
+    loadBucket().catch(showError);
+  });
+  document.getElementById('jobs-filter').addEventListener('change', loadJobs);
+
+  setInterval(() => {
+    if (!document.hidden) {
+      loadJobs();
+    }
+  }, jobsInterval);
+  load();
+});
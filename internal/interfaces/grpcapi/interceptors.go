@@ -0,0 +1,140 @@
+package grpcapi
+
+import (
+	"context"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/audit"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/auth"
+	pb "gitlab.cmpayments.local/payments-gateway/backupsmanager/pkg/proto/backupsmanager/v1"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"net"
+	"time"
+)
+
+// interceptors authenticate the calls with the bearer tokens of the HTTP API and audit the mutating ones
+type interceptors struct {
+	logger        *zap.Logger
+	authenticator *auth.Authenticator
+	auditLog      *audit.Log
+}
+
+// authenticateUnary rejects unary calls without a valid bearer token in the authorization metadata, and adds the
+// Identity of the caller to the context of the accepted ones
+func (i *interceptors) authenticateUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := i.authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// authenticateStream is authenticateUnary for streaming calls
+func (i *interceptors) authenticateStream(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := i.authenticate(stream.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authenticatedStream{ServerStream: stream, ctx: ctx})
+}
+
+func (i *interceptors) authenticate(ctx context.Context, method string) (context.Context, error) {
+	var header string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			header = values[0]
+		}
+	}
+	identity, ok := i.authenticator.Authenticate(header)
+	if !ok {
+		i.logger.Warn("authenticate: unauthenticated call", zap.String("method", method), zap.String("remoteAddr", remoteAddr(ctx)))
+		err := status.Error(codes.Unauthenticated, "Unauthorized")
+		i.appendRecord(ctx, method, nil, err, time.Now())
+		return nil, err
+	}
+	return auth.NewContext(ctx, identity), nil
+}
+
+// authenticatedStream is a stream with the context of the authenticated caller
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// audited records the calls which trigger backups and restores in the audit log, like the HTTP API does, and the
+// denied calls of the other methods
+func (i *interceptors) audited(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	var params map[string][]string
+	switch req := req.(type) {
+	case *pb.TriggerBackupRequest:
+		params = map[string][]string{"cluster": {req.Cluster}, "collection": {req.Collection}}
+	case *pb.RestoreRequest:
+		params = map[string][]string{"cluster": {req.Cluster}, "collection": {req.Collection}, "backup": {req.Backup}}
+	default:
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		if status.Code(err) == codes.PermissionDenied {
+			i.appendRecord(ctx, info.FullMethod, nil, err, start)
+		}
+		return resp, err
+	}
+
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	i.appendRecord(ctx, info.FullMethod, params, err, start)
+	return resp, err
+}
+
+// auditedStream records the denied streaming calls in the audit log
+func (i *interceptors) auditedStream(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, stream)
+	if status.Code(err) == codes.PermissionDenied {
+		i.appendRecord(stream.Context(), info.FullMethod, nil, err, start)
+	}
+	return err
+}
+
+// appendRecord records the call of method with params, which returned err after it started at start, in the audit
+// log
+func (i *interceptors) appendRecord(ctx context.Context, method string, params map[string][]string, err error, start time.Time) {
+	code := status.Code(err)
+	result := audit.ResultSucceeded
+	switch {
+	case code == codes.Unauthenticated || code == codes.PermissionDenied:
+		result = audit.ResultDenied
+	case code != codes.OK:
+		result = audit.ResultFailed
+	}
+	identity, _ := auth.FromContext(ctx)
+	_ = i.auditLog.Append(audit.Record{
+		Actor:      identity.Name,
+		RemoteAddr: remoteAddr(ctx),
+		Method:     "gRPC",
+		Endpoint:   method,
+		Params:     params,
+		Status:     httpStatus(code),
+		Result:     result,
+		DurationMs: time.Since(start).Milliseconds(),
+	})
+}
+
+// remoteAddr returns the host of the caller of ctx
+func remoteAddr(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
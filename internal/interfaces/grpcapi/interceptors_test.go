@@ -0,0 +1,345 @@
+package grpcapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/app"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/audit"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/auth"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/cluster"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/interfaces/api"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/metrics"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/notify"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/watchdog"
+	pb "gitlab.cmpayments.local/payments-gateway/backupsmanager/pkg/proto/backupsmanager/v1"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/pkg/webdav"
+	"go.uber.org/zap"
+	"golang.org/x/sync/semaphore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testTokens are the bearer tokens accepted by the test server by name, those of the contract test of the HTTP API
+// and an operator limited to a collection
+var testTokens = map[string]auth.Token{
+	"admin":    {Roles: []string{auth.RoleAdmin}},
+	"reader":   {Roles: []string{auth.RoleReader}, Collections: []string{cluster.DefaultName + "/payments"}},
+	"operator": {Roles: []string{auth.RoleOperator}, Collections: []string{cluster.DefaultName + "/payments"}},
+}
+
+// testEngine is a healthy cluster which fails every job
+type testEngine struct{}
+
+func (testEngine) Name() string                   { return cluster.EngineCRDB }
+func (testEngine) Ping(ctx context.Context) error { return nil }
+func (testEngine) StartBackup(string, []byte) (cluster.JobRef, error) {
+	return cluster.JobRef{}, errors.New("not implemented")
+}
+func (testEngine) StartRestore(string, string, []byte) (cluster.JobRef, error) {
+	return cluster.JobRef{}, errors.New("not implemented")
+}
+func (testEngine) Job(context.Context, int64) (cluster.JobStatus, error) {
+	return cluster.JobStatus{}, errors.New("not implemented")
+}
+func (testEngine) WaitForJob(context.Context, int64, time.Duration, func(cluster.JobStatus)) (cluster.JobStatus, error) {
+	return cluster.JobStatus{}, errors.New("not implemented")
+}
+func (testEngine) PauseJob(context.Context, int64) error  { return errors.New("not implemented") }
+func (testEngine) ResumeJob(context.Context, int64) error { return errors.New("not implemented") }
+func (testEngine) CancelJob(context.Context, int64) error { return errors.New("not implemented") }
+
+// testServer serves the gRPC API in process with authentication, and returns a client, its audit log and its jobs
+func testServer(t *testing.T) (pb.BackupsClient, *audit.Log, *app.Jobs) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	logger := zap.NewNop()
+	workingDir := t.TempDir()
+
+	tokens := make(map[string]auth.Token, len(testTokens))
+	for name, token := range testTokens {
+		hash := sha256.Sum256([]byte(name + "-token"))
+		token.SHA256 = hex.EncodeToString(hash[:])
+		tokens[name] = token
+	}
+	authenticator, err := auth.NewAuthenticator(logger, auth.Config{Enabled: true, Tokens: tokens})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	appMetrics := metrics.NewMetrics(workingDir)
+	sem := appMetrics.Semaphore(semaphore.NewWeighted(10))
+	fileSystemWrapper := app.NewFileSystemWrapper(ctx, logger, workingDir)
+	clusters := cluster.NewRegistry()
+	clusters.Add(cluster.DefaultName, testEngine{})
+	webdavWrapper := webdav.NewWrapper(logger, fileSystemWrapper.PathBackups(), map[string]webdav.Credentials{})
+	catalog := app.NewCatalog(logger, fileSystemWrapper.PathCatalog())
+	auditLog, err := audit.NewLog(logger, fileSystemWrapper.PathAudit())
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifier := notify.NewDispatcher(logger)
+	jobs := app.NewJobs()
+	handler := api.RegisterHandler(ctx, logger, false, sem, clusters, webdavWrapper,
+		app.NewZipper(ctx, logger, sem, fileSystemWrapper),
+		app.NewEncryptor(ctx, logger, sem, fileSystemWrapper.PathEncrypted(), fileSystemWrapper.PathDecrypted()),
+		nil, fileSystemWrapper, jobs, catalog, auditLog, appMetrics, notifier,
+		watchdog.NewWatchdog(logger, watchdog.Config{}, catalog, appMetrics, notifier),
+		api.Config{}, http.NewServeMux())
+
+	listener := bufconn.Listen(1 << 20)
+	srv := NewServer(logger, handler, authenticator, auditLog, nil)
+	go func() {
+		_ = srv.Serve(listener)
+	}()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.DialContext(ctx, "bufconn", grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return listener.DialContext(ctx)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return pb.NewBackupsClient(conn), auditLog, jobs
+}
+
+// withToken returns ctx with the token of name in the authorization metadata, none when name is empty
+func withToken(ctx context.Context, name string) context.Context {
+	if name == "" {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+name+"-token")
+}
+
+func TestInterceptors(t *testing.T) {
+	client, auditLog, jobs := testServer(t)
+	inScope := jobs.Create(app.JobBackup, cluster.DefaultName, "payments", 1)
+	outOfScope := jobs.Create(app.JobBackup, cluster.DefaultName, "ledger", 2)
+
+	tests := []struct {
+		name  string
+		token string
+		call  func(ctx context.Context) error
+		code  codes.Code
+		// record is the audit record of the call, nil when it is not audited
+		record *audit.Record
+	}{
+		{
+			name: "without token",
+			call: func(ctx context.Context) error {
+				_, err := client.ListBackups(ctx, &pb.ListBackupsRequest{})
+				return err
+			},
+			code:   codes.Unauthenticated,
+			record: &audit.Record{Endpoint: "/backupsmanager.v1.Backups/ListBackups", Status: http.StatusUnauthorized, Result: audit.ResultDenied},
+		},
+		{
+			name:  "unknown token",
+			token: "unknown",
+			call: func(ctx context.Context) error {
+				_, err := client.TriggerBackup(ctx, &pb.TriggerBackupRequest{Cluster: cluster.DefaultName, Collection: "payments"})
+				return err
+			},
+			code:   codes.Unauthenticated,
+			record: &audit.Record{Endpoint: "/backupsmanager.v1.Backups/TriggerBackup", Status: http.StatusUnauthorized, Result: audit.ResultDenied},
+		},
+		{
+			name:  "unauthenticated stream",
+			token: "unknown",
+			call: func(ctx context.Context) error {
+				stream, err := client.WatchJob(ctx, &pb.WatchJobRequest{Id: inScope.ID})
+				if err != nil {
+					return err
+				}
+				_, err = stream.Recv()
+				return err
+			},
+			code:   codes.Unauthenticated,
+			record: &audit.Record{Endpoint: "/backupsmanager.v1.Backups/WatchJob", Status: http.StatusUnauthorized, Result: audit.ResultDenied},
+		},
+		{
+			name:  "read is not audited",
+			token: "reader",
+			call: func(ctx context.Context) error {
+				_, err := client.ListBackups(ctx, &pb.ListBackupsRequest{})
+				return err
+			},
+			code: codes.OK,
+		},
+		{
+			name:  "job in scope",
+			token: "reader",
+			call: func(ctx context.Context) error {
+				_, err := client.GetJob(ctx, &pb.GetJobRequest{Id: inScope.ID})
+				return err
+			},
+			code: codes.OK,
+		},
+		{
+			name:  "job out of scope",
+			token: "reader",
+			call: func(ctx context.Context) error {
+				_, err := client.GetJob(ctx, &pb.GetJobRequest{Id: outOfScope.ID})
+				return err
+			},
+			code:   codes.PermissionDenied,
+			record: &audit.Record{Actor: "reader", Endpoint: "/backupsmanager.v1.Backups/GetJob", Status: http.StatusForbidden, Result: audit.ResultDenied},
+		},
+		{
+			name:  "watched job out of scope",
+			token: "reader",
+			call: func(ctx context.Context) error {
+				stream, err := client.WatchJob(ctx, &pb.WatchJobRequest{Id: outOfScope.ID})
+				if err != nil {
+					return err
+				}
+				_, err = stream.Recv()
+				return err
+			},
+			code:   codes.PermissionDenied,
+			record: &audit.Record{Actor: "reader", Endpoint: "/backupsmanager.v1.Backups/WatchJob", Status: http.StatusForbidden, Result: audit.ResultDenied},
+		},
+		{
+			name:  "backup without role",
+			token: "reader",
+			call: func(ctx context.Context) error {
+				_, err := client.TriggerBackup(ctx, &pb.TriggerBackupRequest{Cluster: cluster.DefaultName, Collection: "payments"})
+				return err
+			},
+			code: codes.PermissionDenied,
+			record: &audit.Record{
+				Actor:    "reader",
+				Endpoint: "/backupsmanager.v1.Backups/TriggerBackup",
+				Params:   map[string][]string{"cluster": {cluster.DefaultName}, "collection": {"payments"}},
+				Status:   http.StatusForbidden,
+				Result:   audit.ResultDenied,
+			},
+		},
+		{
+			name:  "backup out of scope",
+			token: "operator",
+			call: func(ctx context.Context) error {
+				_, err := client.TriggerBackup(ctx, &pb.TriggerBackupRequest{Cluster: cluster.DefaultName, Collection: "ledger"})
+				return err
+			},
+			code: codes.PermissionDenied,
+			record: &audit.Record{
+				Actor:    "operator",
+				Endpoint: "/backupsmanager.v1.Backups/TriggerBackup",
+				Params:   map[string][]string{"cluster": {cluster.DefaultName}, "collection": {"ledger"}},
+				Status:   http.StatusForbidden,
+				Result:   audit.ResultDenied,
+			},
+		},
+		{
+			name:  "backup in scope",
+			token: "operator",
+			call: func(ctx context.Context) error {
+				_, err := client.TriggerBackup(ctx, &pb.TriggerBackupRequest{Cluster: cluster.DefaultName, Collection: "payments"})
+				return err
+			},
+			// the test engine fails every backup
+			code: codes.Internal,
+			record: &audit.Record{
+				Actor:    "operator",
+				Endpoint: "/backupsmanager.v1.Backups/TriggerBackup",
+				Params:   map[string][]string{"cluster": {cluster.DefaultName}, "collection": {"payments"}},
+				Status:   http.StatusInternalServerError,
+				Result:   audit.ResultFailed,
+			},
+		},
+		{
+			name:  "invalid backup",
+			token: "admin",
+			call: func(ctx context.Context) error {
+				_, err := client.TriggerBackup(ctx, &pb.TriggerBackupRequest{Cluster: "unknown", Collection: "payments"})
+				return err
+			},
+			code: codes.NotFound,
+			record: &audit.Record{
+				Actor:    "admin",
+				Endpoint: "/backupsmanager.v1.Backups/TriggerBackup",
+				Params:   map[string][]string{"cluster": {"unknown"}, "collection": {"payments"}},
+				Status:   http.StatusNotFound,
+				Result:   audit.ResultFailed,
+			},
+		},
+		{
+			name:  "restore",
+			token: "admin",
+			call: func(ctx context.Context) error {
+				_, err := client.Restore(ctx, &pb.RestoreRequest{Cluster: cluster.DefaultName, Collection: "payments", Backup: "/2022/01/24-163045.99"})
+				return err
+			},
+			code: codes.Internal,
+			record: &audit.Record{
+				Actor:    "admin",
+				Endpoint: "/backupsmanager.v1.Backups/Restore",
+				Params:   map[string][]string{"cluster": {cluster.DefaultName}, "collection": {"payments"}, "backup": {"/2022/01/24-163045.99"}},
+				Status:   http.StatusInternalServerError,
+				Result:   audit.ResultFailed,
+			},
+		},
+		{
+			name:  "restore without role",
+			token: "operator",
+			call: func(ctx context.Context) error {
+				_, err := client.Restore(ctx, &pb.RestoreRequest{Cluster: cluster.DefaultName, Collection: "payments"})
+				return err
+			},
+			code: codes.PermissionDenied,
+			record: &audit.Record{
+				Actor:    "operator",
+				Endpoint: "/backupsmanager.v1.Backups/Restore",
+				Params:   map[string][]string{"cluster": {cluster.DefaultName}, "collection": {"payments"}, "backup": {""}},
+				Status:   http.StatusForbidden,
+				Result:   audit.ResultDenied,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, err := auditLog.Query(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithTimeout(withToken(context.Background(), tt.token), 10*time.Second)
+			defer cancel()
+
+			if code := status.Code(tt.call(ctx)); code != tt.code {
+				t.Fatalf("code is %s, want %s", code, tt.code)
+			}
+
+			records, err := auditLog.Query(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			records = records[len(before):]
+			if tt.record == nil {
+				if len(records) != 0 {
+					t.Errorf("call was audited: %+v", records)
+				}
+				return
+			}
+			if len(records) != 1 {
+				t.Fatalf("call has %d audit records, want 1: %+v", len(records), records)
+			}
+			got := records[0]
+			if got.Actor != tt.record.Actor || got.Method != "gRPC" || got.Endpoint != tt.record.Endpoint ||
+				got.Status != tt.record.Status || got.Result != tt.record.Result || !reflect.DeepEqual(got.Params, tt.record.Params) {
+				t.Errorf("audit record is %+v, want %+v", got, *tt.record)
+			}
+		})
+	}
+}
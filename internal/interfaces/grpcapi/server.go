@@ -0,0 +1,233 @@
+package grpcapi
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/app"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/audit"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/auth"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/interfaces/api"
+	pb "gitlab.cmpayments.local/payments-gateway/backupsmanager/pkg/proto/backupsmanager/v1"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// watchInterval is the interval to check the jobs streamed by WatchJob for changes
+const watchInterval = time.Second
+
+// Server serves the gRPC API with the backup and restore pipeline of the HTTP API
+type Server struct {
+	pb.UnimplementedBackupsServer
+	logger  *zap.Logger
+	handler *api.Handler
+}
+
+// NewServer returns the gRPC server of the API. Calls are authenticated by authenticator like the HTTP requests,
+// the backups and restores they trigger and the denied calls are recorded in auditLog. tlsConfig may be nil to
+// serve plain connections.
+func NewServer(logger *zap.Logger, handler *api.Handler, authenticator *auth.Authenticator, auditLog *audit.Log, tlsConfig *tls.Config) *grpc.Server {
+	interceptors := &interceptors{logger: logger, authenticator: authenticator, auditLog: auditLog}
+	options := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(interceptors.authenticateUnary, interceptors.audited),
+		grpc.ChainStreamInterceptor(interceptors.authenticateStream, interceptors.auditedStream),
+	}
+	if tlsConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	srv := grpc.NewServer(options...)
+	pb.RegisterBackupsServer(srv, &Server{logger: logger, handler: handler})
+	return srv
+}
+
+// TriggerBackup backs up the cluster into the collection
+func (s *Server) TriggerBackup(ctx context.Context, req *pb.TriggerBackupRequest) (*pb.TriggerBackupResponse, error) {
+	if err := authorize(ctx, auth.ActionBackup, req.Cluster, req.Collection); err != nil {
+		return nil, err
+	}
+	job, detached, err := s.handler.StartBackup(ctx, req.Cluster, req.Collection, []byte(req.Options))
+	if err != nil {
+		return nil, s.statusError("TriggerBackup", err)
+	}
+	return &pb.TriggerBackupResponse{Job: toJob(job), Detached: detached}, nil
+}
+
+// ListBackups returns the local backups per collection in the scope of the caller
+func (s *Server) ListBackups(ctx context.Context, req *pb.ListBackupsRequest) (*pb.ListBackupsResponse, error) {
+	if err := authorize(ctx, auth.ActionRead, "", ""); err != nil {
+		return nil, err
+	}
+	backups, err := s.handler.Backups(ctx)
+	if err != nil {
+		return nil, s.statusError("ListBackups", err)
+	}
+
+	resp := &pb.ListBackupsResponse{}
+	for key, dirs := range backups {
+		// backups are listed per {cluster}/{collection} as /{cluster}/{collection}/{year}/{month}/{day-time}
+		elements := strings.SplitN(key, "/", 2)
+		if len(elements) != 2 || (req.Cluster != "" && elements[0] != req.Cluster) || (req.Collection != "" && elements[1] != req.Collection) {
+			continue
+		}
+		collection := &pb.CollectionBackups{Cluster: elements[0], Collection: elements[1]}
+		for _, dir := range dirs {
+			collection.Backups = append(collection.Backups, strings.TrimPrefix(dir, "/"+key))
+		}
+		sort.Strings(collection.Backups)
+		resp.Collections = append(resp.Collections, collection)
+	}
+	sort.Slice(resp.Collections, func(i, j int) bool {
+		if resp.Collections[i].Cluster != resp.Collections[j].Cluster {
+			return resp.Collections[i].Cluster < resp.Collections[j].Cluster
+		}
+		return resp.Collections[i].Collection < resp.Collections[j].Collection
+	})
+	return resp, nil
+}
+
+// Restore restores a backup of the collection into the cluster
+func (s *Server) Restore(ctx context.Context, req *pb.RestoreRequest) (*pb.RestoreResponse, error) {
+	if err := authorize(ctx, auth.ActionRestore, req.Cluster, req.Collection); err != nil {
+		return nil, err
+	}
+	job, detached, err := s.handler.StartRestore(ctx, req.Cluster, req.Collection, req.Backup, []byte(req.Options))
+	if err != nil {
+		return nil, s.statusError("Restore", err)
+	}
+	if !detached {
+		return &pb.RestoreResponse{}, nil
+	}
+	return &pb.RestoreResponse{Job: toJob(job)}, nil
+}
+
+// GetJob returns a job of a collection in the scope of the caller
+func (s *Server) GetJob(ctx context.Context, req *pb.GetJobRequest) (*pb.Job, error) {
+	job, err := s.job(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	return toJob(job), nil
+}
+
+// WatchJob sends the job every time it changed, until it finished or the call is canceled
+func (s *Server) WatchJob(req *pb.WatchJobRequest, stream pb.Backups_WatchJobServer) error {
+	job, err := s.job(stream.Context(), req.Id)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		if err := stream.Send(toJob(job)); err != nil {
+			return err
+		}
+		if job.Finished() {
+			return nil
+		}
+
+		for sent := job; job == sent; {
+			select {
+			case <-stream.Context().Done():
+				return status.FromContextError(stream.Context().Err()).Err()
+			case <-ticker.C:
+			}
+			var ok bool
+			if job, ok = s.handler.Job(req.Id); !ok {
+				return status.Error(codes.NotFound, "Job not found")
+			}
+		}
+	}
+}
+
+// job returns the job with the given id when the caller may read its collection
+func (s *Server) job(ctx context.Context, id string) (app.Job, error) {
+	job, ok := s.handler.Job(id)
+	if !ok {
+		return app.Job{}, status.Error(codes.NotFound, "Job not found")
+	}
+	if err := authorize(ctx, auth.ActionRead, job.Cluster, job.Collection); err != nil {
+		return app.Job{}, err
+	}
+	return job, nil
+}
+
+// statusError returns the status of err returned by the pipeline of the API, hiding the internal errors
+func (s *Server) statusError(method string, err error) error {
+	var apiErr *api.Error
+	if errors.As(err, &apiErr) {
+		return status.Error(grpcCode(apiErr.Status), apiErr.Message)
+	}
+	s.logger.Error(method+": error starting job", zap.Error(err))
+	return status.Error(codes.Internal, "Some Error Occurred")
+}
+
+// authorize returns a PermissionDenied error unless the caller may perform action on the collection of the cluster
+func authorize(ctx context.Context, action auth.Action, cluster string, collection string) error {
+	identity, ok := auth.FromContext(ctx)
+	if !ok || !identity.Allowed(action, cluster, collection) {
+		return status.Error(codes.PermissionDenied, "Forbidden")
+	}
+	return nil
+}
+
+// statusCodes maps the HTTP statuses of the errors of the API to gRPC codes
+var statusCodes = []struct {
+	status int
+	code   codes.Code
+}{
+	{http.StatusOK, codes.OK},
+	{http.StatusBadRequest, codes.InvalidArgument},
+	{http.StatusUnauthorized, codes.Unauthenticated},
+	{http.StatusForbidden, codes.PermissionDenied},
+	{http.StatusNotFound, codes.NotFound},
+	{http.StatusConflict, codes.FailedPrecondition},
+	{http.StatusNotImplemented, codes.Unimplemented},
+	{http.StatusServiceUnavailable, codes.Unavailable},
+}
+
+// grpcCode returns the gRPC code of an HTTP status, Internal for the unknown ones
+func grpcCode(httpStatus int) codes.Code {
+	for _, c := range statusCodes {
+		if c.status == httpStatus {
+			return c.code
+		}
+	}
+	return codes.Internal
+}
+
+// httpStatus returns the HTTP status of a gRPC code, InternalServerError for the unknown ones
+func httpStatus(code codes.Code) int {
+	for _, c := range statusCodes {
+		if c.code == code {
+			return c.status
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+func toJob(job app.Job) *pb.Job {
+	return &pb.Job{
+		Id:                job.ID,
+		Kind:              string(job.Kind),
+		Cluster:           job.Cluster,
+		Collection:        job.Collection,
+		EngineJobId:       job.EngineJobID,
+		Status:            string(job.Status),
+		Stage:             string(job.Stage),
+		FractionCompleted: job.FractionCompleted,
+		Error:             job.Error,
+		Backup:            job.Backup,
+		Object:            job.Object,
+		CreatedAt:         timestamppb.New(job.CreatedAt),
+		UpdatedAt:         timestamppb.New(job.UpdatedAt),
+	}
+}
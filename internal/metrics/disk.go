@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// diskUsageMaxAge is how long the disk usage is cached, walking the working dir on every scrape is too expensive
+const diskUsageMaxAge = time.Minute
+
+// diskUsageCollector reports the bytes used per directory in the working dir
+type diskUsageCollector struct {
+	workingDir string
+	desc       *prometheus.Desc
+	mu         sync.Mutex
+	usage      map[string]int64
+	measuredAt time.Time
+}
+
+func newDiskUsageCollector(workingDir string) *diskUsageCollector {
+	return &diskUsageCollector{
+		workingDir: workingDir,
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "working_dir_bytes"),
+			"Bytes used per directory in the working dir.",
+			[]string{"dir"}, nil),
+	}
+}
+
+func (c *diskUsageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *diskUsageCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.measuredAt) > diskUsageMaxAge {
+		c.usage = c.measure()
+		c.measuredAt = time.Now()
+	}
+	for dir, size := range c.usage {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(size), dir)
+	}
+}
+
+// measure returns the size of the files per directory and file in the working dir
+func (c *diskUsageCollector) measure() map[string]int64 {
+	usage := make(map[string]int64)
+	entries, err := ioutil.ReadDir(c.workingDir)
+	if err != nil {
+		return usage
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			usage[entry.Name()] = entry.Size()
+			continue
+		}
+		var size int64
+		_ = filepath.Walk(filepath.Join(c.workingDir, entry.Name()), func(_ string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				size += info.Size()
+			}
+			// files removed while walking are skipped
+			return nil
+		})
+		usage[entry.Name()] = size
+	}
+	return usage
+}
@@ -0,0 +1,236 @@
+package metrics
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/sync/semaphore"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const namespace = "backupsmanager"
+
+// Metrics are the Prometheus metrics of the backups
+type Metrics struct {
+	registry          *prometheus.Registry
+	backupsTriggered  *prometheus.CounterVec
+	backupsSucceeded  *prometheus.CounterVec
+	backupsFailed     *prometheus.CounterVec
+	restoresSucceeded *prometheus.CounterVec
+	restoresFailed    *prometheus.CounterVec
+	lastSuccess       *prometheus.GaugeVec
+	lastOffsite       *prometheus.GaugeVec
+	freshnessViolated *prometheus.GaugeVec
+	stageDuration     *prometheus.HistogramVec
+	bytesProcessed    *prometheus.CounterVec
+	semaphoreWait     prometheus.Histogram
+	semaphoreInFlight prometheus.Gauge
+	webdavRequests    *prometheus.CounterVec
+}
+
+// NewMetrics returns the metrics, including the disk usage of the directories in workingDir
+func NewMetrics(workingDir string) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		backupsTriggered: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "backups_triggered_total",
+			Help:      "Backups triggered or ingested per collection.",
+		}, []string{"cluster", "collection"}),
+		backupsSucceeded: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "backups_succeeded_total",
+			Help:      "Backups processed successfully per collection.",
+		}, []string{"cluster", "collection"}),
+		backupsFailed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "backups_failed_total",
+			Help:      "Backups which failed in any stage per collection.",
+		}, []string{"cluster", "collection"}),
+		restoresSucceeded: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "restores_succeeded_total",
+			Help:      "Restores which succeeded per collection.",
+		}, []string{"cluster", "collection"}),
+		restoresFailed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "restores_failed_total",
+			Help:      "Restores which failed or could not be started per collection.",
+		}, []string{"cluster", "collection"}),
+		lastSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "last_successful_backup_timestamp_seconds",
+			Help:      "Unix time of the last successful backup per collection.",
+		}, []string{"cluster", "collection"}),
+		lastOffsite: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "last_offsite_backup_timestamp_seconds",
+			Help:      "Unix time of the last successful backup uploaded to the bucket per collection with a freshness SLO.",
+		}, []string{"cluster", "collection"}),
+		freshnessViolated: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "freshness_slo_violated",
+			Help:      "1 when the backups of a collection violate its freshness SLO, 0 otherwise.",
+		}, []string{"cluster", "collection"}),
+		stageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "stage_duration_seconds",
+			Help:      "Duration of the stages of backups and restores.",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 16),
+		}, []string{"stage"}),
+		bytesProcessed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "bytes_processed_total",
+			Help:      "Bytes produced per stage.",
+		}, []string{"stage"}),
+		semaphoreWait: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "semaphore_wait_seconds",
+			Help:      "Time spent waiting for the file system semaphore.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 4, 12),
+		}),
+		semaphoreInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "semaphore_in_flight",
+			Help:      "Operations holding the file system semaphore.",
+		}),
+		webdavRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "webdav_requests_total",
+			Help:      "WebDAV requests by method and status.",
+		}, []string{"method", "status"}),
+	}
+	m.registry.MustRegister(
+		m.backupsTriggered,
+		m.backupsSucceeded,
+		m.backupsFailed,
+		m.restoresSucceeded,
+		m.restoresFailed,
+		m.lastSuccess,
+		m.lastOffsite,
+		m.freshnessViolated,
+		m.stageDuration,
+		m.bytesProcessed,
+		m.semaphoreWait,
+		m.semaphoreInFlight,
+		m.webdavRequests,
+		newDiskUsageCollector(workingDir),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Registerer registers additional metrics
+func (m *Metrics) Registerer() prometheus.Registerer {
+	return m.registry
+}
+
+// BackupTriggered counts a backup triggered into the collection of the cluster
+func (m *Metrics) BackupTriggered(cluster string, collection string) {
+	m.backupsTriggered.WithLabelValues(cluster, collection).Inc()
+}
+
+// BackupSucceeded counts a successful backup of the collection and sets its last success time
+func (m *Metrics) BackupSucceeded(cluster string, collection string) {
+	m.backupsSucceeded.WithLabelValues(cluster, collection).Inc()
+	m.SetLastSuccess(cluster, collection, time.Now())
+}
+
+// BackupFailed counts a failed backup of the collection
+func (m *Metrics) BackupFailed(cluster string, collection string) {
+	m.backupsFailed.WithLabelValues(cluster, collection).Inc()
+}
+
+// RestoreSucceeded counts a successful restore of the collection
+func (m *Metrics) RestoreSucceeded(cluster string, collection string) {
+	m.restoresSucceeded.WithLabelValues(cluster, collection).Inc()
+}
+
+// RestoreFailed counts a failed restore of the collection
+func (m *Metrics) RestoreFailed(cluster string, collection string) {
+	m.restoresFailed.WithLabelValues(cluster, collection).Inc()
+}
+
+// SetLastSuccess sets the time of the last successful backup of the collection, e.g. from the catalog on startup
+func (m *Metrics) SetLastSuccess(cluster string, collection string, t time.Time) {
+	m.lastSuccess.WithLabelValues(cluster, collection).Set(float64(t.Unix()))
+}
+
+// SetFreshness sets the freshness SLO status of the collection, lastOffsite is skipped when zero
+func (m *Metrics) SetFreshness(cluster string, collection string, lastOffsite time.Time, violated bool) {
+	if !lastOffsite.IsZero() {
+		m.lastOffsite.WithLabelValues(cluster, collection).Set(float64(lastOffsite.Unix()))
+	}
+	value := 0.0
+	if violated {
+		value = 1
+	}
+	m.freshnessViolated.WithLabelValues(cluster, collection).Set(value)
+}
+
+// ObserveStage records the duration of a stage, e.g. zip
+func (m *Metrics) ObserveStage(stage string, d time.Duration) {
+	m.stageDuration.WithLabelValues(stage).Observe(d.Seconds())
+}
+
+// AddBytes counts the bytes produced by a stage
+func (m *Metrics) AddBytes(stage string, n int64) {
+	m.bytesProcessed.WithLabelValues(stage).Add(float64(n))
+}
+
+// WebDAVRequest counts a WebDAV request
+func (m *Metrics) WebDAVRequest(method string, status int) {
+	m.webdavRequests.WithLabelValues(method, strconv.Itoa(status)).Inc()
+}
+
+// Semaphore measures the wait time and the holders of sem
+func (m *Metrics) Semaphore(sem *semaphore.Weighted) *Semaphore {
+	return &Semaphore{
+		sem:      sem,
+		wait:     m.semaphoreWait,
+		inFlight: m.semaphoreInFlight,
+	}
+}
+
+// Semaphore is an instrumented semaphore.Weighted
+type Semaphore struct {
+	sem      *semaphore.Weighted
+	wait     prometheus.Histogram
+	inFlight prometheus.Gauge
+}
+
+// Acquire acquires the semaphore with a weight of n, blocking until resources are available or ctx is done
+func (s *Semaphore) Acquire(ctx context.Context, n int64) error {
+	start := time.Now()
+	err := s.sem.Acquire(ctx, n)
+	s.wait.Observe(time.Since(start).Seconds())
+	if err == nil {
+		s.inFlight.Add(float64(n))
+	}
+	return err
+}
+
+// TryAcquire acquires the semaphore with a weight of n without blocking, it returns false when resources are not
+// available
+func (s *Semaphore) TryAcquire(n int64) bool {
+	if !s.sem.TryAcquire(n) {
+		return false
+	}
+	s.inFlight.Add(float64(n))
+	return true
+}
+
+// Release releases the semaphore with a weight of n
+func (s *Semaphore) Release(n int64) {
+	s.inFlight.Sub(float64(n))
+	s.sem.Release(n)
+}
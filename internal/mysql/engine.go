@@ -0,0 +1,365 @@
+package mysql
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/cluster"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/pkg/database"
+	"go.uber.org/zap"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// dumpFileName is the name of the logical dump in the data directory of a backup
+	dumpFileName = "dump.sql"
+	// metadataFileName is the name of the file with the binlog position in the data directory of a backup
+	metadataFileName = "metadata.json"
+	// maxStderrSize limits the output of the client tools kept for error messages
+	maxStderrSize = 4096
+	// maxHeaderLines limits the lines of the dump searched for the binlog position
+	maxHeaderLines = 100
+)
+
+// binlogPosition matches the commented CHANGE MASTER / CHANGE REPLICATION SOURCE statement written by --master-data=2
+var binlogPosition = regexp.MustCompile(`CHANGE (?:MASTER|REPLICATION SOURCE) TO (?:MASTER|SOURCE)_LOG_FILE='([^']+)', (?:MASTER|SOURCE)_LOG_POS=(\d+)`)
+
+var _ cluster.Engine = (*Engine)(nil)
+
+// Engine backs up a MySQL or MariaDB server with mysqldump and restores it with the mysql client
+type Engine struct {
+	logger      *zap.Logger
+	db          *sql.DB
+	config      database.Config
+	backupsPath string
+	jobs        *cluster.LocalJobs
+}
+
+// NewEngine returns the engine of a MySQL cluster writing its collections into backupsPath
+func NewEngine(ctx context.Context, logger *zap.Logger, db *sql.DB, config database.Config, backupsPath string) *Engine {
+	return &Engine{
+		logger:      logger,
+		db:          db,
+		config:      config,
+		backupsPath: backupsPath,
+		jobs:        cluster.NewLocalJobs(ctx),
+	}
+}
+
+// BackupOptions holds the user-selectable options of mysqldump
+type BackupOptions struct {
+	// Databases to dump, defaults to the configured database
+	Databases []string `json:"databases"`
+	// Tables to dump, only allowed for a single database
+	Tables []string `json:"tables"`
+	// Routines includes stored procedures and functions
+	Routines bool `json:"routines"`
+	// Events includes scheduled events
+	Events bool `json:"events"`
+	// SkipBinlogPosition does not record the binlog position, required when binary logging is disabled
+	SkipBinlogPosition bool `json:"skip_binlog_position"`
+}
+
+func (o BackupOptions) Assert() error {
+	if len(o.Tables) > 0 && len(o.Databases) > 1 {
+		return errors.New("tables are only allowed for a single database")
+	}
+	return assertNames(o.Databases, o.Tables)
+}
+
+// RestoreOptions holds the user-selectable options of a restore with the mysql client
+type RestoreOptions struct {
+	// Database to restore a single database dump into, defaults to the configured database
+	Database string `json:"database"`
+}
+
+func (o RestoreOptions) Assert() error {
+	if o.Database != "" {
+		return assertNames([]string{o.Database})
+	}
+	return nil
+}
+
+// Metadata is stored next to the dump of every backup
+type Metadata struct {
+	Databases      []string `json:"databases"`
+	BinlogFile     string   `json:"binlog_file,omitempty"`
+	BinlogPosition int64    `json:"binlog_position,omitempty"`
+}
+
+// assertNames validates names which are passed as separate arguments, so they are never interpreted by a shell.
+// Names starting with a dash are refused as they would be taken as options.
+func assertNames(lists ...[]string) error {
+	for _, names := range lists {
+		for _, name := range names {
+			if name == "" || len(name) > 64 || strings.ContainsRune(name, 0) || strings.HasPrefix(name, "-") {
+				return fmt.Errorf("name %q is invalid", name)
+			}
+		}
+	}
+	return nil
+}
+
+// Name returns the engine name of MySQL clusters
+func (e *Engine) Name() string {
+	return cluster.EngineMySQL
+}
+
+// Ping checks the connection with the server
+func (e *Engine) Ping(ctx context.Context) error {
+	if err := e.db.PingContext(ctx); err != nil {
+		return &database.Error{Err: err}
+	}
+	return nil
+}
+
+// StartBackup runs mysqldump in the background into a new backup of collection, with the JSON encoded BackupOptions
+func (e *Engine) StartBackup(collection string, options []byte) (cluster.JobRef, error) {
+	var backupOptions BackupOptions
+	if err := cluster.DecodeOptions(options, &backupOptions); err != nil {
+		return cluster.JobRef{}, err
+	}
+	if err := backupOptions.Assert(); err != nil {
+		return cluster.JobRef{}, &cluster.OptionsError{Err: err}
+	}
+	if len(backupOptions.Databases) == 0 {
+		backupOptions.Databases = []string{e.config.Database}
+	}
+
+	collectionDir := path.Join(e.backupsPath, collection)
+	subdir := cluster.BackupDirName(time.Now())
+	dataDir := path.Join(collectionDir, subdir, "data")
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		e.logger.Error("StartBackup: error creating backup directory", zap.String("directory", dataDir), zap.Error(err))
+		return cluster.JobRef{}, err
+	}
+
+	// a consistent snapshot with the binlog position of that snapshot written as comment in the dump
+	args := []string{"--single-transaction", "--result-file=" + path.Join(dataDir, dumpFileName)}
+	if !backupOptions.SkipBinlogPosition {
+		args = append(args, "--master-data=2")
+	}
+	if backupOptions.Routines {
+		args = append(args, "--routines")
+	}
+	if backupOptions.Events {
+		args = append(args, "--events")
+	}
+	if len(backupOptions.Databases) > 1 {
+		args = append(args, "--databases")
+		args = append(args, backupOptions.Databases...)
+	} else {
+		args = append(args, backupOptions.Databases[0])
+		args = append(args, backupOptions.Tables...)
+	}
+
+	jobID := e.jobs.Start(func(ctx context.Context) error {
+		if err := e.backup(ctx, args, dataDir, backupOptions.Databases); err != nil {
+			_ = os.RemoveAll(path.Join(collectionDir, subdir))
+			return err
+		}
+		// LATEST points to the last successful backup, as CRDB does for its collections
+		return ioutil.WriteFile(path.Join(collectionDir, "LATEST"), []byte(subdir), 0600)
+	})
+	e.logger.Info("StartBackup: mysqldump started", zap.String("collection", collection), zap.String("subdir", subdir), zap.Int64("jobID", jobID))
+	return cluster.JobRef{ID: jobID, Detached: true}, nil
+}
+
+func (e *Engine) backup(ctx context.Context, args []string, dataDir string, databases []string) error {
+	if err := e.run(ctx, "mysqldump", args, nil); err != nil {
+		return err
+	}
+
+	metadata := Metadata{Databases: databases}
+	file, position, err := readBinlogPosition(path.Join(dataDir, dumpFileName))
+	if err != nil {
+		// the binlog position was skipped, the dump is still usable
+		e.logger.Warn("backup: binlog position not found in dump", zap.Error(err))
+	} else {
+		metadata.BinlogFile = file
+		metadata.BinlogPosition = position
+	}
+
+	content, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path.Join(dataDir, metadataFileName), content, 0600)
+}
+
+// readBinlogPosition reads the binlog position from the header of a dump made with --master-data=2
+func readBinlogPosition(dumpFile string) (string, int64, error) {
+	f, err := os.Open(dumpFile)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for i := 0; i < maxHeaderLines && scanner.Scan(); i++ {
+		if match := binlogPosition.FindStringSubmatch(scanner.Text()); match != nil {
+			position, err := strconv.ParseInt(match[2], 10, 64)
+			return match[1], position, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", 0, err
+	}
+	return "", 0, errors.New("no binlog position in dump header")
+}
+
+// StartRestore feeds the dump of the backup subdir of collection to the mysql client in the background, with the
+// JSON encoded RestoreOptions. An empty subdir restores the LATEST backup.
+func (e *Engine) StartRestore(collection string, subdir string, options []byte) (cluster.JobRef, error) {
+	var restoreOptions RestoreOptions
+	if err := cluster.DecodeOptions(options, &restoreOptions); err != nil {
+		return cluster.JobRef{}, err
+	}
+	if err := restoreOptions.Assert(); err != nil {
+		return cluster.JobRef{}, &cluster.OptionsError{Err: err}
+	}
+
+	dataDir, err := e.dataDir(collection, subdir)
+	if err != nil {
+		return cluster.JobRef{}, err
+	}
+
+	var metadata Metadata
+	if content, err := ioutil.ReadFile(path.Join(dataDir, metadataFileName)); err != nil {
+		return cluster.JobRef{}, fmt.Errorf("error reading backup metadata: %w", err)
+	} else if err := json.Unmarshal(content, &metadata); err != nil {
+		return cluster.JobRef{}, fmt.Errorf("error reading backup metadata: %w", err)
+	}
+
+	// dumps of several databases select their databases themselves
+	var args []string
+	if len(metadata.Databases) <= 1 {
+		target := e.config.Database
+		if restoreOptions.Database != "" {
+			target = restoreOptions.Database
+		}
+		args = append(args, target)
+	} else if restoreOptions.Database != "" {
+		return cluster.JobRef{}, &cluster.OptionsError{Err: errors.New("database is only allowed for single database backups")}
+	}
+
+	dumpFile := path.Join(dataDir, dumpFileName)
+	jobID := e.jobs.Start(func(ctx context.Context) error {
+		f, err := os.Open(dumpFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return e.run(ctx, "mysql", args, f)
+	})
+	e.logger.Info("StartRestore: mysql restore started", zap.String("dumpFile", dumpFile), zap.Int64("jobID", jobID))
+	return cluster.JobRef{ID: jobID, Detached: true}, nil
+}
+
+// dataDir returns the data directory of the backup subdir of collection, or of the LATEST backup
+func (e *Engine) dataDir(collection string, subdir string) (string, error) {
+	collectionDir := path.Join(e.backupsPath, collection)
+	if subdir == "" {
+		latest, err := ioutil.ReadFile(path.Join(collectionDir, "LATEST"))
+		if err != nil {
+			return "", fmt.Errorf("error reading LATEST backup: %w", err)
+		}
+		subdir = strings.TrimSpace(string(latest))
+	}
+	if !cluster.ValidBackupDirName(subdir) {
+		return "", &cluster.OptionsError{Err: fmt.Errorf("invalid backup %q", subdir)}
+	}
+	return path.Join(collectionDir, subdir, "data"), nil
+}
+
+// run runs a client tool with the credentials in a temporary defaults file, so they do not show up in the
+// process list
+func (e *Engine) run(ctx context.Context, tool string, args []string, stdin io.Reader) error {
+	defaultsFile, err := e.writeDefaultsFile()
+	if err != nil {
+		return fmt.Errorf("error writing defaults file: %w", err)
+	}
+	defer os.Remove(defaultsFile)
+
+	// --defaults-extra-file must be the first argument
+	cmd := exec.CommandContext(ctx, cluster.ToolPath(e.config.ToolsDir, tool), append([]string{"--defaults-extra-file=" + defaultsFile}, args...)...)
+	cmd.Stdin = stdin
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if len(message) > maxStderrSize {
+			message = message[:maxStderrSize]
+		}
+		e.logger.Error("run: client tool failed", zap.String("tool", tool), zap.String("stderr", message), zap.Error(err))
+		return fmt.Errorf("%s failed: %v: %s", tool, err, message)
+	}
+	return nil
+}
+
+func (e *Engine) writeDefaultsFile() (string, error) {
+	host, port, err := net.SplitHostPort(e.config.Host)
+	if err != nil {
+		host, port = e.config.Host, "3306"
+	}
+
+	f, err := ioutil.TempFile("", "backupsmanager-mysql-*.cnf")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "[client]\nhost=%s\nport=%s\nuser=%s\npassword=%s\n",
+		optionValue(host), optionValue(port), optionValue(e.config.User), optionValue(e.config.Password))
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// optionValue quotes a value for a MySQL option file
+func optionValue(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + replacer.Replace(value) + `"`
+}
+
+// Job returns the current status of the mysqldump or mysql job with the given id
+func (e *Engine) Job(_ context.Context, jobID int64) (cluster.JobStatus, error) {
+	return e.jobs.Job(jobID)
+}
+
+// WaitForJob polls the job with the given id every interval until it is finished or ctx is done
+func (e *Engine) WaitForJob(ctx context.Context, jobID int64, interval time.Duration, onProgress func(cluster.JobStatus)) (cluster.JobStatus, error) {
+	return cluster.WaitForJob(ctx, e, jobID, interval, onProgress)
+}
+
+// PauseJob is not supported for mysqldump and mysql
+func (e *Engine) PauseJob(_ context.Context, _ int64) error {
+	return cluster.ErrNotSupported
+}
+
+// ResumeJob is not supported for mysqldump and mysql
+func (e *Engine) ResumeJob(_ context.Context, _ int64) error {
+	return cluster.ErrNotSupported
+}
+
+// CancelJob stops the mysqldump or mysql process of the job with the given id
+func (e *Engine) CancelJob(_ context.Context, jobID int64) error {
+	return e.jobs.Cancel(jobID)
+}
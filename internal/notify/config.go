@@ -0,0 +1,218 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Webhook payload formats
+const (
+	FormatGeneric = "generic"
+	FormatSlack   = "slack"
+	FormatTeams   = "teams"
+)
+
+// SMTP connection security
+const (
+	SecurityNone     = "none"
+	SecurityStartTLS = "starttls"
+	SecurityTLS      = "tls"
+)
+
+// SMTP modes
+const (
+	ModeImmediate = "immediate"
+	ModeDigest    = "digest"
+	ModeBoth      = "both"
+)
+
+type Config struct {
+	// Webhooks receiving the events by name
+	Webhooks map[string]WebhookConfig
+	// SMTP sends the events by email when SMTP.Host is set
+	SMTP SMTPConfig
+}
+
+func (c Config) Assert() error {
+	for name, webhook := range c.Webhooks {
+		if err := webhook.Assert(); err != nil {
+			return fmt.Errorf("%w in Webhooks.%s Config", err, name)
+		}
+	}
+	if c.SMTP.Enabled() {
+		if err := c.SMTP.Assert(); err != nil {
+			return fmt.Errorf("%w in SMTP Config", err)
+		}
+	}
+	return nil
+}
+
+type WebhookConfig struct {
+	// URL receiving the events as JSON POST requests
+	URL string
+	// Format of the payload: generic (the event as JSON), slack or teams, defaults to generic
+	Format string
+	// Secret signs the payloads with HMAC-SHA256 in the X-Backupsmanager-Signature header when set
+	Secret string
+	// Events sent to the webhook, all events when empty
+	Events []string
+	// MaxRetries of a failed delivery with exponential backoff, defaults to 5, -1 disables retries
+	MaxRetries int
+	// TimeoutInSeconds of a delivery, defaults to 10
+	TimeoutInSeconds int
+}
+
+func (c WebhookConfig) Assert() error {
+	u, err := url.Parse(c.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("c.URL must be an absolute http or https URL")
+	}
+	switch c.Format {
+	case "", FormatGeneric, FormatSlack, FormatTeams:
+	default:
+		return fmt.Errorf("unknown c.Format %q", c.Format)
+	}
+	for _, event := range c.Events {
+		if !eventTypes[EventType(event)] {
+			return fmt.Errorf("unknown event %q in c.Events", event)
+		}
+	}
+	if c.MaxRetries < -1 {
+		return errors.New("c.MaxRetries must be -1 (no retries) or more")
+	}
+	if c.TimeoutInSeconds < 0 {
+		return errors.New("c.TimeoutInSeconds must not be negative")
+	}
+	return nil
+}
+
+// Retries returns the maximum number of retries of a failed delivery
+func (c WebhookConfig) Retries() int {
+	switch c.MaxRetries {
+	case 0:
+		return 5
+	case -1:
+		return 0
+	}
+	return c.MaxRetries
+}
+
+// EventTypes returns the events sent to the webhook, nil for all
+func (c WebhookConfig) EventTypes() []EventType {
+	var events []EventType
+	for _, event := range c.Events {
+		events = append(events, EventType(event))
+	}
+	return events
+}
+
+type SMTPConfig struct {
+	// Host of the SMTP server, email is disabled when empty
+	Host string
+	// Port of the SMTP server, defaults to 465 with tls, 587 with starttls and 25 without security
+	Port int
+	// Security of the connection: starttls, tls or none, defaults to starttls
+	Security string
+	// User and Password authenticate with PLAIN auth when set, which requires tls or starttls unless the server
+	// runs on localhost
+	User     string
+	Password string
+	// From is the sender address
+	From string
+	// To are the recipient addresses
+	To []string
+	// Events sent immediately, all events when empty
+	Events []string
+	// Mode is immediate (an email per event), digest (a daily summary of the backups per collection) or both,
+	// defaults to immediate
+	Mode string
+	// DigestAt is the UTC time of day the digest of the last 24 hours is sent, defaults to 08:00
+	DigestAt string
+	// TemplateFile overrides the "subject", "body", "digestSubject" and "digestBody" text templates
+	TemplateFile string
+	// TimeoutInSeconds of sending an email, defaults to 30
+	TimeoutInSeconds int
+}
+
+// Enabled returns true when email is configured
+func (c SMTPConfig) Enabled() bool {
+	return c.Host != ""
+}
+
+func (c SMTPConfig) Assert() error {
+	switch c.Security {
+	case "", SecurityStartTLS, SecurityTLS, SecurityNone:
+	default:
+		return fmt.Errorf("unknown c.Security %q", c.Security)
+	}
+	if c.Port < 0 || c.Port > 65535 {
+		return errors.New("c.Port must be a valid port")
+	}
+	if (c.User == "") != (c.Password == "") {
+		return errors.New("c.User and c.Password must be set together")
+	}
+	if c.From == "" {
+		return errors.New("c.From is required")
+	}
+	if len(c.To) == 0 {
+		return errors.New("c.To is required")
+	}
+	for _, event := range c.Events {
+		if !eventTypes[EventType(event)] {
+			return fmt.Errorf("unknown event %q in c.Events", event)
+		}
+	}
+	switch c.Mode {
+	case "", ModeImmediate, ModeDigest, ModeBoth:
+	default:
+		return fmt.Errorf("unknown c.Mode %q", c.Mode)
+	}
+	if c.DigestAt != "" {
+		if _, err := time.Parse("15:04", c.DigestAt); err != nil {
+			return errors.New("c.DigestAt must be a time of day like 08:00")
+		}
+	}
+	if c.TimeoutInSeconds < 0 {
+		return errors.New("c.TimeoutInSeconds must not be negative")
+	}
+	return nil
+}
+
+// EventTypes returns the events sent immediately, nil for all
+func (c SMTPConfig) EventTypes() []EventType {
+	var events []EventType
+	for _, event := range c.Events {
+		events = append(events, EventType(event))
+	}
+	return events
+}
+
+// Immediate returns true when an email is sent per event
+func (c SMTPConfig) Immediate() bool {
+	return c.Mode == "" || c.Mode == ModeImmediate || c.Mode == ModeBoth
+}
+
+// Digest returns true when the daily digest is sent
+func (c SMTPConfig) Digest() bool {
+	return c.Mode == ModeDigest || c.Mode == ModeBoth
+}
+
+// Addr returns host:port of the SMTP server
+func (c SMTPConfig) Addr() string {
+	port := c.Port
+	if port == 0 {
+		switch c.Security {
+		case SecurityTLS:
+			port = 465
+		case SecurityNone:
+			port = 25
+		default:
+			port = 587
+		}
+	}
+	return net.JoinHostPort(c.Host, strconv.Itoa(port))
+}
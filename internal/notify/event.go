@@ -0,0 +1,94 @@
+package notify
+
+import (
+	"fmt"
+	"time"
+)
+
+// EventType is the kind of outcome a notification reports
+type EventType string
+
+const (
+	EventBackupSucceeded    EventType = "backup.succeeded"
+	EventBackupFailed       EventType = "backup.failed"
+	EventRestoreCompleted   EventType = "restore.completed"
+	EventRetentionDeleted   EventType = "retention.deleted"
+	EventVerificationFailed EventType = "verification.failed"
+	EventBackupStale        EventType = "backup.stale"
+)
+
+var eventTypes = map[EventType]bool{
+	EventBackupSucceeded:    true,
+	EventBackupFailed:       true,
+	EventRestoreCompleted:   true,
+	EventRetentionDeleted:   true,
+	EventVerificationFailed: true,
+	EventBackupStale:        true,
+}
+
+// Event statuses
+const (
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// Event is the outcome of an operation on the backups of a collection
+type Event struct {
+	ID         string    `json:"id"`
+	Type       EventType `json:"type"`
+	Time       time.Time `json:"time"`
+	Status     string    `json:"status"`
+	Cluster    string    `json:"cluster"`
+	Collection string    `json:"collection"`
+	JobID      string    `json:"jobId,omitempty"`
+	// Backup is the backup directory inside the collection, e.g. /2022/01/24-163045.99
+	Backup string `json:"backup,omitempty"`
+	// Object is the name of the encrypted backup in the bucket
+	Object  string `json:"object,omitempty"`
+	Error   string `json:"error,omitempty"`
+	TraceID string `json:"traceId,omitempty"`
+}
+
+// Failed returns true when the event reports a failure
+func (e Event) Failed() bool {
+	return e.Status == StatusFailed
+}
+
+// Title returns a one line summary of the event
+func (e Event) Title() string {
+	collection := e.Cluster + "/" + e.Collection
+	switch e.Type {
+	case EventBackupSucceeded, EventBackupFailed:
+		return fmt.Sprintf("Backup of %s %s", collection, e.Status)
+	case EventRestoreCompleted:
+		return fmt.Sprintf("Restore of %s %s", collection, e.Status)
+	case EventRetentionDeleted:
+		return fmt.Sprintf("Backup of %s deleted by retention", collection)
+	case EventVerificationFailed:
+		return fmt.Sprintf("Verification of a backup of %s failed", collection)
+	case EventBackupStale:
+		return fmt.Sprintf("Backups of %s are stale", collection)
+	}
+	return fmt.Sprintf("%s of %s %s", e.Type, collection, e.Status)
+}
+
+// Facts returns the details of the event as ordered name and value pairs, skipping empty values
+func (e Event) Facts() [][2]string {
+	var facts [][2]string
+	for _, fact := range [][2]string{
+		{"Cluster", e.Cluster},
+		{"Collection", e.Collection},
+		{"Status", e.Status},
+		{"Job", e.JobID},
+		{"Backup", e.Backup},
+		{"Object", e.Object},
+		{"Error", e.Error},
+		{"Trace", e.TraceID},
+		{"Time", e.Time.Format(time.RFC3339)},
+	} {
+		if fact[1] != "" {
+			facts = append(facts, fact)
+		}
+	}
+	return facts
+}
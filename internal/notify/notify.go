@@ -0,0 +1,113 @@
+package notify
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/app"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// Notifier delivers events, usually queueing them so the caller is not delayed
+type Notifier interface {
+	Notify(event Event) error
+}
+
+type subscription struct {
+	name     string
+	events   map[EventType]bool
+	notifier Notifier
+}
+
+// Dispatcher passes the events to the notifiers subscribed to them
+type Dispatcher struct {
+	logger        *zap.Logger
+	mu            sync.RWMutex
+	subscriptions []subscription
+}
+
+func NewDispatcher(logger *zap.Logger) *Dispatcher {
+	return &Dispatcher{
+		logger: logger,
+	}
+}
+
+// NewDispatcherFromConfig returns a dispatcher with the notifiers configured in config. The notifiers deliver the
+// events in the background until ctx is done, the email digest summarizes the catalog.
+func NewDispatcherFromConfig(ctx context.Context, logger *zap.Logger, config Config, catalog *app.Catalog) (*Dispatcher, error) {
+	dispatcher := NewDispatcher(logger)
+	for name, webhookConfig := range config.Webhooks {
+		dispatcher.Add("webhook "+name, webhookConfig.EventTypes(), newWebhook(ctx, logger, name, webhookConfig))
+	}
+	if config.SMTP.Enabled() {
+		m, err := newMailer(logger, config.SMTP, catalog)
+		if err != nil {
+			return nil, err
+		}
+		if config.SMTP.Immediate() {
+			dispatcher.Add("smtp", config.SMTP.EventTypes(), newQueue(ctx, logger, "smtp", mailQueueSize, m.deliver))
+		}
+		if config.SMTP.Digest() {
+			go m.runDigest(ctx)
+		}
+	}
+	return dispatcher, nil
+}
+
+// Add subscribes notifier to events, to all events when empty
+func (d *Dispatcher) Add(name string, events []EventType, notifier Notifier) {
+	s := subscription{name: name, notifier: notifier}
+	if len(events) > 0 {
+		s.events = make(map[EventType]bool, len(events))
+		for _, event := range events {
+			s.events[event] = true
+		}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.subscriptions = append(d.subscriptions, s)
+}
+
+// Notify passes event to the subscribed notifiers, setting its ID and time when empty
+func (d *Dispatcher) Notify(event Event) {
+	if event.ID == "" {
+		event.ID = newEventID()
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, s := range d.subscriptions {
+		if s.events != nil && !s.events[event.Type] {
+			continue
+		}
+		if err := s.notifier.Notify(event); err != nil {
+			d.logger.Error("Notify: error notifying event", zap.String("notifier", s.name), zap.String("event", string(event.Type)), zap.String("id", event.ID), zap.Error(err))
+		}
+	}
+}
+
+func newEventID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Drain waits until the notifiers delivered the queued events or ctx is done, so short-lived processes don't lose
+// their notifications
+func (d *Dispatcher) Drain(ctx context.Context) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, s := range d.subscriptions {
+		if q, ok := s.notifier.(*queue); ok {
+			if err := q.drain(ctx); err != nil {
+				return fmt.Errorf("error draining %s: %w", s.name, err)
+			}
+		}
+	}
+	return nil
+}
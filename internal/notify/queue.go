@@ -0,0 +1,90 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// retryBackoff is the delay before the first retry of a delivery, doubling with every retry
+const retryBackoff = time.Second
+
+// queue delivers the events of a notifier in the background, so a slow receiver does not delay the jobs. Events are
+// dropped when the queue is full.
+type queue struct {
+	logger *zap.Logger
+	name   string
+	events chan Event
+	// pending are the queued events which are not delivered yet
+	pending sync.WaitGroup
+}
+
+func newQueue(ctx context.Context, logger *zap.Logger, name string, size int, deliver func(ctx context.Context, event Event) error) *queue {
+	q := &queue{
+		logger: logger,
+		name:   name,
+		events: make(chan Event, size),
+	}
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event := <-q.events:
+				if err := deliver(ctx, event); err != nil {
+					q.logger.Error("queue: error delivering event", zap.String("notifier", q.name), zap.String("event", string(event.Type)), zap.String("id", event.ID), zap.Error(err))
+				}
+				q.pending.Done()
+			}
+		}
+	}()
+	return q
+}
+
+// Notify queues event for delivery
+func (q *queue) Notify(event Event) error {
+	q.pending.Add(1)
+	select {
+	case q.events <- event:
+		return nil
+	default:
+		q.pending.Done()
+		return fmt.Errorf("queue of %s is full, event dropped", q.name)
+	}
+}
+
+// drain waits until the queued events are delivered or ctx is done
+func (q *queue) drain(ctx context.Context) error {
+	drained := make(chan struct{})
+	go func() {
+		q.pending.Wait()
+		close(drained)
+	}()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-drained:
+		return nil
+	}
+}
+
+// retry calls deliver until it succeeds, returns an error which can't be retried or maxRetries are done, with
+// exponential backoff
+func retry(ctx context.Context, logger *zap.Logger, name string, id string, maxRetries int, deliver func() (bool, error)) error {
+	backoff := retryBackoff
+	for attempt := 0; ; attempt++ {
+		retryable, err := deliver()
+		if err == nil || !retryable || attempt == maxRetries {
+			return err
+		}
+		logger.Warn("retry: retrying delivery", zap.String("notifier", name), zap.String("id", id), zap.Int("attempt", attempt+1), zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,314 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/app"
+	"go.uber.org/zap"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// mailQueueSize is the number of events buffered for email, events are dropped when the server can't keep up
+const mailQueueSize = 100
+
+// mailMaxRetries of sending an email which failed because of the connection
+const mailMaxRetries = 3
+
+// digestPeriod is the activity summarized by a digest
+const digestPeriod = 24 * time.Hour
+
+// defaultTemplates of the emails, the event is passed to subject and body, the Digest to digestSubject and digestBody
+const defaultTemplates = `
+{{define "subject"}}[backupsmanager] {{.Title}}{{end}}
+
+{{define "body"}}{{.Title}}.
+{{range .Facts}}
+{{index . 0}}: {{index . 1}}{{end}}
+{{end}}
+
+{{define "digestSubject"}}[backupsmanager] Backups of the last 24 hours: {{.Succeeded}} succeeded, {{.Failed}} failed{{end}}
+
+{{define "digestBody"}}Backups from {{.Since.Format "2006-01-02 15:04"}} to {{.Until.Format "2006-01-02 15:04"}} UTC.
+{{range .Collections}}
+{{.Cluster}}/{{.Collection}}: {{.Succeeded}} succeeded, {{.Failed}} failed
+  last success: {{if .LastSuccess.IsZero}}never{{else}}{{.LastSuccess.Format "2006-01-02 15:04"}} UTC{{end}}{{if .LastError}}
+  last error: {{.LastError}}{{end}}
+{{else}}
+No backups were made.
+{{end}}{{end}}
+`
+
+// Digest summarizes the backups per collection of a period
+type Digest struct {
+	Since       time.Time
+	Until       time.Time
+	Collections []DigestCollection
+}
+
+// DigestCollection is the backup activity of a collection in the period of a digest. LastSuccess also considers
+// the backups before the period, so collections without recent backups stand out.
+type DigestCollection struct {
+	Cluster     string
+	Collection  string
+	Succeeded   int
+	Failed      int
+	LastSuccess time.Time
+	LastError   string
+}
+
+// Succeeded returns the number of successful backups of all collections
+func (d Digest) Succeeded() int {
+	total := 0
+	for _, c := range d.Collections {
+		total += c.Succeeded
+	}
+	return total
+}
+
+// Failed returns the number of failed backups of all collections
+func (d Digest) Failed() int {
+	total := 0
+	for _, c := range d.Collections {
+		total += c.Failed
+	}
+	return total
+}
+
+// mailer sends the events and the daily digest by email
+type mailer struct {
+	logger    *zap.Logger
+	config    SMTPConfig
+	timeout   time.Duration
+	templates *template.Template
+	catalog   *app.Catalog
+}
+
+func newMailer(logger *zap.Logger, config SMTPConfig, catalog *app.Catalog) (*mailer, error) {
+	templates, err := template.New("email").Parse(defaultTemplates)
+	if err != nil {
+		return nil, err
+	}
+	if config.TemplateFile != "" {
+		if templates, err = templates.ParseFiles(config.TemplateFile); err != nil {
+			return nil, fmt.Errorf("error parsing email templates: %w", err)
+		}
+	}
+	timeout := time.Duration(config.TimeoutInSeconds) * time.Second
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	return &mailer{
+		logger:    logger,
+		config:    config,
+		timeout:   timeout,
+		templates: templates,
+		catalog:   catalog,
+	}, nil
+}
+
+// deliver sends an email for event
+func (m *mailer) deliver(ctx context.Context, event Event) error {
+	subject, body, err := m.render("subject", "body", event)
+	if err != nil {
+		return err
+	}
+	return retry(ctx, m.logger, "smtp", event.ID, mailMaxRetries, func() (bool, error) {
+		return m.send(ctx, subject, body)
+	})
+}
+
+// runDigest sends the digest at the configured time of day until ctx is done
+func (m *mailer) runDigest(ctx context.Context) {
+	at := 8 * time.Hour
+	if t, err := time.Parse("15:04", m.config.DigestAt); err == nil {
+		at = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+	for {
+		next := nextDigest(time.Now().UTC(), at)
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if err := m.sendDigest(ctx, next); err != nil {
+			m.logger.Error("runDigest: error sending digest", zap.Time("until", next), zap.Error(err))
+		}
+	}
+}
+
+// nextDigest returns the first time of day at after now
+func nextDigest(now time.Time, at time.Duration) time.Time {
+	next := now.Truncate(24 * time.Hour).Add(at)
+	if !next.After(now) {
+		next = next.Add(24 * time.Hour)
+	}
+	return next
+}
+
+// sendDigest sends the digest of the period before until
+func (m *mailer) sendDigest(ctx context.Context, until time.Time) error {
+	entries, err := m.catalog.Entries(func(entry app.CatalogEntry) bool {
+		return entry.Time.Before(until)
+	})
+	if err != nil {
+		return fmt.Errorf("error reading catalog: %w", err)
+	}
+	subject, body, err := m.render("digestSubject", "digestBody", digestOf(entries, until.Add(-digestPeriod), until))
+	if err != nil {
+		return err
+	}
+	return retry(ctx, m.logger, "smtp", "digest", mailMaxRetries, func() (bool, error) {
+		return m.send(ctx, subject, body)
+	})
+}
+
+// digestOf summarizes the catalog entries between since and until per collection, including the collections
+// without backups in the period
+func digestOf(entries []app.CatalogEntry, since time.Time, until time.Time) Digest {
+	collections := make(map[string]*DigestCollection)
+	for _, entry := range entries {
+		key := path.Join(entry.Cluster, entry.Collection)
+		c, ok := collections[key]
+		if !ok {
+			c = &DigestCollection{Cluster: entry.Cluster, Collection: entry.Collection}
+			collections[key] = c
+		}
+		if entry.Status == app.CatalogSucceeded && entry.Time.After(c.LastSuccess) {
+			c.LastSuccess = entry.Time
+		}
+		if entry.Time.Before(since) || !entry.Time.Before(until) {
+			continue
+		}
+		if entry.Status == app.CatalogSucceeded {
+			c.Succeeded++
+		} else {
+			c.Failed++
+			c.LastError = entry.Error
+		}
+	}
+
+	digest := Digest{Since: since, Until: until}
+	for _, c := range collections {
+		digest.Collections = append(digest.Collections, *c)
+	}
+	sort.Slice(digest.Collections, func(i, j int) bool {
+		a, b := digest.Collections[i], digest.Collections[j]
+		return a.Cluster < b.Cluster || (a.Cluster == b.Cluster && a.Collection < b.Collection)
+	})
+	return digest
+}
+
+// render executes the subject and body templates with data
+func (m *mailer) render(subjectTemplate string, bodyTemplate string, data interface{}) (string, string, error) {
+	var subject, body bytes.Buffer
+	if err := m.templates.ExecuteTemplate(&subject, subjectTemplate, data); err != nil {
+		return "", "", fmt.Errorf("error rendering %s template: %w", subjectTemplate, err)
+	}
+	if err := m.templates.ExecuteTemplate(&body, bodyTemplate, data); err != nil {
+		return "", "", fmt.Errorf("error rendering %s template: %w", bodyTemplate, err)
+	}
+	return subject.String(), body.String(), nil
+}
+
+// send sends an email to all recipients, returning whether a failure can be retried
+func (m *mailer) send(ctx context.Context, subject string, body string) (bool, error) {
+	msg, err := message(m.config.From, m.config.To, subject, body)
+	if err != nil {
+		return false, err
+	}
+	dialer := &net.Dialer{Timeout: m.timeout}
+	tlsConfig := &tls.Config{ServerName: m.config.Host, MinVersion: tls.VersionTLS12}
+	var conn net.Conn
+	if m.config.Security == SecurityTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", m.config.Addr(), tlsConfig)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", m.config.Addr())
+	}
+	if err != nil {
+		return true, err
+	}
+	_ = conn.SetDeadline(time.Now().Add(m.timeout))
+	client, err := smtp.NewClient(conn, m.config.Host)
+	if err != nil {
+		_ = conn.Close()
+		return true, err
+	}
+	defer client.Close()
+
+	if m.config.Security == "" || m.config.Security == SecurityStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return false, errors.New("SMTP server does not support STARTTLS")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return false, fmt.Errorf("error starting TLS: %w", err)
+		}
+	}
+	if m.config.User != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.config.User, m.config.Password, m.config.Host)); err != nil {
+			return false, fmt.Errorf("error authenticating: %w", err)
+		}
+	}
+	if err := client.Mail(m.config.From); err != nil {
+		return false, err
+	}
+	for _, to := range m.config.To {
+		if err := client.Rcpt(to); err != nil {
+			return false, fmt.Errorf("error adding recipient %s: %w", to, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return true, err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return true, err
+	}
+	if err := w.Close(); err != nil {
+		return true, err
+	}
+	return false, client.Quit()
+}
+
+// message returns the plain text email with quoted-printable body
+func message(from string, to []string, subject string, body string) ([]byte, error) {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	var msg bytes.Buffer
+	for _, header := range [][2]string{
+		{"From", from},
+		{"To", strings.Join(to, ", ")},
+		// templates may render line breaks, which would inject headers
+		{"Subject", mime.QEncoding.Encode("utf-8", strings.Join(strings.Fields(subject), " "))},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"Message-ID", "<" + hex.EncodeToString(id) + "@backupsmanager>"},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "text/plain; charset=utf-8"},
+		{"Content-Transfer-Encoding", "quoted-printable"},
+	} {
+		msg.WriteString(header[0] + ": " + header[1] + "\r\n")
+	}
+	msg.WriteString("\r\n")
+	w := quotedprintable.NewWriter(&msg)
+	if _, err := w.Write([]byte(body)); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return msg.Bytes(), nil
+}
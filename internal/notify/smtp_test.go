@@ -0,0 +1,293 @@
+package notify
+
+import (
+	"context"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/app"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpStub accepts the emails sent to a local listener without security, sending their content on messages
+func smtpStub(t *testing.T) (*net.TCPAddr, <-chan []byte) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	messages := make(chan []byte, 10)
+	go func() {
+		for {
+			c, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			serveSMTP(textproto.NewConn(c), messages)
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr), messages
+}
+
+func serveSMTP(conn *textproto.Conn, messages chan<- []byte) {
+	defer conn.Close()
+	_ = conn.PrintfLine("220 stub ESMTP")
+	for {
+		line, err := conn.ReadLine()
+		if err != nil {
+			return
+		}
+		switch command := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); command {
+		case "EHLO", "HELO":
+			_ = conn.PrintfLine("250 stub")
+		case "MAIL", "RCPT", "RSET", "NOOP":
+			_ = conn.PrintfLine("250 OK")
+		case "DATA":
+			_ = conn.PrintfLine("354 go ahead")
+			data, err := conn.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			messages <- data
+			_ = conn.PrintfLine("250 OK")
+		case "QUIT":
+			_ = conn.PrintfLine("221 bye")
+			return
+		default:
+			_ = conn.PrintfLine("502 unknown command %s", command)
+		}
+	}
+}
+
+// readMessage returns the headers, the raw body and the decoded body of an email, the decoded one with LF line
+// breaks
+func readMessage(t *testing.T, messages <-chan []byte) (mail.Header, string, string) {
+	var data []byte
+	select {
+	case data = <-messages:
+	case <-time.After(10 * time.Second):
+		t.Fatal("no email received")
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encoding := msg.Header.Get("Content-Transfer-Encoding"); encoding != "quoted-printable" {
+		t.Fatalf("Content-Transfer-Encoding is %q", encoding)
+	}
+	raw, err := ioutil.ReadAll(msg.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(quotedprintable.NewReader(strings.NewReader(string(raw))))
+	if err != nil {
+		t.Fatalf("body is not quoted-printable: %v", err)
+	}
+	return msg.Header, string(raw), strings.ReplaceAll(string(body), "\r\n", "\n")
+}
+
+func testMailer(t *testing.T, catalog *app.Catalog) (*mailer, <-chan []byte) {
+	addr, messages := smtpStub(t)
+	m, err := newMailer(zap.NewNop(), SMTPConfig{
+		Host:     addr.IP.String(),
+		Port:     addr.Port,
+		Security: SecurityNone,
+		From:     "backups@example.com",
+		To:       []string{"ops@example.com", "dba@example.com"},
+	}, catalog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, messages
+}
+
+func TestMailerDeliver(t *testing.T) {
+	m, messages := testMailer(t, nil)
+	event := Event{
+		ID:         "1",
+		Type:       EventBackupFailed,
+		Time:       time.Date(2022, 1, 24, 16, 30, 45, 0, time.UTC),
+		Status:     StatusFailed,
+		Cluster:    "prod",
+		Collection: "payments",
+		JobID:      "42",
+		// non-ASCII, = and a line longer than 76 characters have to be encoded
+		Error: "naïve = " + strings.Repeat("x", 80),
+	}
+	if err := m.deliver(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+
+	header, raw, body := readMessage(t, messages)
+	for name, want := range map[string]string{
+		"From":         "backups@example.com",
+		"To":           "ops@example.com, dba@example.com",
+		"MIME-Version": "1.0",
+		"Content-Type": "text/plain; charset=utf-8",
+	} {
+		if got := header.Get(name); got != want {
+			t.Errorf("%s is %q, want %q", name, got, want)
+		}
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(header.Get("Subject"))
+	if err != nil || subject != "[backupsmanager] Backup of prod/payments failed" {
+		t.Errorf("Subject is %q (%v)", subject, err)
+	}
+	if _, err := mail.ParseDate(header.Get("Date")); err != nil {
+		t.Errorf("Date is %q: %v", header.Get("Date"), err)
+	}
+	if id := header.Get("Message-ID"); !strings.HasSuffix(id, "@backupsmanager>") {
+		t.Errorf("Message-ID is %q", id)
+	}
+
+	if !strings.Contains(raw, "Error: na=C3=AFve =3D xxx") {
+		t.Errorf("body is not encoded:\n%s", raw)
+	}
+	for _, line := range strings.Split(raw, "\n") {
+		if len(line) > 76 {
+			t.Errorf("encoded line is longer than 76 characters: %s", line)
+		}
+	}
+
+	want := "Backup of prod/payments failed.\n\n" +
+		"Cluster: prod\n" +
+		"Collection: payments\n" +
+		"Status: failed\n" +
+		"Job: 42\n" +
+		"Error: " + event.Error + "\n" +
+		"Time: 2022-01-24T16:30:45Z\n"
+	if body != want {
+		t.Errorf("body is\n%s\nwant\n%s", body, want)
+	}
+}
+
+func TestMailerSendDigest(t *testing.T) {
+	catalog := app.NewCatalog(zap.NewNop(), filepath.Join(t.TempDir(), "catalog.jsonl"))
+	until := time.Date(2022, 1, 25, 8, 0, 0, 0, time.UTC)
+	for _, entry := range []app.CatalogEntry{
+		{Time: until.Add(-48 * time.Hour), Cluster: "prod", Collection: "ledger", Status: app.CatalogSucceeded},
+		{Time: until.Add(-3 * time.Hour), Cluster: "prod", Collection: "payments", Status: app.CatalogSucceeded},
+		{Time: until.Add(-2 * time.Hour), Cluster: "prod", Collection: "payments", Status: app.CatalogFailed, Error: "disk full"},
+		{Time: until.Add(-time.Hour), Cluster: "dev", Collection: "payments", Status: app.CatalogSucceeded},
+		// after the period, not in the digest
+		{Time: until.Add(time.Hour), Cluster: "prod", Collection: "payments", Status: app.CatalogFailed, Error: "late"},
+	} {
+		if err := catalog.Add(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, messages := testMailer(t, catalog)
+	if err := m.sendDigest(context.Background(), until); err != nil {
+		t.Fatal(err)
+	}
+
+	header, _, body := readMessage(t, messages)
+	subject, err := new(mime.WordDecoder).DecodeHeader(header.Get("Subject"))
+	if err != nil || subject != "[backupsmanager] Backups of the last 24 hours: 2 succeeded, 1 failed" {
+		t.Errorf("Subject is %q (%v)", subject, err)
+	}
+	want := "Backups from 2022-01-24 08:00 to 2022-01-25 08:00 UTC.\n" +
+		"\ndev/payments: 1 succeeded, 0 failed\n" +
+		"  last success: 2022-01-25 07:00 UTC\n" +
+		"\nprod/ledger: 0 succeeded, 0 failed\n" +
+		"  last success: 2022-01-23 08:00 UTC\n" +
+		"\nprod/payments: 1 succeeded, 1 failed\n" +
+		"  last success: 2022-01-25 05:00 UTC\n" +
+		"  last error: disk full\n"
+	if body != want {
+		t.Errorf("body is\n%s\nwant\n%s", body, want)
+	}
+}
+
+func TestDigestOf(t *testing.T) {
+	since := time.Date(2022, 1, 24, 8, 0, 0, 0, time.UTC)
+	until := since.Add(digestPeriod)
+	entry := func(at time.Time, collection string, status string, err string) app.CatalogEntry {
+		return app.CatalogEntry{Time: at, Cluster: "prod", Collection: collection, Status: status, Error: err}
+	}
+	tests := []struct {
+		name    string
+		entries []app.CatalogEntry
+		want    []DigestCollection
+	}{
+		{name: "no entries"},
+		{
+			name:    "success before the period",
+			entries: []app.CatalogEntry{entry(since.Add(-time.Second), "a", app.CatalogSucceeded, "")},
+			want:    []DigestCollection{{Cluster: "prod", Collection: "a", LastSuccess: since.Add(-time.Second)}},
+		},
+		{
+			name: "bounds of the period",
+			entries: []app.CatalogEntry{
+				entry(since, "a", app.CatalogSucceeded, ""),
+				entry(until, "a", app.CatalogFailed, "at until"),
+			},
+			want: []DigestCollection{{Cluster: "prod", Collection: "a", Succeeded: 1, LastSuccess: since}},
+		},
+		{
+			name: "last error and last success",
+			entries: []app.CatalogEntry{
+				entry(since.Add(2*time.Hour), "a", app.CatalogSucceeded, ""),
+				entry(since.Add(time.Hour), "a", app.CatalogSucceeded, ""),
+				entry(since.Add(3*time.Hour), "a", app.CatalogFailed, "first"),
+				entry(since.Add(4*time.Hour), "a", app.CatalogFailed, "second"),
+			},
+			want: []DigestCollection{{Cluster: "prod", Collection: "a", Succeeded: 2, Failed: 2, LastSuccess: since.Add(2 * time.Hour), LastError: "second"}},
+		},
+		{
+			name: "sorted by cluster and collection",
+			entries: []app.CatalogEntry{
+				entry(since, "b", app.CatalogSucceeded, ""),
+				{Time: since, Cluster: "dev", Collection: "c", Status: app.CatalogFailed, Error: "x"},
+				entry(since, "a", app.CatalogFailed, "y"),
+			},
+			want: []DigestCollection{
+				{Cluster: "dev", Collection: "c", Failed: 1, LastError: "x"},
+				{Cluster: "prod", Collection: "a", Failed: 1, LastError: "y"},
+				{Cluster: "prod", Collection: "b", Succeeded: 1, LastSuccess: since},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := digestOf(tt.entries, since, until)
+			if !got.Since.Equal(since) || !got.Until.Equal(until) {
+				t.Errorf("period is %s to %s", got.Since, got.Until)
+			}
+			if !reflect.DeepEqual(got.Collections, tt.want) {
+				t.Errorf("collections are %+v, want %+v", got.Collections, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextDigest(t *testing.T) {
+	day := time.Date(2022, 1, 24, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		now  time.Time
+		at   time.Duration
+		want time.Time
+	}{
+		{now: day.Add(7 * time.Hour), at: 8 * time.Hour, want: day.Add(8 * time.Hour)},
+		{now: day.Add(8 * time.Hour), at: 8 * time.Hour, want: day.Add(32 * time.Hour)},
+		{now: day.Add(9 * time.Hour), at: 8 * time.Hour, want: day.Add(32 * time.Hour)},
+		{now: day, at: 0, want: day.Add(24 * time.Hour)},
+		{now: day.Add(23*time.Hour + 59*time.Minute), at: 23*time.Hour + 30*time.Minute, want: day.Add(47*time.Hour + 30*time.Minute)},
+	}
+	for i, tt := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			if got := nextDigest(tt.now, tt.at); !got.Equal(tt.want) {
+				t.Errorf("nextDigest(%s, %s) = %s, want %s", tt.now, tt.at, got, tt.want)
+			}
+		})
+	}
+}
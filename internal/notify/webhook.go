@@ -0,0 +1,161 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// webhookQueueSize is the number of events buffered per webhook, events are dropped when a webhook can't keep up
+const webhookQueueSize = 100
+
+// Headers of the webhook requests, the signature is the hex encoded HMAC-SHA256 of "{timestamp}.{body}"
+const (
+	HeaderEvent     = "X-Backupsmanager-Event"
+	HeaderTimestamp = "X-Backupsmanager-Timestamp"
+	HeaderSignature = "X-Backupsmanager-Signature"
+)
+
+// webhook posts the events to an URL, retrying failed deliveries
+type webhook struct {
+	logger     *zap.Logger
+	name       string
+	config     WebhookConfig
+	client     *http.Client
+	maxRetries int
+}
+
+// newWebhook returns the notifier of the webhook, delivering the events in the background until ctx is done
+func newWebhook(ctx context.Context, logger *zap.Logger, name string, config WebhookConfig) Notifier {
+	timeout := time.Duration(config.TimeoutInSeconds) * time.Second
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	w := &webhook{
+		logger:     logger,
+		name:       name,
+		config:     config,
+		client:     &http.Client{Timeout: timeout},
+		maxRetries: config.Retries(),
+	}
+	return newQueue(ctx, logger, "webhook "+name, webhookQueueSize, w.deliver)
+}
+
+// deliver posts the payload of event, retrying with exponential backoff on network errors, 429 and 5xx responses
+func (w *webhook) deliver(ctx context.Context, event Event) error {
+	payload, err := json.Marshal(w.payload(event))
+	if err != nil {
+		return err
+	}
+	return retry(ctx, w.logger, "webhook "+w.name, event.ID, w.maxRetries, func() (bool, error) {
+		return w.post(ctx, event, payload)
+	})
+}
+
+// post sends payload once, returning whether a failed delivery can be retried
+func (w *webhook) post(ctx context.Context, event Event, payload []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.config.URL, bytes.NewReader(payload))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, string(event.Type))
+	if w.config.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(HeaderTimestamp, timestamp)
+		req.Header.Set(HeaderSignature, "sha256="+Sign(w.config.Secret, timestamp, payload))
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return retry, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return false, nil
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of "{timestamp}.{payload}" with secret, receivers compute it to verify
+// the X-Backupsmanager-Signature header
+func Sign(secret string, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// payload returns the body of event in the format of the webhook
+func (w *webhook) payload(event Event) interface{} {
+	switch w.config.Format {
+	case FormatSlack:
+		return slackPayload(event)
+	case FormatTeams:
+		return teamsPayload(event)
+	}
+	return event
+}
+
+// colors of the Slack attachments and Teams cards
+const (
+	colorSucceeded = "2eb886"
+	colorFailed    = "a30200"
+)
+
+func eventColor(event Event) string {
+	if event.Failed() {
+		return colorFailed
+	}
+	return colorSucceeded
+}
+
+// slackPayload is a message for Slack incoming webhooks
+func slackPayload(event Event) interface{} {
+	type field struct {
+		Title string `json:"title"`
+		Value string `json:"value"`
+		Short bool   `json:"short"`
+	}
+	var fields []field
+	for _, fact := range event.Facts() {
+		fields = append(fields, field{Title: fact[0], Value: fact[1], Short: fact[0] != "Error"})
+	}
+	return map[string]interface{}{
+		"text": event.Title(),
+		"attachments": []map[string]interface{}{{
+			"color":  "#" + eventColor(event),
+			"fields": fields,
+		}},
+	}
+}
+
+// teamsPayload is a message card for Microsoft Teams incoming webhooks
+func teamsPayload(event Event) interface{} {
+	type fact struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+	var facts []fact
+	for _, f := range event.Facts() {
+		facts = append(facts, fact{Name: f[0], Value: f[1]})
+	}
+	return map[string]interface{}{
+		"@type":      "MessageCard",
+		"@context":   "https://schema.org/extensions",
+		"themeColor": eventColor(event),
+		"summary":    event.Title(),
+		"title":      event.Title(),
+		"sections": []map[string]interface{}{{
+			"facts": facts,
+		}},
+	}
+}
@@ -0,0 +1,51 @@
+package notify
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWebhookConfigRetries(t *testing.T) {
+	tests := []struct {
+		maxRetries int
+		want       int
+		valid      bool
+	}{
+		{maxRetries: 0, want: 5, valid: true},
+		{maxRetries: -1, want: 0, valid: true},
+		{maxRetries: 1, want: 1, valid: true},
+		{maxRetries: 8, want: 8, valid: true},
+		{maxRetries: -2, valid: false},
+	}
+	for _, tt := range tests {
+		config := WebhookConfig{URL: "https://hooks.example.com/backups", MaxRetries: tt.maxRetries}
+		if err := config.Assert(); (err == nil) != tt.valid {
+			t.Errorf("Assert of MaxRetries %d returned %v", tt.maxRetries, err)
+		}
+		if tt.valid && config.Retries() != tt.want {
+			t.Errorf("Retries of MaxRetries %d is %d, want %d", tt.maxRetries, config.Retries(), tt.want)
+		}
+	}
+}
+
+func TestWebhookDeliverWithoutRetries(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	config := WebhookConfig{URL: server.URL, MaxRetries: -1}
+	w := &webhook{logger: zap.NewNop(), name: "test", config: config, client: server.Client(), maxRetries: config.Retries()}
+	if err := w.deliver(context.Background(), Event{ID: "1", Type: EventBackupFailed, Status: StatusFailed}); err == nil {
+		t.Fatal("delivery to an unavailable webhook succeeded")
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("webhook received %d requests, want 1", got)
+	}
+}
@@ -0,0 +1,280 @@
+package postgres
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/cluster"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/pkg/database"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dumpExtension is the extension of the pg_dump custom format files
+const dumpExtension = ".dump"
+
+// maxStderrSize limits the output of the client tools kept for error messages
+const maxStderrSize = 4096
+
+var _ cluster.Engine = (*Engine)(nil)
+
+// Engine backs up a PostgreSQL database with pg_dump and restores it with pg_restore
+type Engine struct {
+	logger      *zap.Logger
+	db          *sql.DB
+	config      database.Config
+	backupsPath string
+	jobs        *cluster.LocalJobs
+}
+
+// NewEngine returns the engine of a PostgreSQL cluster writing its collections into backupsPath
+func NewEngine(ctx context.Context, logger *zap.Logger, db *sql.DB, config database.Config, backupsPath string) *Engine {
+	return &Engine{
+		logger:      logger,
+		db:          db,
+		config:      config,
+		backupsPath: backupsPath,
+		jobs:        cluster.NewLocalJobs(ctx),
+	}
+}
+
+// BackupOptions holds the user-selectable options of pg_dump
+type BackupOptions struct {
+	// Schemas to dump, all by default
+	Schemas []string `json:"schemas"`
+	// Tables to dump, all by default
+	Tables []string `json:"tables"`
+	// ExcludeTables are not dumped
+	ExcludeTables []string `json:"exclude_tables"`
+	// Compression level 0-9, pg_dump's default when not set
+	Compression *int `json:"compression"`
+}
+
+func (o BackupOptions) Assert() error {
+	if err := assertNames(o.Schemas, o.Tables, o.ExcludeTables); err != nil {
+		return err
+	}
+	if o.Compression != nil && (*o.Compression < 0 || *o.Compression > 9) {
+		return errors.New("compression must be between 0 and 9")
+	}
+	return nil
+}
+
+// RestoreOptions holds the user-selectable options of pg_restore
+type RestoreOptions struct {
+	// Database to restore into, defaults to the configured database
+	Database string `json:"database"`
+	// Clean drops the database objects before recreating them
+	Clean bool `json:"clean"`
+	// NoOwner skips restoring the ownership of the objects
+	NoOwner bool `json:"no_owner"`
+	// Schemas to restore, all by default
+	Schemas []string `json:"schemas"`
+	// Tables to restore, all by default
+	Tables []string `json:"tables"`
+}
+
+func (o RestoreOptions) Assert() error {
+	if o.Database != "" {
+		if err := assertNames([]string{o.Database}); err != nil {
+			return err
+		}
+	}
+	return assertNames(o.Schemas, o.Tables)
+}
+
+// assertNames validates names which are passed as separate arguments, so they are never interpreted by a shell
+func assertNames(lists ...[]string) error {
+	for _, names := range lists {
+		for _, name := range names {
+			if name == "" || len(name) > 255 || strings.ContainsRune(name, 0) {
+				return fmt.Errorf("name %q is invalid", name)
+			}
+		}
+	}
+	return nil
+}
+
+// Name returns the engine name of PostgreSQL clusters
+func (e *Engine) Name() string {
+	return cluster.EnginePostgres
+}
+
+// Ping checks the connection with the database
+func (e *Engine) Ping(ctx context.Context) error {
+	if err := e.db.PingContext(ctx); err != nil {
+		return &database.Error{Err: err}
+	}
+	return nil
+}
+
+// StartBackup runs pg_dump in the background into a new backup of collection, with the JSON encoded BackupOptions
+func (e *Engine) StartBackup(collection string, options []byte) (cluster.JobRef, error) {
+	var backupOptions BackupOptions
+	if err := cluster.DecodeOptions(options, &backupOptions); err != nil {
+		return cluster.JobRef{}, err
+	}
+	if err := backupOptions.Assert(); err != nil {
+		return cluster.JobRef{}, &cluster.OptionsError{Err: err}
+	}
+
+	collectionDir := path.Join(e.backupsPath, collection)
+	subdir := cluster.BackupDirName(time.Now())
+	dataDir := path.Join(collectionDir, subdir, "data")
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		e.logger.Error("StartBackup: error creating backup directory", zap.String("directory", dataDir), zap.Error(err))
+		return cluster.JobRef{}, err
+	}
+
+	args := []string{
+		"--format=custom",
+		"--no-password",
+		"--file=" + path.Join(dataDir, e.config.Database+dumpExtension),
+	}
+	if backupOptions.Compression != nil {
+		args = append(args, "--compress="+strconv.Itoa(*backupOptions.Compression))
+	}
+	for _, schema := range backupOptions.Schemas {
+		args = append(args, "--schema="+schema)
+	}
+	for _, table := range backupOptions.Tables {
+		args = append(args, "--table="+table)
+	}
+	for _, table := range backupOptions.ExcludeTables {
+		args = append(args, "--exclude-table="+table)
+	}
+	args = append(args, "--dbname="+e.config.URL(false).String())
+
+	jobID := e.jobs.Start(func(ctx context.Context) error {
+		if err := e.run(ctx, "pg_dump", args); err != nil {
+			_ = os.RemoveAll(path.Join(collectionDir, subdir))
+			return err
+		}
+		// LATEST points to the last successful backup, as CRDB does for its collections
+		return ioutil.WriteFile(path.Join(collectionDir, "LATEST"), []byte(subdir), 0600)
+	})
+	e.logger.Info("StartBackup: pg_dump started", zap.String("collection", collection), zap.String("subdir", subdir), zap.Int64("jobID", jobID))
+	return cluster.JobRef{ID: jobID, Detached: true}, nil
+}
+
+// StartRestore runs pg_restore in the background for the backup subdir of collection, with the JSON encoded
+// RestoreOptions. An empty subdir restores the LATEST backup.
+func (e *Engine) StartRestore(collection string, subdir string, options []byte) (cluster.JobRef, error) {
+	var restoreOptions RestoreOptions
+	if err := cluster.DecodeOptions(options, &restoreOptions); err != nil {
+		return cluster.JobRef{}, err
+	}
+	if err := restoreOptions.Assert(); err != nil {
+		return cluster.JobRef{}, &cluster.OptionsError{Err: err}
+	}
+
+	dumpFile, err := e.dumpFile(collection, subdir)
+	if err != nil {
+		return cluster.JobRef{}, err
+	}
+
+	target := e.config
+	if restoreOptions.Database != "" {
+		target.Database = restoreOptions.Database
+	}
+	args := []string{
+		"--no-password",
+		"--exit-on-error",
+		"--dbname=" + target.URL(false).String(),
+	}
+	if restoreOptions.Clean {
+		args = append(args, "--clean", "--if-exists")
+	}
+	if restoreOptions.NoOwner {
+		args = append(args, "--no-owner")
+	}
+	for _, schema := range restoreOptions.Schemas {
+		args = append(args, "--schema="+schema)
+	}
+	for _, table := range restoreOptions.Tables {
+		args = append(args, "--table="+table)
+	}
+	args = append(args, dumpFile)
+
+	jobID := e.jobs.Start(func(ctx context.Context) error {
+		return e.run(ctx, "pg_restore", args)
+	})
+	e.logger.Info("StartRestore: pg_restore started", zap.String("dumpFile", dumpFile), zap.Int64("jobID", jobID))
+	return cluster.JobRef{ID: jobID, Detached: true}, nil
+}
+
+// dumpFile returns the pg_dump file of the backup subdir of collection, or of the LATEST backup
+func (e *Engine) dumpFile(collection string, subdir string) (string, error) {
+	collectionDir := path.Join(e.backupsPath, collection)
+	if subdir == "" {
+		latest, err := ioutil.ReadFile(path.Join(collectionDir, "LATEST"))
+		if err != nil {
+			return "", fmt.Errorf("error reading LATEST backup: %w", err)
+		}
+		subdir = strings.TrimSpace(string(latest))
+	}
+	if !cluster.ValidBackupDirName(subdir) {
+		return "", &cluster.OptionsError{Err: fmt.Errorf("invalid backup %q", subdir)}
+	}
+
+	matches, err := filepath.Glob(path.Join(collectionDir, subdir, "data", "*"+dumpExtension))
+	if err != nil {
+		return "", err
+	}
+	if len(matches) == 0 {
+		return "", fmt.Errorf("no dump found in backup %s", subdir)
+	}
+	return matches[0], nil
+}
+
+// run runs a client tool with the password in its environment, so it does not show up in the process list
+func (e *Engine) run(ctx context.Context, tool string, args []string) error {
+	cmd := exec.CommandContext(ctx, cluster.ToolPath(e.config.ToolsDir, tool), args...)
+	cmd.Env = append(os.Environ(), "PGPASSWORD="+e.config.Password)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if len(message) > maxStderrSize {
+			message = message[:maxStderrSize]
+		}
+		e.logger.Error("run: client tool failed", zap.String("tool", tool), zap.String("stderr", message), zap.Error(err))
+		return fmt.Errorf("%s failed: %v: %s", tool, err, message)
+	}
+	return nil
+}
+
+// Job returns the current status of the pg_dump or pg_restore job with the given id
+func (e *Engine) Job(_ context.Context, jobID int64) (cluster.JobStatus, error) {
+	return e.jobs.Job(jobID)
+}
+
+// WaitForJob polls the job with the given id every interval until it is finished or ctx is done
+func (e *Engine) WaitForJob(ctx context.Context, jobID int64, interval time.Duration, onProgress func(cluster.JobStatus)) (cluster.JobStatus, error) {
+	return cluster.WaitForJob(ctx, e, jobID, interval, onProgress)
+}
+
+// PauseJob is not supported for pg_dump and pg_restore
+func (e *Engine) PauseJob(_ context.Context, _ int64) error {
+	return cluster.ErrNotSupported
+}
+
+// ResumeJob is not supported for pg_dump and pg_restore
+func (e *Engine) ResumeJob(_ context.Context, _ int64) error {
+	return cluster.ErrNotSupported
+}
+
+// CancelJob stops the pg_dump or pg_restore process of the job with the given id
+func (e *Engine) CancelJob(_ context.Context, jobID int64) error {
+	return e.jobs.Cancel(jobID)
+}
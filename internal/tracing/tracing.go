@@ -0,0 +1,166 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"net"
+	"net/http"
+)
+
+// instrumentationName identifies the spans of this service
+const instrumentationName = "gitlab.cmpayments.local/payments-gateway/backupsmanager"
+
+type Config struct {
+	// OTLPEndpoint host:port of the OTLP/HTTP collector receiving the spans, tracing is a no-op when empty
+	OTLPEndpoint string
+	// OTLPInsecure sends the spans over plain HTTP
+	OTLPInsecure bool
+	// SampleRatio of the traces started by this service between 0 and 1, defaults to 1. Traces started by the
+	// callers follow their sampling decision.
+	SampleRatio float64
+}
+
+func (c Config) Assert() error {
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		return errors.New("c.SampleRatio must be between 0 and 1")
+	}
+	return nil
+}
+
+// Setup installs the global tracer provider and the W3C trace context propagator. The returned function flushes
+// and stops the exporter.
+func Setup(ctx context.Context, logger *zap.Logger, config Config) (func(ctx context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if config.OTLPEndpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(config.OTLPEndpoint)}
+	if config.OTLPInsecure {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+	ratio := config.SampleRatio
+	if ratio == 0 {
+		ratio = 1
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String("backupsmanager"))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		logger.Warn("Setup: tracing error", zap.Error(err))
+	}))
+	logger.Info("Setup: exporting traces", zap.String("endpoint", config.OTLPEndpoint))
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer of this service
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// LogFields returns the trace and span IDs of the span in ctx as zap fields, none when ctx has no span
+func LogFields(ctx context.Context) []zap.Field {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return nil
+	}
+	return []zap.Field{
+		zap.String("traceID", spanContext.TraceID().String()),
+		zap.String("spanID", spanContext.SpanID().String()),
+	}
+}
+
+// Detach returns a context for work which outlives the request in parent, e.g. a backup job, keeping the span of
+// parent but the cancellation of ctx
+func Detach(ctx context.Context, parent context.Context) context.Context {
+	return trace.ContextWithSpanContext(ctx, trace.SpanContextFromContext(parent))
+}
+
+// End ends span, recording err when set
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// statusRecorder keeps the status code of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(statusCode int) {
+	if s.status == 0 {
+		s.status = statusCode
+	}
+	s.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Flush supports streamed responses
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Middleware starts a server span per request, continuing the trace of the caller, and returns its trace ID in
+// the X-Trace-Id header
+func Middleware(next http.Handler) http.Handler {
+	tracer := Tracer()
+	propagator := otel.GetTextMapPropagator()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		remoteAddr, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			remoteAddr = r.RemoteAddr
+		}
+		ctx, span := tracer.Start(ctx, "HTTP "+r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPMethodKey.String(r.Method),
+				semconv.HTTPTargetKey.String(r.URL.Path),
+				semconv.NetPeerIPKey.String(remoteAddr),
+			))
+		defer span.End()
+		if span.SpanContext().IsValid() {
+			w.Header().Set("X-Trace-Id", span.SpanContext().TraceID().String())
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
+
+// Attributes of the spans of jobs
+var (
+	ClusterKey    = attribute.Key("backupsmanager.cluster")
+	CollectionKey = attribute.Key("backupsmanager.collection")
+	JobKey        = attribute.Key("backupsmanager.job")
+)
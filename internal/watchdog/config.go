@@ -0,0 +1,91 @@
+package watchdog
+
+import (
+	"errors"
+	"fmt"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/cluster"
+	"time"
+)
+
+type Config struct {
+	// IntervalInMinutes between the checks of the SLOs, defaults to 5
+	IntervalInMinutes int
+	// SLOs are the freshness objectives of the collections by name
+	SLOs map[string]SLO
+}
+
+func (c Config) Assert() error {
+	if c.IntervalInMinutes < 0 {
+		return errors.New("c.IntervalInMinutes must not be negative")
+	}
+	for name, slo := range c.SLOs {
+		if err := slo.Assert(name); err != nil {
+			return fmt.Errorf("%w in SLOs.%s Config", err, name)
+		}
+	}
+	return nil
+}
+
+// Interval returns the time between the checks of the SLOs
+func (c Config) Interval() time.Duration {
+	if c.IntervalInMinutes == 0 {
+		return 5 * time.Minute
+	}
+	return time.Duration(c.IntervalInMinutes) * time.Minute
+}
+
+// Offsite reports whether any SLO requires offsite copies
+func (c Config) Offsite() bool {
+	for _, slo := range c.SLOs {
+		if slo.Offsite {
+			return true
+		}
+	}
+	return false
+}
+
+// SLO requires a collection to have a successful backup at least every MaxAgeInHours
+type SLO struct {
+	// Cluster of the collection, defaults to the default cluster
+	Cluster string
+	// Collection defaults to the name of the SLO
+	Collection string
+	// MaxAgeInHours of the last successful backup
+	MaxAgeInHours int
+	// Offsite also requires the last backup uploaded to the bucket to be at most MaxAgeInHours old
+	Offsite bool
+}
+
+func (s SLO) Assert(name string) error {
+	if !cluster.ValidName(s.ClusterName()) {
+		return fmt.Errorf("invalid cluster name %q", s.ClusterName())
+	}
+	if !cluster.ValidName(s.CollectionName(name)) {
+		return fmt.Errorf("invalid collection name %q", s.CollectionName(name))
+	}
+	if s.MaxAgeInHours <= 0 {
+		return errors.New("s.MaxAgeInHours must be positive")
+	}
+	return nil
+}
+
+// ClusterName returns the cluster of the collection
+func (s SLO) ClusterName() string {
+	if s.Cluster == "" {
+		return cluster.DefaultName
+	}
+	return s.Cluster
+}
+
+// CollectionName returns the collection of the SLO with the given name
+func (s SLO) CollectionName(name string) string {
+	if s.Collection == "" {
+		return name
+	}
+	return s.Collection
+}
+
+// MaxAge returns the maximum age of the last successful backup
+func (s SLO) MaxAge() time.Duration {
+	return time.Duration(s.MaxAgeInHours) * time.Hour
+}
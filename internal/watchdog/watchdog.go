@@ -0,0 +1,180 @@
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/app"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/metrics"
+	"gitlab.cmpayments.local/payments-gateway/backupsmanager/internal/notify"
+	"go.uber.org/zap"
+	"path"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Status is the outcome of the last check of an SLO
+type Status struct {
+	Name          string     `json:"name"`
+	Cluster       string     `json:"cluster"`
+	Collection    string     `json:"collection"`
+	MaxAgeInHours int        `json:"maxAgeInHours"`
+	Offsite       bool       `json:"offsite"`
+	LastBackup    *time.Time `json:"lastBackup,omitempty"`
+	LastOffsite   *time.Time `json:"lastOffsite,omitempty"`
+	Violated      bool       `json:"violated"`
+	Reason        string     `json:"reason,omitempty"`
+	CheckedAt     time.Time  `json:"checkedAt"`
+}
+
+// Watchdog checks the freshness SLOs of the collections against the catalog, so backups which are not triggered
+// anymore are noticed. Violations are exposed in the metrics and notified when they start, and again every
+// max age while they last.
+type Watchdog struct {
+	logger   *zap.Logger
+	config   Config
+	catalog  *app.Catalog
+	metrics  *metrics.Metrics
+	notifier *notify.Dispatcher
+	started  time.Time
+	mu       sync.RWMutex
+	statuses map[string]Status
+	notified map[string]time.Time
+}
+
+func NewWatchdog(logger *zap.Logger, config Config, catalog *app.Catalog, metrics *metrics.Metrics, notifier *notify.Dispatcher) *Watchdog {
+	return &Watchdog{
+		logger:   logger,
+		config:   config,
+		catalog:  catalog,
+		metrics:  metrics,
+		notifier: notifier,
+		started:  time.Now().UTC(),
+		statuses: make(map[string]Status),
+		notified: make(map[string]time.Time),
+	}
+}
+
+// Run checks the SLOs right away and then every interval until ctx is done
+func (w *Watchdog) Run(ctx context.Context) {
+	if len(w.config.SLOs) == 0 {
+		return
+	}
+	ticker := time.NewTicker(w.config.Interval())
+	go func() {
+		defer ticker.Stop()
+		w.check(time.Now().UTC())
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case t := <-ticker.C:
+				w.check(t.UTC())
+			}
+		}
+	}()
+}
+
+// Statuses returns the status of all SLOs sorted by cluster and collection
+func (w *Watchdog) Statuses() []Status {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	statuses := make([]Status, 0, len(w.statuses))
+	for _, status := range w.statuses {
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		a, b := statuses[i], statuses[j]
+		return a.Cluster < b.Cluster || (a.Cluster == b.Cluster && a.Collection < b.Collection)
+	})
+	return statuses
+}
+
+// check evaluates all SLOs at now
+func (w *Watchdog) check(now time.Time) {
+	entries, err := w.catalog.Entries(func(entry app.CatalogEntry) bool {
+		return entry.Status == app.CatalogSucceeded
+	})
+	if err != nil {
+		w.logger.Error("check: error reading catalog", zap.Error(err))
+		return
+	}
+	lastBackup := make(map[string]time.Time)
+	lastOffsite := make(map[string]time.Time)
+	for _, entry := range entries {
+		key := path.Join(entry.Cluster, entry.Collection)
+		if entry.Time.After(lastBackup[key]) {
+			lastBackup[key] = entry.Time
+		}
+		if entry.Object != "" && entry.Time.After(lastOffsite[key]) {
+			lastOffsite[key] = entry.Time
+		}
+	}
+
+	for name, slo := range w.config.SLOs {
+		status := Status{
+			Name:          name,
+			Cluster:       slo.ClusterName(),
+			Collection:    slo.CollectionName(name),
+			MaxAgeInHours: slo.MaxAgeInHours,
+			Offsite:       slo.Offsite,
+			CheckedAt:     now,
+		}
+		key := path.Join(status.Cluster, status.Collection)
+		backup, offsite := lastBackup[key], lastOffsite[key]
+		if !backup.IsZero() {
+			status.LastBackup = &backup
+		}
+		if !offsite.IsZero() {
+			status.LastOffsite = &offsite
+		}
+		status.Reason = w.violation(slo, now, backup, "backup")
+		if status.Reason == "" && slo.Offsite {
+			status.Reason = w.violation(slo, now, offsite, "offsite copy")
+		}
+		status.Violated = status.Reason != ""
+		w.metrics.SetFreshness(status.Cluster, status.Collection, offsite, status.Violated)
+		w.update(name, slo, status)
+	}
+}
+
+// violation returns why last violates slo at now, empty if it doesn't. Collections without backups are measured
+// from the start of the watchdog.
+func (w *Watchdog) violation(slo SLO, now time.Time, last time.Time, kind string) string {
+	if last.IsZero() {
+		if now.Sub(w.started) > slo.MaxAge() {
+			return fmt.Sprintf("no successful %s since %s", kind, w.started.Format(time.RFC3339))
+		}
+		return ""
+	}
+	if age := now.Sub(last); age > slo.MaxAge() {
+		return fmt.Sprintf("last successful %s is %s old, max age is %dh", kind, age.Round(time.Minute), slo.MaxAgeInHours)
+	}
+	return ""
+}
+
+// update stores status and notifies a violation when it starts and every max age while it lasts
+func (w *Watchdog) update(name string, slo SLO, status Status) {
+	w.mu.Lock()
+	w.statuses[name] = status
+	notifyNow := false
+	if !status.Violated {
+		delete(w.notified, name)
+	} else if last, ok := w.notified[name]; !ok || status.CheckedAt.Sub(last) >= slo.MaxAge() {
+		w.notified[name] = status.CheckedAt
+		notifyNow = true
+	}
+	w.mu.Unlock()
+
+	if !notifyNow {
+		return
+	}
+	w.logger.Warn("update: freshness SLO violated", zap.String("cluster", status.Cluster), zap.String("collection", status.Collection), zap.String("reason", status.Reason))
+	w.notifier.Notify(notify.Event{
+		Type:       notify.EventBackupStale,
+		Status:     notify.StatusFailed,
+		Cluster:    status.Cluster,
+		Collection: status.Collection,
+		Error:      status.Reason,
+	})
+}
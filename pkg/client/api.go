@@ -0,0 +1,220 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// TriggerBackup backs up the cluster into the collection with the engine specific JSON options, which may be nil
+func (c *Client) TriggerBackup(ctx context.Context, cluster string, collection string, options json.RawMessage) (Started, error) {
+	var started Started
+	err := c.do(ctx, request{
+		method:      http.MethodPost,
+		path:        "/clusters/" + url.PathEscape(cluster) + "/backup/" + url.PathEscape(collection),
+		contentType: jsonContentType(options),
+		body:        options,
+		out:         &started,
+	})
+	return started, err
+}
+
+// Restore restores the backup (e.g. /2022/01/24-163045.99) of the collection into the cluster with the engine
+// specific JSON options, which may be nil. An empty backup restores the LATEST one.
+func (c *Client) Restore(ctx context.Context, cluster string, collection string, backup string, options json.RawMessage) (Started, error) {
+	var query url.Values
+	if backup != "" {
+		query = url.Values{"backup": {backup}}
+	}
+	var started Started
+	err := c.do(ctx, request{
+		method:      http.MethodPost,
+		path:        "/clusters/" + url.PathEscape(cluster) + "/restore/" + url.PathEscape(collection),
+		query:       query,
+		contentType: jsonContentType(options),
+		body:        options,
+		out:         &started,
+	})
+	return started, err
+}
+
+// RestoreFromBucket downloads, decrypts and unzips the object into the backups of the service, where the engine can
+// restore it from. It returns the message of the service.
+func (c *Client) RestoreFromBucket(ctx context.Context, object string) (string, error) {
+	var resp struct {
+		Message string `json:"message"`
+	}
+	err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/fromBucket/" + url.PathEscape(object),
+		out:    &resp,
+	})
+	return resp.Message, err
+}
+
+// Verify starts a job which downloads the object, decrypts it and checks the files of its zip
+func (c *Client) Verify(ctx context.Context, object string) (Started, error) {
+	var started Started
+	err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/verify/" + url.PathEscape(object),
+		out:    &started,
+	})
+	return started, err
+}
+
+// BucketObjects returns the backups in the bucket whose names start with prefix, which may be empty
+func (c *Client) BucketObjects(ctx context.Context, prefix string) ([]BucketObject, error) {
+	var query url.Values
+	if prefix != "" {
+		query = url.Values{"prefix": {prefix}}
+	}
+	var objects []BucketObject
+	err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   "/bucket",
+		query:  query,
+		out:    &objects,
+	})
+	return objects, err
+}
+
+// Ingest stores artifact as a new backup of the collection in the ingest cluster, named name. Ingests are not
+// retried, artifact is only read once.
+func (c *Client) Ingest(ctx context.Context, collection string, name string, artifact io.Reader) (Started, error) {
+	var started Started
+	err := c.do(ctx, request{
+		method:      http.MethodPost,
+		path:        "/ingest/" + url.PathEscape(collection),
+		query:       url.Values{"name": {name}},
+		contentType: "application/octet-stream",
+		stream:      artifact,
+		out:         &started,
+	})
+	return started, err
+}
+
+// ListBackups returns the local backup directories per collection ({cluster}/{collection})
+func (c *Client) ListBackups(ctx context.Context) (map[string][]string, error) {
+	backups := make(map[string][]string)
+	err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   "/listBackups",
+		out:    &backups,
+	})
+	return backups, err
+}
+
+// Job returns the job with the given id
+func (c *Client) Job(ctx context.Context, id string) (Job, error) {
+	var job Job
+	err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   "/jobs/" + url.PathEscape(id),
+		out:    &job,
+	})
+	return job, err
+}
+
+// ListJobs returns the jobs of the kind and status, the newest first. Empty kind or status don't filter the jobs.
+func (c *Client) ListJobs(ctx context.Context, kind string, status string) ([]Job, error) {
+	query := url.Values{}
+	if kind != "" {
+		query.Set("kind", kind)
+	}
+	if status != "" {
+		query.Set("status", status)
+	}
+	var jobs []Job
+	err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   "/jobs/",
+		query:  query,
+		out:    &jobs,
+	})
+	return jobs, err
+}
+
+// WaitForJob polls the job with the given id every interval until it finished or ctx is done
+func (c *Client) WaitForJob(ctx context.Context, id string, interval time.Duration) (Job, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		job, err := c.Job(ctx, id)
+		if err != nil || job.Finished() {
+			return job, err
+		}
+		select {
+		case <-ctx.Done():
+			return job, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// PauseJob pauses the engine job of the job with the given id
+func (c *Client) PauseJob(ctx context.Context, id string) error {
+	return c.controlJob(ctx, id, "pause")
+}
+
+// ResumeJob resumes the paused engine job of the job with the given id
+func (c *Client) ResumeJob(ctx context.Context, id string) error {
+	return c.controlJob(ctx, id, "resume")
+}
+
+// CancelJob cancels the engine job of the job with the given id
+func (c *Client) CancelJob(ctx context.Context, id string) error {
+	return c.controlJob(ctx, id, "cancel")
+}
+
+func (c *Client) controlJob(ctx context.Context, id string, operation string) error {
+	return c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/jobs/" + url.PathEscape(id) + "/" + operation,
+	})
+}
+
+// Clusters returns the configured clusters in the scope of the caller with their health
+func (c *Client) Clusters(ctx context.Context) ([]ClusterHealth, error) {
+	var clusters []ClusterHealth
+	err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   "/clusters/",
+		out:    &clusters,
+	})
+	return clusters, err
+}
+
+// ClusterHealth checks the health of the cluster, an unavailable cluster is returned as an error matching
+// ErrUnavailable
+func (c *Client) ClusterHealth(ctx context.Context, cluster string) (ClusterHealth, error) {
+	var health ClusterHealth
+	err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   "/clusters/" + url.PathEscape(cluster) + "/health",
+		out:    &health,
+	})
+	return health, err
+}
+
+// Status returns the freshness SLOs of the collections in the scope of the caller
+func (c *Client) Status(ctx context.Context) (Status, error) {
+	var status Status
+	err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   "/status",
+		out:    &status,
+	})
+	return status, err
+}
+
+// jsonContentType returns the content type of the JSON options, empty without options
+func jsonContentType(options json.RawMessage) string {
+	if len(options) == 0 {
+		return ""
+	}
+	return "application/json"
+}
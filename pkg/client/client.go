@@ -0,0 +1,172 @@
+// Package client is a Go client of the HTTP API of backupsmanager
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// defaultRetryBackoff is the wait before the first retry, doubled on every following one
+const defaultRetryBackoff = 500 * time.Millisecond
+
+type Config struct {
+	// BaseURL of the API, e.g. https://backupsmanager.nip.io:31000
+	BaseURL string
+	// Token is the bearer token, required when authentication is enabled in the service
+	Token string
+	// MaxRetries of a request, defaults to 3, negative disables retries
+	MaxRetries int
+	// RetryBackoff is the wait before the first retry, doubled on every following one, defaults to 500ms
+	RetryBackoff time.Duration
+	// HTTPClient sends the requests, e.g. with a client certificate. The default client has no timeout, the
+	// contexts of the calls limit them.
+	HTTPClient *http.Client
+}
+
+func (c Config) Assert() error {
+	u, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return fmt.Errorf("c.BaseURL is invalid: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("c.BaseURL must be an absolute http or https URL")
+	}
+	if c.RetryBackoff < 0 {
+		return errors.New("c.RetryBackoff can't be negative")
+	}
+	return nil
+}
+
+// Client calls the API of backupsmanager. Requests which the service did not act upon are retried: reads on network
+// errors and on 429, 502, 503 and 504 responses, operations only on 429 responses, since retrying them could start
+// a backup or restore twice.
+type Client struct {
+	baseURL      string
+	token        string
+	maxRetries   int
+	retryBackoff time.Duration
+	httpClient   *http.Client
+}
+
+func New(config Config) (*Client, error) {
+	if err := config.Assert(); err != nil {
+		return nil, err
+	}
+	c := &Client{
+		baseURL:      strings.TrimSuffix(config.BaseURL, "/"),
+		token:        config.Token,
+		maxRetries:   config.MaxRetries,
+		retryBackoff: config.RetryBackoff,
+		httpClient:   config.HTTPClient,
+	}
+	if c.maxRetries == 0 {
+		c.maxRetries = 3
+	}
+	if c.retryBackoff == 0 {
+		c.retryBackoff = defaultRetryBackoff
+	}
+	if c.httpClient == nil {
+		c.httpClient = &http.Client{}
+	}
+	return c, nil
+}
+
+// request is an API call, body or stream is sent as is and the JSON response is decoded into out when set.
+// Requests with a stream are never retried, it can only be read once.
+type request struct {
+	method      string
+	path        string
+	query       url.Values
+	contentType string
+	body        []byte
+	stream      io.Reader
+	out         interface{}
+}
+
+// do sends req, retrying it while allowed, and decodes its response. Responses with an error status are returned
+// as *Error.
+func (c *Client) do(ctx context.Context, req request) error {
+	backoff := c.retryBackoff
+	for attempt := 0; ; attempt++ {
+		retry, err := c.send(ctx, req)
+		if err == nil || !retry || req.stream != nil || attempt >= c.maxRetries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// send sends req once, returning whether it may be retried when it failed
+func (c *Client) send(ctx context.Context, req request) (bool, error) {
+	u := c.baseURL + req.path
+	if len(req.query) > 0 {
+		u += "?" + req.query.Encode()
+	}
+	body := req.stream
+	if req.body != nil {
+		body = bytes.NewReader(req.body)
+	}
+	httpReq, err := c.newHTTPRequest(ctx, req.method, u, body, "application/json")
+	if err != nil {
+		return false, err
+	}
+	if req.contentType != "" {
+		httpReq.Header.Set("Content-Type", req.contentType)
+	}
+
+	idempotent := req.method == http.MethodGet
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return idempotent && ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return idempotent, fmt.Errorf("error reading response: %w", err)
+	}
+
+	if resp.StatusCode >= 400 {
+		apiErr := newError(resp.StatusCode, content, resp.Header.Get("X-Request-Id"))
+		switch resp.StatusCode {
+		case http.StatusTooManyRequests:
+			return true, apiErr
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return idempotent, apiErr
+		}
+		return false, apiErr
+	}
+	if req.out == nil {
+		return false, nil
+	}
+	if err := json.Unmarshal(content, req.out); err != nil {
+		return false, fmt.Errorf("error decoding response: %w", err)
+	}
+	return false, nil
+}
+
+// newHTTPRequest returns a request to the API accepting the given content type, authenticated with the token
+func (c *Client) newHTTPRequest(ctx context.Context, method string, u string, body io.Reader, accept string) (*http.Request, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Accept", accept)
+	if c.token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return httpReq, nil
+}
@@ -0,0 +1,445 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testBackoff keeps the retries of the tests fast
+const testBackoff = 10 * time.Millisecond
+
+// testService records the requests it receives and answers them with handler
+type testService struct {
+	mu       sync.Mutex
+	requests []*http.Request
+	times    []time.Time
+}
+
+func (s *testService) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.requests)
+}
+
+func testClient(t *testing.T, config Config, handler http.HandlerFunc) (*Client, *testService) {
+	service := &testService{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		service.mu.Lock()
+		service.requests = append(service.requests, r)
+		service.times = append(service.times, time.Now())
+		service.mu.Unlock()
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	config.BaseURL = server.URL + "/"
+	if config.RetryBackoff == 0 {
+		config.RetryBackoff = testBackoff
+	}
+	c, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, service
+}
+
+// respond answers with status and body, the body is JSON when it starts with {
+func respond(w http.ResponseWriter, status int, body string) {
+	if strings.HasPrefix(body, "{") {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.Header().Set("X-Request-Id", "header-id")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(body))
+}
+
+func TestClientRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		call     func(c *Client) error
+		requests int
+	}{
+		{
+			name:   "503 on GET is retried",
+			status: http.StatusServiceUnavailable,
+			call: func(c *Client) error {
+				_, err := c.Job(context.Background(), "1")
+				return err
+			},
+			requests: 4,
+		},
+		{
+			name:   "502 on GET is retried",
+			status: http.StatusBadGateway,
+			call: func(c *Client) error {
+				_, err := c.Clusters(context.Background())
+				return err
+			},
+			requests: 4,
+		},
+		{
+			name:   "503 on POST is not retried",
+			status: http.StatusServiceUnavailable,
+			call: func(c *Client) error {
+				_, err := c.TriggerBackup(context.Background(), "default", "payments", nil)
+				return err
+			},
+			requests: 1,
+		},
+		{
+			name:   "429 on POST is retried",
+			status: http.StatusTooManyRequests,
+			call: func(c *Client) error {
+				_, err := c.Restore(context.Background(), "default", "payments", "", nil)
+				return err
+			},
+			requests: 4,
+		},
+		{
+			name:   "500 on GET is not retried",
+			status: http.StatusInternalServerError,
+			call: func(c *Client) error {
+				_, err := c.Status(context.Background())
+				return err
+			},
+			requests: 1,
+		},
+		{
+			name:   "429 on a stream is not retried",
+			status: http.StatusTooManyRequests,
+			call: func(c *Client) error {
+				_, err := c.Ingest(context.Background(), "etcd", "snapshot.db", strings.NewReader("snapshot"))
+				return err
+			},
+			requests: 1,
+		},
+		{
+			name:   "503 on a stream is not retried",
+			status: http.StatusServiceUnavailable,
+			call: func(c *Client) error {
+				_, err := c.Ingest(context.Background(), "etcd", "snapshot.db", strings.NewReader("snapshot"))
+				return err
+			},
+			requests: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, service := testClient(t, Config{}, func(w http.ResponseWriter, r *http.Request) {
+				respond(w, tt.status, `{"code":"unavailable","message":"try again"}`)
+			})
+			var apiErr *Error
+			if err := tt.call(c); !errors.As(err, &apiErr) || apiErr.StatusCode != tt.status {
+				t.Fatalf("error is %v, want an *Error with status %d", err, tt.status)
+			}
+			if got := service.count(); got != tt.requests {
+				t.Errorf("service received %d requests, want %d", got, tt.requests)
+			}
+		})
+	}
+}
+
+func TestClientRetrySucceeds(t *testing.T) {
+	// the service is unavailable for the first two requests
+	var attempts int32
+	c, service := testClient(t, Config{}, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) <= 2 {
+			respond(w, http.StatusServiceUnavailable, "unavailable")
+			return
+		}
+		respond(w, http.StatusOK, `[{"id":"1","status":"running"}]`)
+	})
+
+	jobs, err := c.ListJobs(context.Background(), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].ID != "1" {
+		t.Errorf("jobs are %+v, want job 1", jobs)
+	}
+	if got := service.count(); got != 3 {
+		t.Errorf("service received %d requests, want 3", got)
+	}
+}
+
+func TestClientMaxRetries(t *testing.T) {
+	tests := []struct {
+		maxRetries int
+		requests   int
+	}{
+		{maxRetries: 0, requests: 4},
+		{maxRetries: 1, requests: 2},
+		{maxRetries: -1, requests: 1},
+	}
+	for _, tt := range tests {
+		c, service := testClient(t, Config{MaxRetries: tt.maxRetries}, func(w http.ResponseWriter, r *http.Request) {
+			respond(w, http.StatusServiceUnavailable, "unavailable")
+		})
+		_, _ = c.ListBackups(context.Background())
+		if got := service.count(); got != tt.requests {
+			t.Errorf("MaxRetries %d: service received %d requests, want %d", tt.maxRetries, got, tt.requests)
+		}
+	}
+}
+
+func TestClientBackoff(t *testing.T) {
+	c, service := testClient(t, Config{RetryBackoff: 20 * time.Millisecond}, func(w http.ResponseWriter, r *http.Request) {
+		respond(w, http.StatusTooManyRequests, "slow down")
+	})
+	_, _ = c.Verify(context.Background(), "object")
+
+	service.mu.Lock()
+	defer service.mu.Unlock()
+	if len(service.times) != 4 {
+		t.Fatalf("service received %d requests, want 4", len(service.times))
+	}
+	want := 20 * time.Millisecond
+	for i := 1; i < len(service.times); i++ {
+		if wait := service.times[i].Sub(service.times[i-1]); wait < want {
+			t.Errorf("wait before retry %d is %s, want at least %s", i, wait, want)
+		}
+		want *= 2
+	}
+}
+
+func TestClientCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c, service := testClient(t, Config{RetryBackoff: time.Hour}, func(w http.ResponseWriter, r *http.Request) {
+		cancel()
+		respond(w, http.StatusServiceUnavailable, "unavailable")
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Job(ctx, "1")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("error is %v, want context.Canceled", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the retry did not stop when the context was canceled")
+	}
+	if got := service.count(); got != 1 {
+		t.Errorf("service received %d requests, want 1", got)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		body      string
+		want      Error
+		is        error
+		errString string
+	}{
+		{
+			name:      "error model",
+			status:    http.StatusNotFound,
+			body:      `{"code":"job_not_found","message":"Job not found","requestId":"body-id"}`,
+			want:      Error{StatusCode: http.StatusNotFound, Code: "job_not_found", Message: "Job not found", RequestID: "body-id"},
+			is:        ErrNotFound,
+			errString: "backupsmanager: 404 job_not_found: Job not found (request body-id)",
+		},
+		{
+			name:      "error model without request ID",
+			status:    http.StatusConflict,
+			body:      `{"code":"job_not_running","message":"Job has no running engine job"}`,
+			want:      Error{StatusCode: http.StatusConflict, Code: "job_not_running", Message: "Job has no running engine job", RequestID: "header-id"},
+			is:        ErrConflict,
+			errString: "backupsmanager: 409 job_not_running: Job has no running engine job (request header-id)",
+		},
+		{
+			name:      "plain text",
+			status:    http.StatusBadGateway,
+			body:      "upstream connect error",
+			want:      Error{StatusCode: http.StatusBadGateway, Message: "upstream connect error", RequestID: "header-id"},
+			errString: "backupsmanager: 502 Bad Gateway: upstream connect error (request header-id)",
+		},
+		{
+			name:      "JSON without message",
+			status:    http.StatusForbidden,
+			body:      `{"error":"denied"}`,
+			want:      Error{StatusCode: http.StatusForbidden, Message: `{"error":"denied"}`, RequestID: "header-id"},
+			is:        ErrForbidden,
+			errString: `backupsmanager: 403 Forbidden: {"error":"denied"} (request header-id)`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := testClient(t, Config{MaxRetries: -1}, func(w http.ResponseWriter, r *http.Request) {
+				respond(w, tt.status, tt.body)
+			})
+			err := c.CancelJob(context.Background(), "1")
+
+			var apiErr *Error
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("error is %v, want an *Error", err)
+			}
+			if *apiErr != tt.want {
+				t.Errorf("error is %+v, want %+v", *apiErr, tt.want)
+			}
+			if err.Error() != tt.errString {
+				t.Errorf("Error() is %q, want %q", err.Error(), tt.errString)
+			}
+			if tt.is != nil && !errors.Is(err, tt.is) {
+				t.Errorf("errors.Is(err, %v) is false", tt.is)
+			}
+			for _, other := range []error{ErrBadRequest, ErrUnauthorized, ErrForbidden, ErrNotFound, ErrConflict, ErrNotImplemented, ErrUnavailable} {
+				if other != tt.is && errors.Is(err, other) {
+					t.Errorf("errors.Is(err, %v) is true", other)
+				}
+			}
+		})
+	}
+}
+
+func TestErrorIs(t *testing.T) {
+	for status, target := range statusErrors {
+		if err := (&Error{StatusCode: status}); !err.Is(target) {
+			t.Errorf("error with status %d is not %v", status, target)
+		}
+	}
+	if err := (&Error{StatusCode: http.StatusInternalServerError}); err.Is(ErrUnavailable) || err.Is(ErrBadRequest) {
+		t.Error("error with status 500 matches an error")
+	}
+}
+
+func TestClientRequests(t *testing.T) {
+	tests := []struct {
+		name        string
+		call        func(c *Client) error
+		method      string
+		path        string
+		query       string
+		contentType string
+		body        string
+		// response is the JSON body of the response, an object by default
+		response string
+	}{
+		{
+			name: "escaped path",
+			call: func(c *Client) error {
+				_, err := c.TriggerBackup(context.Background(), "payments prod", "a/b", json.RawMessage(`{"revision_history":true}`))
+				return err
+			},
+			method:      http.MethodPost,
+			path:        "/clusters/payments%20prod/backup/a%2Fb",
+			contentType: "application/json",
+			body:        `{"revision_history":true}`,
+		},
+		{
+			name: "restore of a backup",
+			call: func(c *Client) error {
+				_, err := c.Restore(context.Background(), "default", "payments", "/2022/01/24-163045.99", nil)
+				return err
+			},
+			method: http.MethodPost,
+			path:   "/clusters/default/restore/payments",
+			query:  "backup=%2F2022%2F01%2F24-163045.99",
+		},
+		{
+			name: "restore of the LATEST backup",
+			call: func(c *Client) error {
+				_, err := c.Restore(context.Background(), "default", "payments", "", nil)
+				return err
+			},
+			method: http.MethodPost,
+			path:   "/clusters/default/restore/payments",
+		},
+		{
+			name: "filtered jobs",
+			call: func(c *Client) error {
+				_, err := c.ListJobs(context.Background(), JobBackup, JobRunning)
+				return err
+			},
+			method:   http.MethodGet,
+			path:     "/jobs/",
+			query:    "kind=backup&status=running",
+			response: "[]",
+		},
+		{
+			name: "bucket prefix",
+			call: func(c *Client) error {
+				_, err := c.BucketObjects(context.Background(), "default/payments 2022&")
+				return err
+			},
+			method:   http.MethodGet,
+			path:     "/bucket",
+			query:    "prefix=default%2Fpayments+2022%26",
+			response: "[]",
+		},
+		{
+			name: "ingest stream",
+			call: func(c *Client) error {
+				_, err := c.Ingest(context.Background(), "etcd", "snap shot.db", strings.NewReader("snapshot"))
+				return err
+			},
+			method:      http.MethodPost,
+			path:        "/ingest/etcd",
+			query:       "name=snap+shot.db",
+			contentType: "application/octet-stream",
+			body:        "snapshot",
+		},
+		{
+			name: "job operation",
+			call: func(c *Client) error {
+				return c.PauseJob(context.Background(), "4?2")
+			},
+			method: http.MethodPost,
+			path:   "/jobs/4%3F2/pause",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body []byte
+			c, service := testClient(t, Config{Token: "secret"}, func(w http.ResponseWriter, r *http.Request) {
+				body, _ = ioutil.ReadAll(r.Body)
+				response := tt.response
+				if response == "" {
+					response = `{"message":"ok"}`
+				}
+				respond(w, http.StatusOK, response)
+			})
+			if err := tt.call(c); err != nil {
+				t.Fatal(err)
+			}
+
+			r := service.requests[0]
+			if r.Method != tt.method {
+				t.Errorf("method is %s, want %s", r.Method, tt.method)
+			}
+			if r.URL.EscapedPath() != tt.path {
+				t.Errorf("path is %s, want %s", r.URL.EscapedPath(), tt.path)
+			}
+			if r.URL.RawQuery != tt.query {
+				t.Errorf("query is %s, want %s", r.URL.RawQuery, tt.query)
+			}
+			if r.Header.Get("Content-Type") != tt.contentType {
+				t.Errorf("Content-Type is %q, want %q", r.Header.Get("Content-Type"), tt.contentType)
+			}
+			if string(body) != tt.body {
+				t.Errorf("body is %q, want %q", body, tt.body)
+			}
+			if auth := r.Header.Get("Authorization"); auth != "Bearer secret" {
+				t.Errorf("Authorization is %q", auth)
+			}
+			if accept := r.Header.Get("Accept"); accept != "application/json" {
+				t.Errorf("Accept is %q", accept)
+			}
+		})
+	}
+}
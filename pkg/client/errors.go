@@ -0,0 +1,65 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Errors matched by the *Error of a response with errors.Is, by status code
+var (
+	ErrBadRequest     = errors.New("bad request")
+	ErrUnauthorized   = errors.New("unauthorized")
+	ErrForbidden      = errors.New("forbidden")
+	ErrNotFound       = errors.New("not found")
+	ErrConflict       = errors.New("conflict")
+	ErrNotImplemented = errors.New("not implemented")
+	ErrUnavailable    = errors.New("unavailable")
+)
+
+var statusErrors = map[int]error{
+	http.StatusBadRequest:         ErrBadRequest,
+	http.StatusUnauthorized:       ErrUnauthorized,
+	http.StatusForbidden:          ErrForbidden,
+	http.StatusNotFound:           ErrNotFound,
+	http.StatusConflict:           ErrConflict,
+	http.StatusNotImplemented:     ErrNotImplemented,
+	http.StatusServiceUnavailable: ErrUnavailable,
+}
+
+// Error is a response of the API with an error status
+type Error struct {
+	StatusCode int `json:"-"`
+	// Code is the machine-readable code of the error, e.g. invalid_options or job_not_found
+	Code string `json:"code"`
+	// Message is the message of the JSON response, or its body when it is not JSON
+	Message string `json:"message"`
+	// RequestID identifies the request in the logs and the audit log of the service
+	RequestID string `json:"requestId"`
+}
+
+func newError(statusCode int, body []byte, requestID string) *Error {
+	e := &Error{}
+	if err := json.Unmarshal(body, e); err != nil || e.Message == "" {
+		e = &Error{Message: string(body)}
+	}
+	e.StatusCode = statusCode
+	if e.RequestID == "" {
+		e.RequestID = requestID
+	}
+	return e
+}
+
+func (e *Error) Error() string {
+	code := e.Code
+	if code == "" {
+		code = http.StatusText(e.StatusCode)
+	}
+	return fmt.Sprintf("backupsmanager: %d %s: %s (request %s)", e.StatusCode, code, e.Message, e.RequestID)
+}
+
+// Is reports whether target is the error of the status code, e.g. errors.Is(err, ErrNotFound)
+func (e *Error) Is(target error) bool {
+	return statusErrors[e.StatusCode] == target
+}
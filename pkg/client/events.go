@@ -0,0 +1,115 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Types of the events of a job
+const (
+	// EventJob is sent when the stream starts and when the status, fraction completed or result of the job changed
+	EventJob = "job"
+	// EventStage is sent when the job moved to another stage
+	EventStage = "stage"
+	// EventProgress is sent while a stage processes the bytes of the backup
+	EventProgress = "progress"
+	// EventDone is the last event, once the job finished
+	EventDone = "done"
+)
+
+// eventsReconnectDelay is the wait before reconnecting to an event stream ended by the service
+const eventsReconnectDelay = time.Second
+
+// JobEvent is an event of a job
+type JobEvent struct {
+	// Type is EventJob, EventStage, EventProgress or EventDone
+	Type string
+	// Job is the job after the change, nil for EventProgress
+	Job *Job
+	// Progress is set for EventProgress
+	Progress *StageProgress
+}
+
+// StageProgress is the number of bytes processed by a stage of the pipeline, zip, encrypt or upload
+type StageProgress struct {
+	Stage string `json:"stage"`
+	Bytes int64  `json:"bytes"`
+	// TotalBytes is the size of the input of the stage, 0 when unknown
+	TotalBytes int64 `json:"totalBytes"`
+}
+
+// WatchJob follows the events of the job with the given id until it finished, calling onEvent for every event, and
+// returns the finished job. The service ends its streams before its write timeout, WatchJob reconnects then.
+func (c *Client) WatchJob(ctx context.Context, id string, onEvent func(JobEvent)) (Job, error) {
+	for {
+		job, err := c.streamJobEvents(ctx, id, onEvent)
+		if err != nil || job.Finished() {
+			return job, err
+		}
+		select {
+		case <-ctx.Done():
+			return job, ctx.Err()
+		case <-time.After(eventsReconnectDelay):
+		}
+	}
+}
+
+// streamJobEvents reads one event stream of the job, returning the last state of the job it received
+func (c *Client) streamJobEvents(ctx context.Context, id string, onEvent func(JobEvent)) (Job, error) {
+	httpReq, err := c.newHTTPRequest(ctx, http.MethodGet, c.baseURL+"/jobs/"+url.PathEscape(id)+"/events", nil, "text/event-stream")
+	if err != nil {
+		return Job{}, err
+	}
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return Job{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		content, _ := ioutil.ReadAll(resp.Body)
+		return Job{}, newError(resp.StatusCode, content, resp.Header.Get("X-Request-Id"))
+	}
+
+	var job Job
+	var eventType, data string
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			eventType = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		case line == "" && data != "":
+			event := JobEvent{Type: eventType}
+			if eventType == EventProgress {
+				event.Progress = &StageProgress{}
+				err = json.Unmarshal([]byte(data), event.Progress)
+			} else {
+				event.Job = &Job{}
+				if err = json.Unmarshal([]byte(data), event.Job); err == nil {
+					job = *event.Job
+				}
+			}
+			if err != nil {
+				return job, fmt.Errorf("error decoding %s event: %w", eventType, err)
+			}
+			if onEvent != nil {
+				onEvent(event)
+			}
+			eventType, data = "", ""
+		}
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		return job, fmt.Errorf("error reading events: %w", err)
+	}
+	return job, ctx.Err()
+}
@@ -0,0 +1,88 @@
+package client
+
+import "time"
+
+// Job statuses
+const (
+	JobRunning   = "running"
+	JobPaused    = "paused"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCanceled  = "canceled"
+)
+
+// Job kinds
+const (
+	JobBackup  = "backup"
+	JobRestore = "restore"
+	JobIngest  = "ingest"
+	JobVerify  = "verify"
+)
+
+// Job is a backup, restore, ingest or verification tracked by the service
+type Job struct {
+	ID                string  `json:"id"`
+	Kind              string  `json:"kind"`
+	Cluster           string  `json:"cluster"`
+	Collection        string  `json:"collection"`
+	EngineJobID       int64   `json:"engineJobId,omitempty"`
+	Status            string  `json:"status"`
+	Stage             string  `json:"stage"`
+	FractionCompleted float64 `json:"fractionCompleted"`
+	Error             string  `json:"error,omitempty"`
+	// Backup is the backup directory inside the collection, e.g. /2022/01/24-163045.99
+	Backup string `json:"backup,omitempty"`
+	// Object is the name of the encrypted backup in the bucket
+	Object    string    `json:"object,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Finished returns true when the job can't change anymore
+func (j Job) Finished() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed || j.Status == JobCanceled
+}
+
+// Started is the response to a triggered backup, restore or ingest
+type Started struct {
+	Message string `json:"message"`
+	// JobID is the job to follow, empty when a restore finished right away
+	JobID string `json:"jobId,omitempty"`
+	// Backup is the backup directory of an ingested artifact
+	Backup string `json:"backup,omitempty"`
+}
+
+// BucketObject is an encrypted backup in the bucket
+type BucketObject struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	Updated time.Time `json:"updated"`
+}
+
+// ClusterHealth is the health of a configured cluster
+type ClusterHealth struct {
+	Name    string `json:"name"`
+	Engine  string `json:"engine,omitempty"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// Status is the freshness of the collections in the scope of the caller
+type Status struct {
+	Healthy bool        `json:"healthy"`
+	SLOs    []SLOStatus `json:"slos"`
+}
+
+// SLOStatus is the outcome of the last check of a freshness SLO
+type SLOStatus struct {
+	Name          string     `json:"name"`
+	Cluster       string     `json:"cluster"`
+	Collection    string     `json:"collection"`
+	MaxAgeInHours int        `json:"maxAgeInHours"`
+	Offsite       bool       `json:"offsite"`
+	LastBackup    *time.Time `json:"lastBackup,omitempty"`
+	LastOffsite   *time.Time `json:"lastOffsite,omitempty"`
+	Violated      bool       `json:"violated"`
+	Reason        string     `json:"reason,omitempty"`
+	CheckedAt     time.Time  `json:"checkedAt"`
+}
@@ -2,15 +2,24 @@ package database
 
 import (
 	"errors"
+	"net/url"
+	"strings"
 )
 
 type Config struct {
+	// Engine of the cluster: crdb (default), postgres or mysql
+	Engine       string
 	Host         string
 	User         string
 	Password     string
 	Database     string
 	Options      []string
 	MaxOpenConns int
+	// ToolsDir directory with the client tools of the engine (e.g. pg_dump), defaults to the PATH
+	ToolsDir string
+	// WebDAVUser and WebDAVPassword are the credentials CRDB uses to write its backups, generated when not set
+	WebDAVUser     string
+	WebDAVPassword string
 }
 
 func (c Config) Assert() error {
@@ -26,6 +35,34 @@ func (c Config) Assert() error {
 	if c.MaxOpenConns < 0 {
 		return errors.New("minimum value for convar MaxOpenConns is 0")
 	}
+	switch c.Engine {
+	case "", "crdb", "postgres", "mysql":
+	default:
+		return errors.New("unknown value for convar Engine")
+	}
+	if (c.WebDAVUser == "") != (c.WebDAVPassword == "") {
+		return errors.New("convars WebDAVUser and WebDAVPassword should be set together")
+	}
+	if strings.Contains(c.WebDAVUser, ":") {
+		return errors.New("convar WebDAVUser can't contain a colon")
+	}
 
 	return nil
 }
+
+// URL returns the connection URL of the database, the password is only included when requested
+func (c Config) URL(withPassword bool) *url.URL {
+	dsn := &url.URL{
+		Scheme:   "postgres",
+		Host:     c.Host,
+		Path:     c.Database,
+		RawQuery: strings.Join(c.Options, "&"),
+	}
+
+	if withPassword && c.Password != "" {
+		dsn.User = url.UserPassword(c.User, c.Password)
+	} else {
+		dsn.User = url.User(c.User)
+	}
+	return dsn
+}
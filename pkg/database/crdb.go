@@ -2,8 +2,6 @@ package database
 
 import (
 	"database/sql"
-	"net/url"
-	"strings"
 	"time"
 
 	_ "github.com/lib/pq" // postgres driver
@@ -11,18 +9,7 @@ import (
 
 func NewCrdb(cfg Config) (*sql.DB, error) {
 	const driver = "postgres" // depends on the driver, currently lib/pq
-	dsn := &url.URL{
-		Scheme:   driver,
-		Host:     cfg.Host,
-		Path:     cfg.Database,
-		RawQuery: strings.Join(cfg.Options, "&"),
-	}
-
-	if cfg.Password != "" {
-		dsn.User = url.UserPassword(cfg.User, cfg.Password)
-	} else {
-		dsn.User = url.User(cfg.User)
-	}
+	dsn := cfg.URL(true)
 
 	db, err := sql.Open(driver, dsn.String())
 	if err != nil {
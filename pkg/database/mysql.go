@@ -0,0 +1,53 @@
+package database
+
+import (
+	"database/sql"
+	"github.com/go-sql-driver/mysql"
+	"strings"
+	"time"
+)
+
+func NewMysql(cfg Config) (*sql.DB, error) {
+	const driver = "mysql"
+	dsn := mysql.NewConfig()
+	dsn.Net = "tcp"
+	dsn.Addr = cfg.Host
+	dsn.User = cfg.User
+	dsn.Passwd = cfg.Password
+	dsn.DBName = cfg.Database
+	dsn.Params = make(map[string]string)
+	for _, option := range cfg.Options {
+		if key, value := splitOption(option); key != "" {
+			dsn.Params[key] = value
+		}
+	}
+
+	db, err := sql.Open(driver, dsn.FormatDSN())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	// See NewCrdb for the reasoning behind these limits
+	if cfg.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(cfg.MaxOpenConns)
+		db.SetMaxIdleConns(cfg.MaxOpenConns)
+	}
+
+	db.SetConnMaxLifetime(time.Hour)
+	db.SetConnMaxIdleTime(3 * time.Minute)
+
+	return db, nil
+}
+
+func splitOption(option string) (string, string) {
+	elements := strings.SplitN(option, "=", 2)
+	if len(elements) != 2 {
+		return elements[0], ""
+	}
+	return elements[0], elements[1]
+}
@@ -0,0 +1,287 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             v3.19.1
+// source: backupsmanager/v1/backups.proto
+
+package backupsmanagerv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// BackupsClient is the client API for Backups service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type BackupsClient interface {
+	// TriggerBackup backs up the cluster into the collection and returns the job processing the backup
+	TriggerBackup(ctx context.Context, in *TriggerBackupRequest, opts ...grpc.CallOption) (*TriggerBackupResponse, error)
+	// ListBackups returns the local backups per collection in the scope of the caller
+	ListBackups(ctx context.Context, in *ListBackupsRequest, opts ...grpc.CallOption) (*ListBackupsResponse, error)
+	// Restore restores a backup of the collection into the cluster
+	Restore(ctx context.Context, in *RestoreRequest, opts ...grpc.CallOption) (*RestoreResponse, error)
+	// GetJob returns a job
+	GetJob(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (*Job, error)
+	// WatchJob streams the job on every change until it finished
+	WatchJob(ctx context.Context, in *WatchJobRequest, opts ...grpc.CallOption) (Backups_WatchJobClient, error)
+}
+
+type backupsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewBackupsClient(cc grpc.ClientConnInterface) BackupsClient {
+	return &backupsClient{cc}
+}
+
+func (c *backupsClient) TriggerBackup(ctx context.Context, in *TriggerBackupRequest, opts ...grpc.CallOption) (*TriggerBackupResponse, error) {
+	out := new(TriggerBackupResponse)
+	err := c.cc.Invoke(ctx, "/backupsmanager.v1.Backups/TriggerBackup", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *backupsClient) ListBackups(ctx context.Context, in *ListBackupsRequest, opts ...grpc.CallOption) (*ListBackupsResponse, error) {
+	out := new(ListBackupsResponse)
+	err := c.cc.Invoke(ctx, "/backupsmanager.v1.Backups/ListBackups", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *backupsClient) Restore(ctx context.Context, in *RestoreRequest, opts ...grpc.CallOption) (*RestoreResponse, error) {
+	out := new(RestoreResponse)
+	err := c.cc.Invoke(ctx, "/backupsmanager.v1.Backups/Restore", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *backupsClient) GetJob(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (*Job, error) {
+	out := new(Job)
+	err := c.cc.Invoke(ctx, "/backupsmanager.v1.Backups/GetJob", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *backupsClient) WatchJob(ctx context.Context, in *WatchJobRequest, opts ...grpc.CallOption) (Backups_WatchJobClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Backups_ServiceDesc.Streams[0], "/backupsmanager.v1.Backups/WatchJob", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &backupsWatchJobClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Backups_WatchJobClient interface {
+	Recv() (*Job, error)
+	grpc.ClientStream
+}
+
+type backupsWatchJobClient struct {
+	grpc.ClientStream
+}
+
+func (x *backupsWatchJobClient) Recv() (*Job, error) {
+	m := new(Job)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// BackupsServer is the server API for Backups service.
+// All implementations must embed UnimplementedBackupsServer
+// for forward compatibility
+type BackupsServer interface {
+	// TriggerBackup backs up the cluster into the collection and returns the job processing the backup
+	TriggerBackup(context.Context, *TriggerBackupRequest) (*TriggerBackupResponse, error)
+	// ListBackups returns the local backups per collection in the scope of the caller
+	ListBackups(context.Context, *ListBackupsRequest) (*ListBackupsResponse, error)
+	// Restore restores a backup of the collection into the cluster
+	Restore(context.Context, *RestoreRequest) (*RestoreResponse, error)
+	// GetJob returns a job
+	GetJob(context.Context, *GetJobRequest) (*Job, error)
+	// WatchJob streams the job on every change until it finished
+	WatchJob(*WatchJobRequest, Backups_WatchJobServer) error
+	mustEmbedUnimplementedBackupsServer()
+}
+
+// UnimplementedBackupsServer must be embedded to have forward compatible implementations.
+type UnimplementedBackupsServer struct {
+}
+
+func (UnimplementedBackupsServer) TriggerBackup(context.Context, *TriggerBackupRequest) (*TriggerBackupResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TriggerBackup not implemented")
+}
+func (UnimplementedBackupsServer) ListBackups(context.Context, *ListBackupsRequest) (*ListBackupsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListBackups not implemented")
+}
+func (UnimplementedBackupsServer) Restore(context.Context, *RestoreRequest) (*RestoreResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Restore not implemented")
+}
+func (UnimplementedBackupsServer) GetJob(context.Context, *GetJobRequest) (*Job, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetJob not implemented")
+}
+func (UnimplementedBackupsServer) WatchJob(*WatchJobRequest, Backups_WatchJobServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchJob not implemented")
+}
+func (UnimplementedBackupsServer) mustEmbedUnimplementedBackupsServer() {}
+
+// UnsafeBackupsServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to BackupsServer will
+// result in compilation errors.
+type UnsafeBackupsServer interface {
+	mustEmbedUnimplementedBackupsServer()
+}
+
+func RegisterBackupsServer(s grpc.ServiceRegistrar, srv BackupsServer) {
+	s.RegisterService(&Backups_ServiceDesc, srv)
+}
+
+func _Backups_TriggerBackup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TriggerBackupRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BackupsServer).TriggerBackup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/backupsmanager.v1.Backups/TriggerBackup",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BackupsServer).TriggerBackup(ctx, req.(*TriggerBackupRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Backups_ListBackups_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListBackupsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BackupsServer).ListBackups(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/backupsmanager.v1.Backups/ListBackups",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BackupsServer).ListBackups(ctx, req.(*ListBackupsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Backups_Restore_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RestoreRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BackupsServer).Restore(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/backupsmanager.v1.Backups/Restore",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BackupsServer).Restore(ctx, req.(*RestoreRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Backups_GetJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BackupsServer).GetJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/backupsmanager.v1.Backups/GetJob",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BackupsServer).GetJob(ctx, req.(*GetJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Backups_WatchJob_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchJobRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BackupsServer).WatchJob(m, &backupsWatchJobServer{stream})
+}
+
+type Backups_WatchJobServer interface {
+	Send(*Job) error
+	grpc.ServerStream
+}
+
+type backupsWatchJobServer struct {
+	grpc.ServerStream
+}
+
+func (x *backupsWatchJobServer) Send(m *Job) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Backups_ServiceDesc is the grpc.ServiceDesc for Backups service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Backups_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "backupsmanager.v1.Backups",
+	HandlerType: (*BackupsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "TriggerBackup",
+			Handler:    _Backups_TriggerBackup_Handler,
+		},
+		{
+			MethodName: "ListBackups",
+			Handler:    _Backups_ListBackups_Handler,
+		},
+		{
+			MethodName: "Restore",
+			Handler:    _Backups_Restore_Handler,
+		},
+		{
+			MethodName: "GetJob",
+			Handler:    _Backups_GetJob_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchJob",
+			Handler:       _Backups_WatchJob_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "backupsmanager/v1/backups.proto",
+}
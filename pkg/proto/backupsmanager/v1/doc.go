@@ -0,0 +1,4 @@
+// Package backupsmanagerv1 is the gRPC API of the backups manager, generated from backups.proto
+package backupsmanagerv1
+
+//go:generate protoc -I ../.. --go_out=../.. --go_opt=paths=source_relative --go-grpc_out=../.. --go-grpc_opt=paths=source_relative backupsmanager/v1/backups.proto
@@ -1,18 +1,21 @@
 package server
 
 import (
+	"crypto/tls"
 	"net/http"
 	"time"
 )
 
-func New(mux *http.ServeMux, serverAddress string) *http.Server {
+// New returns the HTTP server, serving HTTPS when tlsConfig is set
+func New(handler http.Handler, serverAddress string, readTimeout time.Duration, writeTimeout time.Duration, tlsConfig *tls.Config) *http.Server {
 	srv := &http.Server{
-		Addr:         serverAddress,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
-		IdleTimeout:  120 * time.Second,
-		TLSConfig:    nil,
-		Handler:      mux,
+		Addr:              serverAddress,
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       120 * time.Second,
+		TLSConfig:         tlsConfig,
+		Handler:           handler,
 	}
 	return srv
 }
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// certCheckInterval is the minimum interval between checks for a rotated certificate
+const certCheckInterval = 10 * time.Second
+
+type TLSConfig struct {
+	// CertFile PEM certificate chain of the server, TLS is enabled when set
+	CertFile string
+	// KeyFile PEM private key of the server
+	KeyFile string
+	// ClientCAFile PEM certificates of the CAs of client certificates, enables mutual TLS when set
+	ClientCAFile string
+	// RequireClientCert rejects clients without certificate, otherwise a client certificate is only verified when given
+	RequireClientCert bool
+	// AllowedClientCNs limits the client certificates to these common names, all verified ones when empty
+	AllowedClientCNs []string
+}
+
+// Enabled returns true when TLS is configured
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != ""
+}
+
+func (c TLSConfig) Assert() error {
+	if !c.Enabled() {
+		if c.KeyFile != "" || c.ClientCAFile != "" {
+			return errors.New("c.CertFile is required for TLS")
+		}
+		return nil
+	}
+	if c.KeyFile == "" {
+		return errors.New("c.KeyFile is required for TLS")
+	}
+	if c.ClientCAFile == "" && (c.RequireClientCert || len(c.AllowedClientCNs) > 0) {
+		return errors.New("c.ClientCAFile is required to verify client certificates")
+	}
+	return nil
+}
+
+// NewTLSConfig returns the TLS configuration of the server. The certificate is reloaded when its files change, so
+// it can be rotated without a restart.
+func NewTLSConfig(logger *zap.Logger, config TLSConfig) (*tls.Config, error) {
+	reloader := &certReloader{
+		logger:   logger,
+		certFile: config.CertFile,
+		keyFile:  config.KeyFile,
+	}
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.getCertificate,
+	}
+	if config.ClientCAFile == "" {
+		return tlsConfig, nil
+	}
+
+	caPEM, err := ioutil.ReadFile(config.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading client CA file: %w", err)
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(caPEM) {
+		return nil, errors.New("no certificates found in client CA file")
+	}
+	tlsConfig.ClientCAs = clientCAs
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	if config.RequireClientCert {
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	if len(config.AllowedClientCNs) > 0 {
+		allowed := make(map[string]bool, len(config.AllowedClientCNs))
+		for _, cn := range config.AllowedClientCNs {
+			allowed[cn] = true
+		}
+		tlsConfig.VerifyPeerCertificate = func(_ [][]byte, verifiedChains [][]*x509.Certificate) error {
+			if len(verifiedChains) == 0 || len(verifiedChains[0]) == 0 {
+				// no client certificate, only possible when it is not required
+				return nil
+			}
+			cn := verifiedChains[0][0].Subject.CommonName
+			if !allowed[cn] {
+				logger.Warn("VerifyPeerCertificate: client certificate not allowed", zap.String("commonName", cn))
+				return fmt.Errorf("client certificate %q is not allowed", cn)
+			}
+			return nil
+		}
+	}
+	return tlsConfig, nil
+}
+
+// certReloader keeps the server certificate and loads it again when its files are modified
+type certReloader struct {
+	logger    *zap.Logger
+	certFile  string
+	keyFile   string
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+func (c *certReloader) getCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.checkedAt) >= certCheckInterval {
+		c.checkedAt = time.Now()
+		if modTime, err := c.lastModified(); err != nil {
+			c.logger.Error("getCertificate: error checking certificate files", zap.Error(err))
+		} else if modTime.After(c.modTime) {
+			// keep serving the current certificate when the new one can't be loaded, e.g. during the rotation
+			if err := c.load(); err != nil {
+				c.logger.Error("getCertificate: error reloading certificate", zap.Error(err))
+			} else {
+				c.logger.Info("getCertificate: certificate reloaded", zap.String("certFile", c.certFile))
+			}
+		}
+	}
+	return c.cert, nil
+}
+
+func (c *certReloader) reload() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checkedAt = time.Now()
+	return c.load()
+}
+
+// load loads the certificate, c.mu must be held
+func (c *certReloader) load() error {
+	modTime, err := c.lastModified()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("error loading certificate: %w", err)
+	}
+	c.cert = &cert
+	c.modTime = modTime
+	return nil
+}
+
+// lastModified returns the latest modification time of the certificate and key files
+func (c *certReloader) lastModified() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
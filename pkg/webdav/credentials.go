@@ -0,0 +1,59 @@
+package webdav
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"go.uber.org/zap"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Credentials are the basic auth credentials a WebDAV client uses for the backups of a cluster
+type Credentials struct {
+	User     string
+	Password string
+}
+
+// GenerateCredentials returns credentials for user with a random password
+func GenerateCredentials(user string) (Credentials, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return Credentials{}, err
+	}
+	return Credentials{User: user, Password: hex.EncodeToString(b)}, nil
+}
+
+// BasicAuth only passes requests to next with the credentials of the cluster in the first element of their
+// path, so the client of a cluster can't access the backups of other clusters. The Destination of COPY and MOVE
+// must be in the same cluster. The other requests are answered by denied with the status 401 or 403.
+func (w *Wrapper) BasicAuth(next http.Handler, denied func(rw http.ResponseWriter, r *http.Request, status int)) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		cluster := firstElement(r.URL.Path)
+		credentials, ok := w.credentials[cluster]
+		user, password, hasAuth := r.BasicAuth()
+		if !ok || !hasAuth ||
+			subtle.ConstantTimeCompare([]byte(user), []byte(credentials.User)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(password), []byte(credentials.Password)) != 1 {
+			w.logger.Warn("BasicAuth: unauthenticated WEBDAV request", zap.String("Method", r.Method), zap.String("URL", r.URL.Path), zap.String("User", user))
+			rw.Header().Set("WWW-Authenticate", `Basic realm="backupsmanager"`)
+			denied(rw, r, http.StatusUnauthorized)
+			return
+		}
+		if destination := r.Header.Get("Destination"); destination != "" {
+			u, err := url.Parse(destination)
+			if err != nil || firstElement(u.Path) != cluster {
+				w.logger.Warn("BasicAuth: WEBDAV destination in another cluster", zap.String("Method", r.Method), zap.String("URL", r.URL.Path), zap.String("Destination", destination), zap.String("User", user))
+				denied(rw, r, http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// firstElement returns the first element of urlPath
+func firstElement(urlPath string) string {
+	return strings.SplitN(strings.TrimPrefix(urlPath, "/"), "/", 2)[0]
+}
@@ -9,11 +9,14 @@ import (
 )
 
 type Wrapper struct {
-	logger  *zap.Logger
-	Handler *webdav.Handler
+	logger      *zap.Logger
+	credentials map[string]Credentials
+	Handler     *webdav.Handler
 }
 
-func NewWrapper(logger *zap.Logger, localFileSystem string) *Wrapper {
+// NewWrapper returns the WebDAV server of localFileSystem. credentials are the Credentials per cluster
+// required by BasicAuth.
+func NewWrapper(logger *zap.Logger, localFileSystem string, credentials map[string]Credentials) *Wrapper {
 	handler := &webdav.Handler{
 		FileSystem: filesystem(logger, localFileSystem),
 		LockSystem: webdav.NewMemLS(),
@@ -21,8 +24,9 @@ func NewWrapper(logger *zap.Logger, localFileSystem string) *Wrapper {
 	}
 
 	return &Wrapper{
-		logger:  logger,
-		Handler: handler,
+		logger:      logger,
+		credentials: credentials,
+		Handler:     handler,
 	}
 }
 